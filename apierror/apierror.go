@@ -0,0 +1,116 @@
+// Package apierror writes RFC 7807 application/problem+json error responses.
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/utils"
+	"net/http"
+)
+
+// ContentType is the media type of every error response
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the code to build the stable problem "type" URI
+const typeBase = "urn:go-auth-app:problem:"
+
+// Kind is a category of error with a stable machine-readable code
+type Kind struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+// Error kinds returned by the API. Codes are part of the API contract: never rename them.
+var (
+	InvalidRequest     = Kind{"invalid_request", http.StatusBadRequest, "Invalid request"}
+	ValidationFailed   = Kind{"validation_failed", http.StatusBadRequest, "Validation failed"}
+	Unauthorized       = Kind{"unauthorized", http.StatusUnauthorized, "Authentication required"}
+	InvalidToken       = Kind{"invalid_token", http.StatusUnauthorized, "Invalid token"}
+	InvalidLink        = Kind{"invalid_link", http.StatusBadRequest, "Invalid or expired link"}
+	InvalidCredentials = Kind{"invalid_credentials", http.StatusUnauthorized, "Invalid credentials"}
+	FederatedLogin     = Kind{"federated_login_failed", http.StatusUnauthorized, "Federated login failed"}
+	ReauthRequired     = Kind{"reauthentication_required", http.StatusUnauthorized, "Reauthentication required"}
+	AccountDeactivated = Kind{"account_deactivated", http.StatusForbidden, "Account deactivated"}
+	AccountPending     = Kind{"account_pending", http.StatusForbidden, "Account pending approval"}
+	AccountRejected    = Kind{"account_rejected", http.StatusForbidden, "Account rejected"}
+	Forbidden          = Kind{"forbidden", http.StatusForbidden, "Forbidden"}
+	NotFound           = Kind{"not_found", http.StatusNotFound, "Not found"}
+	MethodNotAllowed   = Kind{"method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed"}
+	EmailTaken         = Kind{"email_taken", http.StatusConflict, "Email already in use"}
+	Conflict           = Kind{"conflict", http.StatusConflict, "Conflict"}
+	PreconditionFailed = Kind{"precondition_failed", http.StatusPreconditionFailed, "Precondition failed"}
+	RequestTooLarge    = Kind{"request_too_large", http.StatusRequestEntityTooLarge, "Request body too large"}
+	UnsupportedMedia   = Kind{"unsupported_media_type", http.StatusUnsupportedMediaType, "Unsupported media type"}
+	PreconditionNeeded = Kind{"precondition_required", http.StatusPreconditionRequired, "Precondition required"}
+	TooManyRequests    = Kind{"too_many_requests", http.StatusTooManyRequests, "Too many requests"}
+	Internal           = Kind{"internal_error", http.StatusInternalServerError, "Internal server error"}
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+// New creates a problem of the given kind
+func New(kind Kind, detail string) *Problem {
+	return &Problem{
+		Type:   typeBase + kind.Code,
+		Title:  kind.Title,
+		Status: kind.Status,
+		Detail: detail,
+		Code:   kind.Code,
+	}
+}
+
+// Validation creates a validation_failed problem listing every rejected field
+func Validation(fieldErrors ...FieldError) *Problem {
+	p := New(ValidationFailed, "One or more fields are invalid")
+	p.Errors = fieldErrors
+	return p
+}
+
+// Write sends a problem of the given kind
+func Write(w http.ResponseWriter, r *http.Request, kind Kind, detail string) {
+	WriteProblem(w, r, New(kind, detail))
+}
+
+// WriteProblem sends p, filling in the request path and request ID
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = utils.RequestIDFromContext(r.Context())
+	}
+
+	if p.Status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
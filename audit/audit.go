@@ -0,0 +1,140 @@
+// Package audit records security-relevant actions (logins, password changes,
+// deactivations, operator commands) as append-only events in the database
+package audit
+
+import (
+	"context"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+)
+
+// Type identifies what happened
+type Type string
+
+// Event types
+const (
+	UserRegistered  Type = "user.registered"
+	UserLogin       Type = "user.login"
+	UserLogout      Type = "user.logout"
+	TokenRefreshed  Type = "token.refreshed"
+	PasswordChanged Type = "user.password_changed"
+	UserDeactivated Type = "user.deactivated"
+	UserReactivated Type = "user.reactivated"
+	EmailChanged    Type = "user.email_changed"
+	DataExported    Type = "user.data_exported"
+	UserErased      Type = "user.erased"
+
+	// External identities, the reason holds the provider name
+	IdentityLinked   Type = "identity.linked"
+	IdentityUnlinked Type = "identity.unlinked"
+
+	// Organization actions, the reason holds the organization ID
+	OrgCreated       Type = "org.created"
+	OrgMemberInvited Type = "org.member_invited"
+	OrgMemberJoined  Type = "org.member_joined"
+	OrgMemberRemoved Type = "org.member_removed"
+	OrgMemberRoleSet Type = "org.member_role_changed"
+
+	// Operator actions
+	UserCreated     Type = "user.created"
+	UserRestored    Type = "user.restored"
+	UsersPurged     Type = "users.purged"
+	RoleGranted     Type = "role.granted"
+	RoleRevoked     Type = "role.revoked" // by directory group sync
+	KeysRotated     Type = "keys.rotated"
+	SessionsRevoked Type = "sessions.revoked"
+	WebhookCreated  Type = "webhook.created"
+	WebhookDeleted  Type = "webhook.deleted"
+
+	// Registration policy
+	InviteCodeCreated Type = "invite_code.created"
+	InviteCodeRevoked Type = "invite_code.revoked"
+	UserApproved      Type = "user.approved"
+	UserRejected      Type = "user.rejected"
+
+	// SCIM provisioning by the identity provider, which has no user ID;
+	// group events carry the group's display name as the reason
+	SCIMUserCreated     Type = "scim.user_created"
+	SCIMUserUpdated     Type = "scim.user_updated"
+	SCIMUserDeactivated Type = "scim.user_deactivated"
+	SCIMUserReactivated Type = "scim.user_reactivated"
+	SCIMGroupCreated    Type = "scim.group_created"
+	SCIMGroupUpdated    Type = "scim.group_updated"
+	SCIMGroupDeleted    Type = "scim.group_deleted"
+)
+
+// Outcomes
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Sources
+const (
+	SourceAPI = "api"
+	SourceCLI = "cli"
+	SourceJob = "job" // background jobs of the server
+)
+
+// Event describes an action to record. Zero IDs mean "nobody" (anonymous
+// caller, operator, or no particular account); an empty Outcome is a success.
+type Event struct {
+	Type     Type
+	ActorID  int
+	TargetID int
+	Outcome  string
+	// Reason is a short machine-readable code such as "invalid_password"
+	Reason string
+}
+
+// Record stores an event for an API request, with the caller's IP address,
+// user agent and request ID. Failures are logged rather than returned: a
+// broken audit log must not lock users out.
+func Record(r *http.Request, event Event) {
+	store(r.Context(), event, models.AuditEvent{
+		Source:    SourceAPI,
+		IPAddress: utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: utils.RequestIDFromContext(r.Context()),
+	})
+}
+
+// RecordOperator stores an event for an operator command (see cmd). Unlike
+// Record it returns the error, so the command can fail loudly.
+func RecordOperator(ctx context.Context, event Event) error {
+	return store(ctx, event, models.AuditEvent{Source: SourceCLI})
+}
+
+// RecordJob stores an event for a background job such as the account purge
+func RecordJob(ctx context.Context, event Event) {
+	store(ctx, event, models.AuditEvent{Source: SourceJob})
+}
+
+func store(ctx context.Context, event Event, record models.AuditEvent) error {
+	record.Type = string(event.Type)
+	record.ActorID = optionalID(event.ActorID)
+	record.TargetID = optionalID(event.TargetID)
+	record.Outcome = event.Outcome
+	if record.Outcome == "" {
+		record.Outcome = Success
+	}
+	record.Reason = event.Reason
+
+	auditRepo := repository.AuditRepository{DB: database.DB}
+	if err := auditRepo.CreateEvent(ctx, &record); err != nil {
+		fmt.Println("❌ Failed to record audit event", record.Type, ":", err)
+		return err
+	}
+	return nil
+}
+
+func optionalID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
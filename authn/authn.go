@@ -0,0 +1,110 @@
+// Package authn checks the email and password of POST /login against the
+// configured backends: bcrypt hashes in the users table, or an LDAP /
+// Active Directory server whose users are provisioned on first login
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/config"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+)
+
+// ErrUnknownUser is returned when the backend has no such user
+var ErrUnknownUser = errors.New("unknown user")
+
+// ErrInvalidPassword is returned when the user exists but the password is wrong
+var ErrInvalidPassword = errors.New("invalid password")
+
+// ErrAccountConflict is returned when the directory user's email belongs to
+// an account the directory did not create, which it must not take over
+var ErrAccountConflict = errors.New("email belongs to an account outside the directory")
+
+// Result is who logged in, and what the backend changed on the way
+type Result struct {
+	User         models.User
+	Backend      string   // config.AuthBackendDatabase or config.AuthBackendLDAP
+	Provisioned  bool     // the user was created from the directory by this login
+	RolesAdded   []string // roles granted from directory groups by this login
+	RolesDropped []string // roles revoked because the user left the mapped groups
+}
+
+// Authenticator checks credentials. Deleted accounts are returned too, so
+// that logging in during the grace period can reactivate them.
+type Authenticator interface {
+	Authenticate(ctx context.Context, email, password string) (Result, error)
+}
+
+// New returns the authenticator for the configured backends
+func New(cfg *config.Config, db *sql.DB) Authenticator {
+	var chain Chain
+	for _, backend := range cfg.Auth.Backends {
+		switch backend {
+		case config.AuthBackendDatabase:
+			chain = append(chain, Database{DB: db})
+		case config.AuthBackendLDAP:
+			chain = append(chain, LDAP{Config: cfg.LDAP, DB: db})
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return chain
+}
+
+// Chain tries authenticators in order until one accepts the credentials.
+// If none does, a wrong password wins over a backend failure, which wins
+// over an unknown user: the most specific answer is the most useful one.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, email, password string) (Result, error) {
+	var failure error
+	var rejected *Result // the user whose password was wrong
+	for _, authenticator := range c {
+		result, err := authenticator.Authenticate(ctx, email, password)
+		switch {
+		case err == nil:
+			return result, nil
+		case errors.Is(err, ErrInvalidPassword):
+			if rejected == nil {
+				rejected = &result
+			}
+		case !errors.Is(err, ErrUnknownUser) && failure == nil:
+			failure = err
+		}
+	}
+	if rejected != nil {
+		return *rejected, ErrInvalidPassword
+	}
+	if failure != nil {
+		return Result{}, failure
+	}
+	return Result{}, ErrUnknownUser
+}
+
+// Database checks bcrypt hashes in the users table. Users without a password
+// (provisioned from a directory or an identity provider) are unknown to it.
+type Database struct {
+	DB *sql.DB
+}
+
+func (a Database) Authenticate(ctx context.Context, email, password string) (Result, error) {
+	userRepo := repository.UserRepository{DB: a.DB}
+	user, err := userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = userRepo.GetDeletedUserByEmail(ctx, email)
+	}
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !user.HasPassword()) {
+		return Result{}, ErrUnknownUser
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if !utils.CheckPasswordHash(ctx, password, user.Password) {
+		return Result{User: user}, ErrInvalidPassword
+	}
+	return Result{User: user, Backend: config.AuthBackendDatabase}, nil
+}
@@ -0,0 +1,174 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP checks passwords by binding as the user's directory entry, found by
+// email with the service account. Users are created in the users table on
+// their first login, and their mapped roles follow their groups.
+type LDAP struct {
+	Config config.LDAPConfig
+	DB     *sql.DB
+}
+
+// directoryUser is what the directory says about a user
+type directoryUser struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+func (a LDAP) Authenticate(ctx context.Context, email, password string) (Result, error) {
+	// An empty password would be an unauthenticated bind, which servers accept
+	if email == "" || password == "" {
+		return Result{}, ErrInvalidPassword
+	}
+
+	entry, err := a.bind(email, password)
+	if err != nil {
+		return Result{}, err
+	}
+	return a.provision(ctx, entry)
+}
+
+// bind finds the user's entry and binds as it
+func (a LDAP) bind(email, password string) (directoryUser, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return directoryUser{}, err
+	}
+	defer conn.Close()
+
+	if a.Config.BindDN != "" {
+		if err := conn.Bind(a.Config.BindDN, a.Config.BindPassword); err != nil {
+			return directoryUser{}, fmt.Errorf("ldap: service account bind: %w", err)
+		}
+	}
+
+	// Two entries are enough to tell an ambiguous filter from a unique match
+	attributes := []string{a.Config.EmailAttribute, a.Config.NameAttribute, a.Config.GroupAttribute}
+	search := ldap.NewSearchRequest(a.Config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.Config.Timeout.Seconds()), false,
+		fmt.Sprintf(a.Config.UserFilter, ldap.EscapeFilter(email)), attributes, nil)
+	result, err := conn.Search(search)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(result.Entries) > 1) {
+		return directoryUser{}, fmt.Errorf("ldap: more than one entry matches %s", email)
+	}
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) || (err == nil && len(result.Entries) == 0) {
+		return directoryUser{}, ErrUnknownUser
+	}
+	if err != nil {
+		return directoryUser{}, fmt.Errorf("ldap: search: %w", err)
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return directoryUser{}, ErrInvalidPassword
+		}
+		return directoryUser{}, fmt.Errorf("ldap: user bind: %w", err)
+	}
+
+	user := directoryUser{
+		DN:     entry.DN,
+		Email:  entry.GetEqualFoldAttributeValue(a.Config.EmailAttribute),
+		Name:   entry.GetEqualFoldAttributeValue(a.Config.NameAttribute),
+		Groups: entry.GetEqualFoldAttributeValues(a.Config.GroupAttribute),
+	}
+	if user.Email == "" {
+		user.Email = email
+	}
+	return user, nil
+}
+
+// dial connects to the server, upgrading to TLS when configured
+func (a LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.Config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.Config.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: dial: %w", err)
+	}
+	conn.SetTimeout(a.Config.Timeout)
+
+	if a.Config.StartTLS {
+		host := a.Config.URL
+		if parsed, err := url.Parse(a.Config.URL); err == nil {
+			host = parsed.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// provision finds or creates the user in the users table and syncs the
+// roles mapped from directory groups. Only accounts without a password that
+// the directory or SCIM created are adopted: anyone may have registered the
+// address before, and must not be handed the directory's roles.
+func (a LDAP) provision(ctx context.Context, entry directoryUser) (Result, error) {
+	result := Result{Backend: config.AuthBackendLDAP}
+	userRepo := repository.UserRepository{DB: a.DB}
+
+	user, err := userRepo.GetUserByEmail(ctx, entry.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = userRepo.GetDeletedUserByEmail(ctx, entry.Email)
+	}
+	if err == nil && (user.HasPassword() || !(user.ProvisionedByLDAP || user.ManagedBySCIM)) {
+		result.User = user
+		return result, ErrAccountConflict
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		// The directory vouches for its staff: no registration policy, no password
+		user = models.User{Name: entry.Name, Email: entry.Email, ProvisionedByLDAP: true}
+		if user.Name == "" {
+			user.Name, _, _ = strings.Cut(entry.Email, "@")
+		}
+		err = userRepo.CreateUser(ctx, &user)
+		result.Provisioned = err == nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("ldap: provisioning %s: %w", entry.Email, err)
+	}
+	result.User = user
+
+	roles, managed := a.mapGroups(entry.Groups)
+	result.RolesAdded, result.RolesDropped, err = userRepo.SyncRoles(ctx, user.ID, roles, managed)
+	if err != nil {
+		return Result{}, fmt.Errorf("ldap: syncing roles of %s: %w", entry.Email, err)
+	}
+	return result, nil
+}
+
+// mapGroups returns the roles of the user's groups, and every mapped role.
+// Group DNs are compared case-insensitively, as directories do.
+func (a LDAP) mapGroups(groups []string) (roles, managed []string) {
+	held := map[string]bool{}
+	for groupDN, role := range a.Config.GroupRoles {
+		managed = append(managed, role)
+		for _, group := range groups {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(groupDN)) {
+				held[role] = true
+			}
+		}
+	}
+	for role := range held {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, managed
+}
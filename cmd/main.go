@@ -2,16 +2,50 @@ package main
 
 import (
 	"fmt"
-	"go-auth-app/config"
-	"go-auth-app/database"
-	"go-auth-app/routes"
-	"net/http"
+	"os"
+	"strings"
 )
 
+const usage = `usage: go-auth-app <command> [arguments] [flags]
+
+commands:
+  serve                 run the HTTP API (default)
+  migrate               manage the database schema
+  user create           create a user (optionally with roles)
+  user set-password     set a user's password and revoke their sessions
+  user deactivate       soft delete a user and revoke their sessions
+  user restore          reactivate a soft-deleted user (until it is purged)
+  user purge            purge accounts deleted longer ago than the retention window
+  user export           print everything stored about a user as JSON
+  user erase            anonymize a user right away (right to erasure)
+  role grant            grant a role to a user
+  keys rotate           rotate the JWT signing keys
+  tokens revoke         revoke every session of a user
+
+Every command accepts -config, -env-file and, for admin commands, -output json|table.
+Run "go-auth-app <command> -h" for the flags of a command.`
+
 func main() {
-	config.LoadConfig()
-	database.ConnectDB()
-	routes.SetupRoutes()
-	fmt.Println("Server running on port 8080...")
-	http.ListenAndServe(":8080", nil)
+	args := os.Args[1:]
+
+	// Flags only (or nothing) starts the server, like before subcommands existed
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		serve(args)
+		return
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "serve":
+		serve(rest)
+	case "migrate":
+		runMigrate(rest)
+	case "user", "role", "keys", "tokens":
+		runAdmin(command, rest)
+	case "help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const migrateUsage = `usage: go-auth-app migrate <command> [flags]
+
+commands:
+  up            apply all pending migrations
+  down N        roll back the last N migrations
+  goto V        migrate up or down to version V
+  version       print the current schema version
+  force V       set the version without migrating (clears the dirty flag)`
+
+// runMigrate implements the `migrate` subcommand
+func runMigrate(args []string) {
+	positional, flags := splitArgs(args)
+	if len(positional) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	cfg, err := config.Load(flags)
+	if err != nil {
+		log.Fatal("❌ Invalid configuration:\n", err)
+	}
+
+	migrator, err := database.NewMigrator(cfg.Database.DSN())
+	if err != nil {
+		log.Fatal("❌ Failed to prepare migrations:", err)
+	}
+	defer migrator.Close()
+
+	command, params := positional[0], positional[1:]
+	switch command {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		var n int
+		if n, err = intParam(params); err == nil {
+			err = migrator.Down(n)
+		}
+	case "goto":
+		var v int
+		if v, err = intParam(params); err == nil {
+			err = migrator.Goto(uint(v))
+		}
+	case "force":
+		var v int
+		if v, err = intParam(params); err == nil {
+			err = migrator.Force(v)
+		}
+	case "version":
+	default:
+		log.Fatal(migrateUsage)
+	}
+	if err != nil {
+		migrator.Close()
+		log.Fatalf("❌ migrate %s failed: %v", command, err)
+	}
+
+	version, dirty, err := migrator.Version()
+	if err != nil {
+		log.Fatal("❌ Failed to read schema version:", err)
+	}
+	fmt.Printf("Schema version: %d (dirty: %t, latest: %d)\n", version, dirty, database.ExpectedSchemaVersion)
+}
+
+// intParam parses the single numeric argument of down/goto/force
+func intParam(params []string) (int, error) {
+	if len(params) != 1 {
+		return 0, fmt.Errorf("expected exactly one numeric argument")
+	}
+	n, err := strconv.Atoi(params[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", params[0])
+	}
+	return n, nil
+}
+
+// splitArgs separates leading positional arguments from the flags that follow them
+func splitArgs(args []string) (positional, flags []string) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return args[:i], args[i:]
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/mailer"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"go-auth-app/server"
+	"go-auth-app/tracing"
+	"go-auth-app/utils"
+	"go-auth-app/webhook"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How often running servers pick up keys rotated with `keys rotate`
+const signingKeyReloadInterval = 30 * time.Second
+
+// How often settled webhook events past their retention are deleted
+const webhookPruneInterval = time.Hour
+
+// serve runs the HTTP API until SIGINT/SIGTERM
+func serve(args []string) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal("❌ Invalid configuration:\n", err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("❌ Failed to initialize tracing:", err)
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := database.MigrateUp(cfg.Database.DSN()); err != nil {
+			log.Fatal("❌ Auto-migration failed:", err)
+		}
+	}
+
+	mailer.Default = mailer.New(cfg.Mail)
+
+	database.ConnectDB()
+	router := routes.SetupRoutes()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reloadSigningKeys(ctx)
+	go every(ctx, signingKeyReloadInterval, reloadSigningKeys)
+
+	// Deleted accounts past their retention window are purged in the background
+	if cfg.Accounts.PurgeInterval > 0 {
+		go every(ctx, cfg.Accounts.PurgeInterval, func(ctx context.Context) {
+			purged, err := purgeDeletedUsers(ctx, cfg.Accounts)
+			if err != nil {
+				fmt.Println("⚠️ Failed to purge deleted accounts:", err)
+			} else if purged > 0 {
+				fmt.Printf("🧹 Purged %d deleted account(s) (%s)\n", purged, cfg.Accounts.PurgeMode)
+				audit.RecordJob(ctx, audit.Event{Type: audit.UsersPurged, Reason: fmt.Sprintf("%d %s", purged, cfg.Accounts.PurgeMode)})
+			}
+		})
+	}
+
+	// Outbox events are delivered to webhook subscribers in the background
+	if cfg.Webhooks.DispatchInterval > 0 {
+		dispatcher := webhook.NewDispatcher(cfg.Webhooks)
+		go every(ctx, cfg.Webhooks.DispatchInterval, func(ctx context.Context) {
+			delivered, failed, err := dispatcher.RunOnce(ctx)
+			if err != nil {
+				fmt.Println("⚠️ Failed to dispatch webhooks:", err)
+			} else if delivered+failed > 0 {
+				fmt.Printf("🪝 Webhooks: %d delivered, %d failed\n", delivered, failed)
+			}
+		})
+	}
+
+	// Settled webhook events are pruned, since their payloads hold personal data
+	go every(ctx, webhookPruneInterval, func(ctx context.Context) {
+		webhookRepo := repository.WebhookRepository{DB: database.DB}
+		pruned, err := webhookRepo.PruneEvents(ctx, time.Now().Add(-cfg.Webhooks.Retention))
+		if err != nil {
+			fmt.Println("⚠️ Failed to prune webhook events:", err)
+		} else if pruned > 0 {
+			fmt.Printf("🧹 Pruned %d webhook event(s)\n", pruned)
+		}
+	})
+
+	// Logins abandoned at an identity provider are cleaned up
+	if len(cfg.OIDC.Providers) > 0 {
+		go every(ctx, cfg.OIDC.StateTTL, func(ctx context.Context) {
+			identityRepo := repository.IdentityRepository{DB: database.DB}
+			if _, err := identityRepo.DeleteExpiredLoginStates(ctx); err != nil {
+				fmt.Println("⚠️ Failed to delete expired login states:", err)
+			}
+		})
+	}
+	if len(cfg.SAML.IdentityProviders) > 0 {
+		go every(ctx, cfg.SAML.RequestTTL, func(ctx context.Context) {
+			identityRepo := repository.IdentityRepository{DB: database.DB}
+			if _, err := identityRepo.DeleteExpiredSAMLRequests(ctx); err != nil {
+				fmt.Println("⚠️ Failed to delete expired SAML requests:", err)
+			}
+		})
+	}
+	if cfg.Passwordless.Enabled {
+		// Challenges are kept for a request window to throttle new ones
+		go every(ctx, cfg.Passwordless.RequestWindow, func(ctx context.Context) {
+			challengeRepo := repository.LoginChallengeRepository{DB: database.DB}
+			if _, err := challengeRepo.DeleteLoginChallenges(ctx, time.Now().Add(-cfg.Passwordless.RequestWindow)); err != nil {
+				fmt.Println("⚠️ Failed to delete old login challenges:", err)
+			}
+		})
+	}
+
+	runErr := server.Run(ctx, cfg.Server, router, handlers.MarkShuttingDown)
+
+	// Release resources whether the server stopped cleanly or not
+	database.CloseDB()
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Println("⚠️ Failed to flush traces:", err)
+	}
+
+	if runErr != nil {
+		log.Println("❌ Server error:", runErr)
+		os.Exit(1)
+	}
+}
+
+// every runs fn at each interval until ctx is cancelled
+func every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
+// reloadSigningKeys loads the rotated signing keys, keeping the previous ones on error
+func reloadSigningKeys(ctx context.Context) {
+	keyRepo := repository.SigningKeyRepository{DB: database.DB}
+	keys, err := keyRepo.ListSigningKeys(ctx)
+	if err != nil {
+		fmt.Println("⚠️ Failed to load signing keys:", err)
+		return
+	}
+	utils.SetSigningKeys(keys)
+}
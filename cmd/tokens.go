@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"go-auth-app/audit"
+	"strconv"
+)
+
+// tokensRevoke implements `tokens revoke -user`, signing the user out everywhere
+func tokensRevoke(args []string) {
+	c := newAdminCommand("tokens revoke")
+	ref := c.fs.String("user", "", "user ID or email")
+	c.parse(args)
+	ctx := context.Background()
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	revoked := revokeSessions(c, ctx, user.ID)
+	c.record(ctx, audit.Event{Type: audit.SessionsRevoked, TargetID: user.ID, Reason: "operator"})
+
+	out := struct {
+		UserID          int   `json:"user_id"`
+		SessionsRevoked int64 `json:"sessions_revoked"`
+	}{user.ID, revoked}
+	c.print(out, []string{"USER ID", "SESSIONS REVOKED"}, [][]string{{strconv.Itoa(out.UserID), strconv.FormatInt(revoked, 10)}})
+}
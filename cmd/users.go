@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"go-auth-app/validation"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role names are lowercase identifiers such as "admin" or "support"
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// userCreate implements `user create`, typically used to bootstrap the first admin
+func userCreate(args []string) {
+	c := newAdminCommand("user create")
+	name := c.fs.String("name", "", "full name")
+	email := c.fs.String("email", "", "email address")
+	password := c.fs.String("password", "", "password (prefer -password-stdin)")
+	passwordStdin := c.fs.Bool("password-stdin", false, "read the password from stdin")
+	roles := c.fs.String("roles", "", "comma-separated roles to grant, e.g. admin")
+	c.parse(args)
+	ctx := context.Background()
+
+	plain, err := readPassword(*password, *passwordStdin)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	// Same rules as POST /register, reporting every invalid flag at once
+	req := handlers.RegisterRequest{Name: *name, Email: *email, Password: plain}
+	if fieldErrors := validation.Struct(req); len(fieldErrors) > 0 {
+		var messages []string
+		for _, fieldErr := range fieldErrors {
+			messages = append(messages, fieldErr.Message)
+		}
+		fail(c.name, errors.New(strings.Join(messages, "; ")))
+	}
+	user := models.User{Name: strings.TrimSpace(*name), Email: strings.TrimSpace(*email)}
+
+	roleList, err := parseRoles(*roles)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	user.Password, err = utils.HashPassword(ctx, plain)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.CreateUser(ctx, &user); err != nil {
+		fail(c.name, err)
+	}
+	c.record(ctx, audit.Event{Type: audit.UserCreated, TargetID: user.ID})
+	for _, role := range roleList {
+		if err := userRepo.GrantRole(ctx, user.ID, role); err != nil {
+			fail(c.name, err)
+		}
+		c.record(ctx, audit.Event{Type: audit.RoleGranted, TargetID: user.ID, Reason: role})
+	}
+
+	c.printUser(ctx, user.ID)
+}
+
+// userSetPassword implements `user set-password`; existing sessions are revoked
+func userSetPassword(args []string) {
+	c := newAdminCommand("user set-password")
+	ref := c.fs.String("user", "", "user ID or email")
+	password := c.fs.String("password", "", "new password (prefer -password-stdin)")
+	passwordStdin := c.fs.Bool("password-stdin", false, "read the password from stdin")
+	c.parse(args)
+	ctx := context.Background()
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	plain, err := readPassword(*password, *passwordStdin)
+	if err != nil {
+		fail(c.name, err)
+	}
+	if len(plain) < 6 {
+		fail(c.name, errors.New("password must be at least 6 characters long"))
+	}
+
+	hashed, err := utils.HashPassword(ctx, plain)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.UpdateUserPassword(ctx, user.ID, hashed); err != nil {
+		fail(c.name, err)
+	}
+	revokeSessions(c, ctx, user.ID)
+	c.record(ctx, audit.Event{Type: audit.PasswordChanged, TargetID: user.ID, Reason: "operator"})
+
+	c.printUser(ctx, user.ID)
+}
+
+// userSetActive implements `user deactivate` (revoking sessions) and `user restore`
+func userSetActive(args []string, name string, active bool) {
+	c := newAdminCommand(name)
+	ref := c.fs.String("user", "", "user ID or email")
+	c.parse(args)
+	ctx := context.Background()
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	if active {
+		err = userRepo.RestoreUser(ctx, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errors.New("the account has been purged and cannot be restored")
+		}
+	} else {
+		err = userRepo.SoftDeleteUser(ctx, user.ID, models.DeactivatedByOperator)
+	}
+	if err != nil {
+		fail(c.name, err)
+	}
+	if active {
+		c.record(ctx, audit.Event{Type: audit.UserRestored, TargetID: user.ID})
+	} else {
+		c.record(ctx, audit.Event{Type: audit.UserDeactivated, TargetID: user.ID, Reason: "operator"})
+	}
+
+	c.printUser(ctx, user.ID)
+}
+
+// userExport implements `user export`, printing everything stored about a user
+// as JSON, for data subject requests that arrive outside the API
+func userExport(args []string) {
+	c := newAdminCommand("user export")
+	ref := c.fs.String("user", "", "user ID or email")
+	c.parse(args)
+	ctx := context.Background()
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	exportRepo := repository.DataExportRepository{DB: database.DB}
+	export, err := exportRepo.ExportUser(ctx, user.ID)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	c.record(ctx, audit.Event{Type: audit.DataExported, TargetID: user.ID, Reason: "operator"})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		fail(c.name, err)
+	}
+}
+
+// userErase implements `user erase`, anonymizing a user right away
+func userErase(args []string) {
+	c := newAdminCommand("user erase")
+	ref := c.fs.String("user", "", "user ID or email")
+	c.parse(args)
+	ctx := context.Background()
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	err = userRepo.EraseUser(ctx, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errors.New("the account has already been purged")
+	}
+	if err != nil {
+		fail(c.name, err)
+	}
+	c.record(ctx, audit.Event{Type: audit.UserErased, TargetID: user.ID, Reason: "operator"})
+
+	c.printUser(ctx, user.ID)
+}
+
+// roleGrant implements `role grant`
+func roleGrant(args []string) {
+	c := newAdminCommand("role grant")
+	ref := c.fs.String("user", "", "user ID or email")
+	role := c.fs.String("role", "", "role to grant, e.g. admin")
+	c.parse(args)
+	ctx := context.Background()
+
+	if !roleNamePattern.MatchString(*role) {
+		fail(c.name, fmt.Errorf("invalid role %q", *role))
+	}
+
+	user, err := findUser(ctx, *ref)
+	if err != nil {
+		fail(c.name, err)
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.GrantRole(ctx, user.ID, *role); err != nil {
+		fail(c.name, err)
+	}
+	c.record(ctx, audit.Event{Type: audit.RoleGranted, TargetID: user.ID, Reason: *role})
+
+	c.printUser(ctx, user.ID)
+}
+
+func parseRoles(raw string) ([]string, error) {
+	var roles []string
+	for _, role := range strings.Split(raw, ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			continue
+		}
+		if !roleNamePattern.MatchString(role) {
+			return nil, fmt.Errorf("invalid role %q", role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func revokeSessions(c *adminCommand, ctx context.Context, userID int) int64 {
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	revoked, err := sessionRepo.RevokeUserSessions(ctx, userID)
+	if err != nil {
+		fail(c.name, err)
+	}
+	return revoked
+}
+
+// userPurge implements `user purge`, running the deleted account purge job once
+func userPurge(args []string) {
+	c := newAdminCommand("user purge")
+	cfg := c.parse(args)
+	ctx := context.Background()
+
+	purged, err := purgeDeletedUsers(ctx, cfg.Accounts)
+	if err != nil {
+		fail(c.name, err)
+	}
+	c.record(ctx, audit.Event{Type: audit.UsersPurged, Reason: fmt.Sprintf("%d %s", purged, cfg.Accounts.PurgeMode)})
+
+	out := struct {
+		Purged int64  `json:"purged"`
+		Mode   string `json:"mode"`
+	}{purged, cfg.Accounts.PurgeMode}
+	c.print(out, []string{"PURGED", "MODE"}, [][]string{{strconv.FormatInt(purged, 10), out.Mode}})
+}
+
+// purgeDeletedUsers removes the accounts deleted longer ago than the retention window
+func purgeDeletedUsers(ctx context.Context, accounts config.AccountsConfig) (int64, error) {
+	userRepo := repository.UserRepository{DB: database.DB}
+	return userRepo.PurgeDeletedUsers(ctx, time.Now().Add(-accounts.DeletionRetention), accounts.PurgeMode == "anonymize")
+}
@@ -1,13 +1,962 @@
 package config
 
 import (
-    "log"
-    "github.com/joho/godotenv"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete application configuration.
+//
+// Values are resolved in this order, later sources overriding earlier ones:
+// defaults, config file (YAML or TOML), .env, environment variables, flags.
+// Every setting can also be read from a file by setting <ENV>_FILE, which is
+// how Docker secrets are mounted.
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	JWT      JWTConfig      `yaml:"jwt" toml:"jwt"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Mail     MailConfig     `yaml:"mail" toml:"mail"`
+	Accounts AccountsConfig `yaml:"accounts" toml:"accounts"`
+	Webhooks WebhooksConfig `yaml:"webhooks" toml:"webhooks"`
+
+	Registration RegistrationConfig `yaml:"registration" toml:"registration"`
+	SCIM         SCIMConfig         `yaml:"scim" toml:"scim"`
+	OIDC         OIDCConfig         `yaml:"oidc" toml:"oidc"`
+	Auth         AuthConfig         `yaml:"auth" toml:"auth"`
+	LDAP         LDAPConfig         `yaml:"ldap" toml:"ldap"`
+	SAML         SAMLConfig         `yaml:"saml" toml:"saml"`
+	Passwordless PasswordlessConfig `yaml:"passwordless" toml:"passwordless"`
+	Cookies      CookieConfig       `yaml:"cookies" toml:"cookies"`
+
+	CORS            CORSConfig            `yaml:"cors" toml:"cors"`
+	SecurityHeaders SecurityHeadersConfig `yaml:"security_headers" toml:"security_headers"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"SERVER_ADDR"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int           `yaml:"max_body_bytes" toml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`
+
+	// DrainPeriod is how long we keep serving after readiness starts failing,
+	// giving load balancers time to stop sending new requests
+	DrainPeriod time.Duration `yaml:"drain_period" toml:"drain_period" env:"SERVER_DRAIN_PERIOD"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// DatabaseConfig holds the PostgreSQL connection settings
+type DatabaseConfig struct {
+	URL      string `yaml:"url" toml:"url" env:"DATABASE_URL"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME"`
+	Port     string `yaml:"port" toml:"port" env:"DB_PORT"`
+	TestMode bool   `yaml:"test_mode" toml:"test_mode" env:"TEST_MODE"`
+
+	// AutoMigrate applies pending migrations on boot before serving traffic
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// DSN returns DATABASE_URL if set, otherwise a DSN built from the individual settings
+func (c DatabaseConfig) DSN() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", c.Host, c.User, c.Password, c.Name, c.Port)
+}
+
+// JWTConfig holds the token signing settings.
+// Plain numbers are accepted for the expirations for backwards compatibility:
+// minutes for the access token and hours for the refresh token.
+type JWTConfig struct {
+	Secret            string        `yaml:"secret" toml:"secret" env:"JWT_SECRET"`
+	RefreshSecret     string        `yaml:"refresh_secret" toml:"refresh_secret" env:"JWT_REFRESH_SECRET"`
+	AccessExpiration  time.Duration `yaml:"access_expiration" toml:"access_expiration" env:"JWT_ACCESS_EXPIRATION" unit:"m"`
+	RefreshExpiration time.Duration `yaml:"refresh_expiration" toml:"refresh_expiration" env:"JWT_REFRESH_EXPIRATION" unit:"h"`
+}
+
+// TracingConfig holds the OpenTelemetry exporter settings
+type TracingConfig struct {
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// MailConfig holds the outgoing email settings. The "log" driver prints
+// messages, live links included, instead of sending them and is only
+// accepted in test mode.
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUser     string `yaml:"smtp_user" toml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD"`
+
+	// LinkBaseURL prefixes the links in emails, e.g. the web app page that
+	// posts the token back to the API
+	LinkBaseURL string `yaml:"link_base_url" toml:"link_base_url" env:"MAIL_LINK_BASE_URL"`
+}
+
+// AccountsConfig holds the self-service account lifecycle settings
+type AccountsConfig struct {
+	// EmailChangeTTL is how long the confirmation link sent to a new address is valid
+	EmailChangeTTL time.Duration `yaml:"email_change_ttl" toml:"email_change_ttl" env:"ACCOUNT_EMAIL_CHANGE_TTL"`
+	// EmailRevertTTL is how long the old address can undo an email change
+	EmailRevertTTL time.Duration `yaml:"email_revert_ttl" toml:"email_revert_ttl" env:"ACCOUNT_EMAIL_REVERT_TTL"`
+	// InvitationTTL is how long an emailed organization invitation is valid
+	InvitationTTL time.Duration `yaml:"invitation_ttl" toml:"invitation_ttl" env:"ACCOUNT_INVITATION_TTL"`
+
+	// DeletionGracePeriod is how long a deleted account can be reactivated
+	// by logging in or with an emailed link
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" toml:"deletion_grace_period" env:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	// ReactivationLinkTTL is how long an emailed reactivation link is valid
+	ReactivationLinkTTL time.Duration `yaml:"reactivation_link_ttl" toml:"reactivation_link_ttl" env:"ACCOUNT_REACTIVATION_LINK_TTL"`
+	// DeletionRetention is how long after deletion the purge job removes the account
+	DeletionRetention time.Duration `yaml:"deletion_retention" toml:"deletion_retention" env:"ACCOUNT_DELETION_RETENTION"`
+	// PurgeMode is "anonymize" (strip personal data, keep the row) or "delete"
+	PurgeMode string `yaml:"purge_mode" toml:"purge_mode" env:"ACCOUNT_PURGE_MODE"`
+	// PurgeInterval is how often the server runs the purge job; 0 disables it
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"ACCOUNT_PURGE_INTERVAL"`
+
+	// ReauthWindow is how recent the login of a user without a password must
+	// be for sensitive actions (erasure, email and first password), which
+	// users with a password confirm by sending it
+	ReauthWindow time.Duration `yaml:"reauth_window" toml:"reauth_window" env:"ACCOUNT_REAUTH_WINDOW"`
+}
+
+// Registration modes
+const (
+	RegistrationOpen       = "open"        // anyone can register
+	RegistrationInviteOnly = "invite_only" // an invite code is required
+	RegistrationApproval   = "approval"    // accounts stay pending until an admin approves them
+)
+
+// RegistrationConfig controls who can sign up with POST /register
+type RegistrationConfig struct {
+	// Mode is "open", "invite_only" or "approval". A valid invite code skips the approval queue.
+	Mode string `yaml:"mode" toml:"mode" env:"REGISTRATION_MODE"`
+	// AllowedDomains restricts registration to these email domains in every mode; empty allows any
+	AllowedDomains []string `yaml:"allowed_domains" toml:"allowed_domains" env:"REGISTRATION_ALLOWED_DOMAINS"`
+}
+
+// SCIMConfig enables user and group provisioning by an identity provider over SCIM 2.0
+type SCIMConfig struct {
+	// Token is the bearer token the identity provider authenticates with; empty disables /scim/v2
+	Token string `yaml:"token" toml:"token" env:"SCIM_TOKEN"`
+}
+
+// OIDCConfig configures federated login ("Sign in with ...") through external identity providers
+type OIDCConfig struct {
+	// RedirectBaseURL is the public URL providers send the browser back to,
+	// followed by /v1/auth/oidc/<provider>/callback
+	RedirectBaseURL string `yaml:"redirect_base_url" toml:"redirect_base_url" env:"OIDC_REDIRECT_BASE_URL"`
+	// StateTTL is how long a user has to complete a login at the provider
+	StateTTL time.Duration `yaml:"state_ttl" toml:"state_ttl" env:"OIDC_STATE_TTL"`
+	// Providers is a list in config files; OIDC_PROVIDERS takes the same list as JSON
+	Providers []OIDCProvider `yaml:"providers" toml:"providers" env:"OIDC_PROVIDERS"`
+}
+
+// OIDCProvider is an identity provider users can log in with. OpenID Connect
+// providers only need an issuer; plain OAuth2 providers (such as GitHub) set
+// the three endpoint URLs instead.
+type OIDCProvider struct {
+	Name         string   `yaml:"name" toml:"name" json:"name"` // in the URLs, e.g. "google"
+	Issuer       string   `yaml:"issuer" toml:"issuer" json:"issuer"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" json:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" json:"client_secret"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" json:"scopes"` // defaults to openid, email, profile
+
+	AuthURL     string `yaml:"auth_url" toml:"auth_url" json:"auth_url"`
+	TokenURL    string `yaml:"token_url" toml:"token_url" json:"token_url"`
+	UserInfoURL string `yaml:"userinfo_url" toml:"userinfo_url" json:"userinfo_url"`
+}
+
+// Provider returns the configured provider with this name
+func (c OIDCConfig) Provider(name string) (OIDCProvider, bool) {
+	for _, provider := range c.Providers {
+		if provider.Name == name {
+			return provider, true
+		}
+	}
+	return OIDCProvider{}, false
+}
+
+// SAMLConfig configures single sign-on with SAML 2.0 identity providers, with
+// this service as the service provider. Each identity provider gets its own
+// service provider metadata and ACS URL under /v1/auth/saml/<name>.
+type SAMLConfig struct {
+	// BaseURL is the public URL of this service, used in the entity IDs and ACS URLs
+	BaseURL string `yaml:"base_url" toml:"base_url" env:"SAML_BASE_URL"`
+	// Certificate and Key (PEM) sign authentication requests and decrypt
+	// encrypted assertions; without them requests are unsigned
+	Certificate string `yaml:"certificate" toml:"certificate" env:"SAML_CERTIFICATE"`
+	Key         string `yaml:"key" toml:"key" env:"SAML_KEY"`
+	// RequestTTL is how long a user has to complete a login at the identity provider
+	RequestTTL time.Duration `yaml:"request_ttl" toml:"request_ttl" env:"SAML_REQUEST_TTL"`
+	// IdentityProviders is a list in config files; SAML_IDENTITY_PROVIDERS takes the same list as JSON
+	IdentityProviders []SAMLIdentityProvider `yaml:"identity_providers" toml:"identity_providers" env:"SAML_IDENTITY_PROVIDERS"`
+}
+
+// SAMLIdentityProvider is a SAML identity provider users can log in with. Its
+// metadata is fetched from MetadataURL, or given inline as XML in Metadata.
+type SAMLIdentityProvider struct {
+	Name        string `yaml:"name" toml:"name" json:"name"` // in the URLs, e.g. "okta"
+	MetadataURL string `yaml:"metadata_url" toml:"metadata_url" json:"metadata_url"`
+	Metadata    string `yaml:"metadata" toml:"metadata" json:"metadata"`
+
+	// Attributes of the assertion mapped to the user, by name or friendly
+	// name. Email defaults to "email" (or an emailAddress NameID), name to
+	// "name", and the subject to the NameID.
+	EmailAttribute   string `yaml:"email_attribute" toml:"email_attribute" json:"email_attribute"`
+	NameAttribute    string `yaml:"name_attribute" toml:"name_attribute" json:"name_attribute"`
+	SubjectAttribute string `yaml:"subject_attribute" toml:"subject_attribute" json:"subject_attribute"`
+
+	// AllowIdPInitiated accepts assertions the user did not start a login for
+	AllowIdPInitiated bool `yaml:"allow_idp_initiated" toml:"allow_idp_initiated" json:"allow_idp_initiated"`
+}
+
+// IdentityProvider returns the configured SAML identity provider with this name
+func (c SAMLConfig) IdentityProvider(name string) (SAMLIdentityProvider, bool) {
+	for _, idp := range c.IdentityProviders {
+		if idp.Name == name {
+			return idp, true
+		}
+	}
+	return SAMLIdentityProvider{}, false
+}
+
+// PasswordlessConfig configures logging in with an emailed link or one-time
+// code instead of a password
+type PasswordlessConfig struct {
+	// Enabled turns the endpoints on
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"PASSWORDLESS_ENABLED"`
+	// TTL is how long an emailed link or code is valid
+	TTL time.Duration `yaml:"ttl" toml:"ttl" env:"PASSWORDLESS_TTL"`
+	// MaxAttempts is how many wrong codes end a login
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" env:"PASSWORDLESS_MAX_ATTEMPTS"`
+	// MaxRequests is how many links or codes an email address can be sent per RequestWindow
+	MaxRequests   int           `yaml:"max_requests" toml:"max_requests" env:"PASSWORDLESS_MAX_REQUESTS"`
+	RequestWindow time.Duration `yaml:"request_window" toml:"request_window" env:"PASSWORDLESS_REQUEST_WINDOW"`
+}
+
+// CookieConfig configures the cookie session mode for browser clients: the
+// tokens are set as HttpOnly cookies instead of being returned in the body,
+// and requests authenticated by cookie need a CSRF token
+type CookieConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"COOKIE_SESSIONS_ENABLED"`
+	// Domain shares the cookies with subdomains; empty is the API host only
+	Domain   string `yaml:"domain" toml:"domain" env:"COOKIE_DOMAIN"`
+	Secure   bool   `yaml:"secure" toml:"secure" env:"COOKIE_SECURE"`
+	SameSite string `yaml:"same_site" toml:"same_site" env:"COOKIE_SAME_SITE"` // lax, strict or none
+}
+
+// Cookie SameSite modes
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// CORSConfig lets browser apps on other origins call the API
+type CORSConfig struct {
+	// AllowedOrigins are origins such as https://app.example.com, with
+	// https://*.example.com for any subdomain or * for any origin; empty disables CORS
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	// AllowCredentials lets those origins send cookies, needed by cookie sessions
+	AllowCredentials bool `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// SecurityHeadersConfig sets the browser security headers sent with every response
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age; 0 omits the header
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains" env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS"`
+	FrameOptions          string        `yaml:"frame_options" toml:"frame_options" env:"SECURITY_FRAME_OPTIONS"` // DENY or SAMEORIGIN
+	ReferrerPolicy        string        `yaml:"referrer_policy" toml:"referrer_policy" env:"SECURITY_REFERRER_POLICY"`
+}
+
+// Login backends
+const (
+	AuthBackendDatabase = "database" // bcrypt hashes in the users table
+	AuthBackendLDAP     = "ldap"     // bind as the user's entry in an LDAP / Active Directory server
 )
 
-func LoadConfig() {
-    err := godotenv.Load()
-    if err != nil {
-        log.Fatal("Error loading .env file")
-    }
-}
\ No newline at end of file
+// AuthConfig selects how POST /login checks an email and password
+type AuthConfig struct {
+	// Backends are tried in order until one accepts the credentials
+	Backends []string `yaml:"backends" toml:"backends" env:"AUTH_BACKENDS"`
+}
+
+// LDAPConfig configures the ldap login backend. Users are searched for with
+// the service account, then their password is checked by binding as them.
+type LDAPConfig struct {
+	URL          string `yaml:"url" toml:"url" env:"LDAP_URL"` // ldap://host:389 or ldaps://host:636
+	StartTLS     bool   `yaml:"start_tls" toml:"start_tls" env:"LDAP_START_TLS"`
+	BindDN       string `yaml:"bind_dn" toml:"bind_dn" env:"LDAP_BIND_DN"` // empty searches anonymously
+	BindPassword string `yaml:"bind_password" toml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN       string `yaml:"base_dn" toml:"base_dn" env:"LDAP_BASE_DN"`
+	// UserFilter finds a user's entry; %s is replaced with the escaped email
+	UserFilter     string `yaml:"user_filter" toml:"user_filter" env:"LDAP_USER_FILTER"`
+	EmailAttribute string `yaml:"email_attribute" toml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE"`
+	NameAttribute  string `yaml:"name_attribute" toml:"name_attribute" env:"LDAP_NAME_ATTRIBUTE"`
+	GroupAttribute string `yaml:"group_attribute" toml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE"`
+	// GroupRoles maps group DNs to the role their members get. These roles
+	// are synced at every login; LDAP_GROUP_ROLES takes the map as JSON.
+	GroupRoles map[string]string `yaml:"group_roles" toml:"group_roles" env:"LDAP_GROUP_ROLES"`
+	Timeout    time.Duration     `yaml:"timeout" toml:"timeout" env:"LDAP_TIMEOUT"`
+}
+
+// WebhooksConfig controls delivery of outbound webhooks
+type WebhooksConfig struct {
+	// DispatchInterval is how often the server delivers pending webhooks; 0 disables the dispatcher
+	DispatchInterval time.Duration `yaml:"dispatch_interval" toml:"dispatch_interval" env:"WEBHOOK_DISPATCH_INTERVAL"`
+	// Timeout bounds each delivery request
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	// BatchSize is the most deliveries attempted per dispatch
+	BatchSize int `yaml:"batch_size" toml:"batch_size" env:"WEBHOOK_BATCH_SIZE"`
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	// InitialBackoff is the wait after the first failure, doubled after each further one up to MaxBackoff
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff" env:"WEBHOOK_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff" env:"WEBHOOK_MAX_BACKOFF"`
+	// Retention is how long events are kept once no delivery is pending; their payloads hold personal data
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"WEBHOOK_RETENTION"`
+}
+
+// Minimum length of the HMAC secrets (256 bits for HS256)
+const minSecretLength = 32
+
+// Placeholder secrets copied from the README or examples are never accepted
+var weakSecrets = []string{"secret", "changeme", "your_random_access_token_secret", "your_random_refresh_token_secret"}
+
+// providerNamePattern restricts OIDC and SAML provider names to what reads well in a URL
+var providerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// corsOriginPattern matches an origin, optionally with a wildcard subdomain
+var corsOriginPattern = regexp.MustCompile(`^https?://(\*\.)?[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:[0-9]+)?$`)
+
+// Current is the configuration loaded at startup by Load
+var Current *Config
+
+// Defaults returns the configuration used when nothing else is set
+func Defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 20, // 1 MB
+			MaxBodyBytes:      1 << 20, // 1 MB
+			DrainPeriod:       5 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		JWT: JWTConfig{
+			AccessExpiration:  15 * time.Minute,
+			RefreshExpiration: 7 * 24 * time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "go-auth-app",
+		},
+		Mail: MailConfig{
+			Driver:      "log",
+			From:        "no-reply@localhost",
+			SMTPPort:    587,
+			LinkBaseURL: "http://localhost:8080",
+		},
+		Accounts: AccountsConfig{
+			EmailChangeTTL: 24 * time.Hour,
+			EmailRevertTTL: 7 * 24 * time.Hour,
+			InvitationTTL:  7 * 24 * time.Hour,
+
+			DeletionGracePeriod: 30 * 24 * time.Hour,
+			ReactivationLinkTTL: 24 * time.Hour,
+			DeletionRetention:   30 * 24 * time.Hour,
+			PurgeMode:           "anonymize",
+			PurgeInterval:       time.Hour,
+
+			ReauthWindow: 10 * time.Minute,
+		},
+		Webhooks: WebhooksConfig{
+			DispatchInterval: 5 * time.Second,
+			Timeout:          10 * time.Second,
+			BatchSize:        50,
+			MaxAttempts:      10,
+			InitialBackoff:   30 * time.Second,
+			MaxBackoff:       6 * time.Hour,
+			Retention:        7 * 24 * time.Hour,
+		},
+		Registration: RegistrationConfig{
+			Mode: RegistrationOpen,
+		},
+		OIDC: OIDCConfig{
+			RedirectBaseURL: "http://localhost:8080",
+			StateTTL:        10 * time.Minute,
+		},
+		Auth: AuthConfig{
+			Backends: []string{AuthBackendDatabase},
+		},
+		LDAP: LDAPConfig{
+			UserFilter:     "(&(objectClass=person)(mail=%s))",
+			EmailAttribute: "mail",
+			NameAttribute:  "cn",
+			GroupAttribute: "memberOf",
+			Timeout:        5 * time.Second,
+		},
+		SAML: SAMLConfig{
+			BaseURL:    "http://localhost:8080",
+			RequestTTL: 10 * time.Minute,
+		},
+		Passwordless: PasswordlessConfig{
+			TTL:           15 * time.Minute,
+			MaxAttempts:   5,
+			MaxRequests:   3,
+			RequestWindow: 15 * time.Minute,
+		},
+		Cookies: CookieConfig{
+			Secure:   true,
+			SameSite: SameSiteLax,
+		},
+		CORS: CORSConfig{
+			MaxAge: 10 * time.Minute,
+		},
+		SecurityHeaders: SecurityHeadersConfig{
+			HSTSMaxAge:     365 * 24 * time.Hour,
+			FrameOptions:   "DENY",
+			ReferrerPolicy: "no-referrer",
+		},
+	}
+}
+
+// Get returns the configuration loaded at startup. Packages used outside of
+// main (tests, tools) get the defaults overlaid with the environment instead.
+func Get() *Config {
+	if Current != nil {
+		return Current
+	}
+	cfg := Defaults()
+	if err := applyEnv(&cfg); err != nil {
+		fmt.Println("⚠️ Ignoring invalid configuration from environment:", err)
+	}
+	return &cfg
+}
+
+// Load resolves the configuration from every source, validates it and stores
+// it in Current. args are the command-line arguments without the program name.
+func Load(args []string) (*Config, error) {
+	cfg := Defaults()
+
+	fs := flag.NewFlagSet("go-auth-app", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	envFile := fs.String("env-file", ".env", "path to an optional .env file")
+	flagValues := registerFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// .env is optional; real environment variables always win over it
+	if err := godotenv.Load(*envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading %s: %w", *envFile, err)
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	// Only flags that were explicitly set override the other sources
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if apply, ok := flagValues[f.Name]; ok && flagErr == nil {
+			flagErr = apply(f.Value.String())
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	Current = &cfg
+	return &cfg, nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr must not be empty"))
+	}
+	for name, d := range map[string]time.Duration{
+		"server.read_timeout":        c.Server.ReadTimeout,
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout,
+		"server.write_timeout":       c.Server.WriteTimeout,
+		"server.idle_timeout":        c.Server.IdleTimeout,
+		"server.shutdown_timeout":    c.Server.ShutdownTimeout,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", name, d))
+		}
+	}
+	if c.Server.DrainPeriod < 0 {
+		errs = append(errs, fmt.Errorf("server.drain_period must not be negative, got %s", c.Server.DrainPeriod))
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes must be positive, got %d", c.Server.MaxHeaderBytes))
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, fmt.Errorf("server.max_body_bytes must be positive, got %d", c.Server.MaxBodyBytes))
+	}
+
+	if c.Database.URL == "" && (c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "") {
+		errs = append(errs, errors.New("database: set DATABASE_URL or DB_HOST, DB_USER and DB_NAME"))
+	}
+
+	errs = append(errs, validateSecret("jwt.secret (JWT_SECRET)", c.JWT.Secret)...)
+	errs = append(errs, validateSecret("jwt.refresh_secret (JWT_REFRESH_SECRET)", c.JWT.RefreshSecret)...)
+	if c.JWT.Secret != "" && c.JWT.Secret == c.JWT.RefreshSecret {
+		errs = append(errs, errors.New("jwt.secret and jwt.refresh_secret must be different"))
+	}
+	if c.JWT.AccessExpiration <= 0 {
+		errs = append(errs, fmt.Errorf("jwt.access_expiration must be positive, got %s", c.JWT.AccessExpiration))
+	}
+	if c.JWT.RefreshExpiration <= c.JWT.AccessExpiration {
+		errs = append(errs, fmt.Errorf("jwt.refresh_expiration (%s) must be longer than jwt.access_expiration (%s)", c.JWT.RefreshExpiration, c.JWT.AccessExpiration))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be one of none, stdout, otlp, got %q", c.Tracing.Exporter))
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+		// Confirmation, reactivation, invitation and login links would end up in the logs
+		if !c.Database.TestMode {
+			errs = append(errs, errors.New("mail.driver log prints live links to stdout and is allowed in test mode only, set MAIL_DRIVER=smtp"))
+		}
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host (SMTP_HOST) is required by the smtp driver"))
+		}
+		if c.Mail.SMTPPort <= 0 || c.Mail.SMTPPort > 65535 {
+			errs = append(errs, fmt.Errorf("mail.smtp_port must be a valid port, got %d", c.Mail.SMTPPort))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver must be one of log, smtp, got %q", c.Mail.Driver))
+	}
+	if !strings.Contains(c.Mail.From, "@") {
+		errs = append(errs, fmt.Errorf("mail.from must be an email address, got %q", c.Mail.From))
+	}
+	if !strings.HasPrefix(c.Mail.LinkBaseURL, "http://") && !strings.HasPrefix(c.Mail.LinkBaseURL, "https://") {
+		errs = append(errs, fmt.Errorf("mail.link_base_url must be an http(s) URL, got %q", c.Mail.LinkBaseURL))
+	}
+
+	if c.Accounts.EmailChangeTTL <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.email_change_ttl must be positive, got %s", c.Accounts.EmailChangeTTL))
+	}
+	if c.Accounts.EmailRevertTTL < c.Accounts.EmailChangeTTL {
+		errs = append(errs, fmt.Errorf("accounts.email_revert_ttl (%s) must be at least accounts.email_change_ttl (%s)", c.Accounts.EmailRevertTTL, c.Accounts.EmailChangeTTL))
+	}
+	if c.Accounts.InvitationTTL <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.invitation_ttl must be positive, got %s", c.Accounts.InvitationTTL))
+	}
+	if c.Accounts.DeletionGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("accounts.deletion_grace_period must not be negative, got %s", c.Accounts.DeletionGracePeriod))
+	}
+	if c.Accounts.ReactivationLinkTTL <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.reactivation_link_ttl must be positive, got %s", c.Accounts.ReactivationLinkTTL))
+	}
+	if c.Accounts.DeletionRetention < c.Accounts.DeletionGracePeriod {
+		errs = append(errs, fmt.Errorf("accounts.deletion_retention (%s) must be at least accounts.deletion_grace_period (%s)", c.Accounts.DeletionRetention, c.Accounts.DeletionGracePeriod))
+	}
+	if c.Accounts.PurgeMode != "anonymize" && c.Accounts.PurgeMode != "delete" {
+		errs = append(errs, fmt.Errorf("accounts.purge_mode must be one of anonymize, delete, got %q", c.Accounts.PurgeMode))
+	}
+	if c.Accounts.PurgeInterval < 0 {
+		errs = append(errs, fmt.Errorf("accounts.purge_interval must not be negative, got %s", c.Accounts.PurgeInterval))
+	}
+	if c.Accounts.ReauthWindow <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.reauth_window must be positive, got %s", c.Accounts.ReauthWindow))
+	}
+
+	if c.Webhooks.DispatchInterval < 0 {
+		errs = append(errs, fmt.Errorf("webhooks.dispatch_interval must not be negative, got %s", c.Webhooks.DispatchInterval))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("webhooks.timeout must be positive, got %s", c.Webhooks.Timeout))
+	}
+	if c.Webhooks.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("webhooks.batch_size must be at least 1, got %d", c.Webhooks.BatchSize))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("webhooks.max_attempts must be at least 1, got %d", c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.InitialBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("webhooks.initial_backoff must be positive, got %s", c.Webhooks.InitialBackoff))
+	}
+	if c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+		errs = append(errs, fmt.Errorf("webhooks.max_backoff (%s) must be at least webhooks.initial_backoff (%s)", c.Webhooks.MaxBackoff, c.Webhooks.InitialBackoff))
+	}
+	if c.Webhooks.Retention <= 0 {
+		errs = append(errs, fmt.Errorf("webhooks.retention must be positive, got %s", c.Webhooks.Retention))
+	}
+
+	switch c.Registration.Mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationApproval:
+	default:
+		errs = append(errs, fmt.Errorf("registration.mode must be one of open, invite_only, approval, got %q", c.Registration.Mode))
+	}
+	for _, domain := range c.Registration.AllowedDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+			errs = append(errs, fmt.Errorf("registration.allowed_domains must be domain names such as example.com, got %q", domain))
+		}
+	}
+
+	if c.SCIM.Token != "" {
+		errs = append(errs, validateSecret("scim.token (SCIM_TOKEN)", c.SCIM.Token)...)
+	}
+
+	if !strings.HasPrefix(c.OIDC.RedirectBaseURL, "http://") && !strings.HasPrefix(c.OIDC.RedirectBaseURL, "https://") {
+		errs = append(errs, fmt.Errorf("oidc.redirect_base_url must be an http(s) URL, got %q", c.OIDC.RedirectBaseURL))
+	}
+	if c.OIDC.StateTTL <= 0 {
+		errs = append(errs, fmt.Errorf("oidc.state_ttl must be positive, got %s", c.OIDC.StateTTL))
+	}
+	seen := map[string]bool{}
+	for i, provider := range c.OIDC.Providers {
+		if !providerNamePattern.MatchString(provider.Name) || seen[provider.Name] {
+			errs = append(errs, fmt.Errorf("oidc.providers[%d].name must be a unique lowercase name such as google, got %q", i, provider.Name))
+		}
+		seen[provider.Name] = true
+		if provider.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers[%d].client_id is required", i))
+		}
+		if provider.Issuer == "" && (provider.AuthURL == "" || provider.TokenURL == "" || provider.UserInfoURL == "") {
+			errs = append(errs, fmt.Errorf("oidc.providers[%d] needs an issuer, or auth_url, token_url and userinfo_url", i))
+		}
+	}
+
+	if len(c.Auth.Backends) == 0 {
+		errs = append(errs, errors.New("auth.backends (AUTH_BACKENDS) must list at least one backend"))
+	}
+	usesLDAP := false
+	for _, backend := range c.Auth.Backends {
+		switch backend {
+		case AuthBackendDatabase:
+		case AuthBackendLDAP:
+			usesLDAP = true
+		default:
+			errs = append(errs, fmt.Errorf("auth.backends must be database or ldap, got %q", backend))
+		}
+	}
+	if usesLDAP {
+		if !strings.HasPrefix(c.LDAP.URL, "ldap://") && !strings.HasPrefix(c.LDAP.URL, "ldaps://") {
+			errs = append(errs, fmt.Errorf("ldap.url (LDAP_URL) must be an ldap:// or ldaps:// URL, got %q", c.LDAP.URL))
+		}
+		if c.LDAP.BaseDN == "" {
+			errs = append(errs, errors.New("ldap.base_dn (LDAP_BASE_DN) is required by the ldap backend"))
+		}
+		if strings.Count(c.LDAP.UserFilter, "%s") != 1 {
+			errs = append(errs, fmt.Errorf("ldap.user_filter must contain %%s exactly once, got %q", c.LDAP.UserFilter))
+		}
+		if c.LDAP.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("ldap.timeout must be positive, got %s", c.LDAP.Timeout))
+		}
+	}
+
+	if !strings.HasPrefix(c.SAML.BaseURL, "http://") && !strings.HasPrefix(c.SAML.BaseURL, "https://") {
+		errs = append(errs, fmt.Errorf("saml.base_url must be an http(s) URL, got %q", c.SAML.BaseURL))
+	}
+	if c.SAML.RequestTTL <= 0 {
+		errs = append(errs, fmt.Errorf("saml.request_ttl must be positive, got %s", c.SAML.RequestTTL))
+	}
+	if c.SAML.Certificate != "" || c.SAML.Key != "" {
+		if _, err := tls.X509KeyPair([]byte(c.SAML.Certificate), []byte(c.SAML.Key)); err != nil {
+			errs = append(errs, fmt.Errorf("saml.certificate and saml.key must be a PEM certificate and its private key: %v", err))
+		}
+	}
+	seen = map[string]bool{}
+	for i, idp := range c.SAML.IdentityProviders {
+		if !providerNamePattern.MatchString(idp.Name) || seen[idp.Name] {
+			errs = append(errs, fmt.Errorf("saml.identity_providers[%d].name must be a unique lowercase name such as okta, got %q", i, idp.Name))
+		}
+		seen[idp.Name] = true
+		if (idp.MetadataURL == "") == (idp.Metadata == "") {
+			errs = append(errs, fmt.Errorf("saml.identity_providers[%d] needs either metadata_url or metadata", i))
+		}
+	}
+
+	if c.Passwordless.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("passwordless.ttl must be positive, got %s", c.Passwordless.TTL))
+	}
+	if c.Passwordless.MaxAttempts < 1 || c.Passwordless.MaxRequests < 1 {
+		errs = append(errs, errors.New("passwordless.max_attempts and passwordless.max_requests must be at least 1"))
+	}
+	if c.Passwordless.RequestWindow <= 0 {
+		errs = append(errs, fmt.Errorf("passwordless.request_window must be positive, got %s", c.Passwordless.RequestWindow))
+	}
+
+	switch c.Cookies.SameSite {
+	case SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !c.Cookies.Secure {
+			errs = append(errs, errors.New("cookies.same_site none requires cookies.secure, browsers drop such cookies otherwise"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cookies.same_site must be one of lax, strict, none, got %q", c.Cookies.SameSite))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				errs = append(errs, errors.New("cors.allowed_origins cannot be * with cors.allow_credentials, list the origins"))
+			}
+		} else if !corsOriginPattern.MatchString(origin) {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins must be origins such as https://app.example.com or https://*.example.com, got %q", origin))
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("cors.max_age must not be negative, got %s", c.CORS.MaxAge))
+	}
+	if c.SecurityHeaders.HSTSMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("security_headers.hsts_max_age must not be negative, got %s", c.SecurityHeaders.HSTSMaxAge))
+	}
+	switch c.SecurityHeaders.FrameOptions {
+	case "DENY", "SAMEORIGIN":
+	default:
+		errs = append(errs, fmt.Errorf("security_headers.frame_options must be DENY or SAMEORIGIN, got %q", c.SecurityHeaders.FrameOptions))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateSecret(name, secret string) []error {
+	if secret == "" {
+		return []error{fmt.Errorf("%s is required", name)}
+	}
+	var errs []error
+	if len(secret) < minSecretLength {
+		errs = append(errs, fmt.Errorf("%s must be at least %d characters long", name, minSecretLength))
+	}
+	for _, weak := range weakSecrets {
+		if strings.EqualFold(secret, weak) {
+			errs = append(errs, fmt.Errorf("%s is a placeholder value, generate a random secret", name))
+		}
+	}
+	return errs
+}
+
+// loadFile decodes a YAML or TOML config file on top of cfg
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		_, err = toml.Decode(string(data), cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// field is a settable config value bound to an environment variable
+type field struct {
+	env   string
+	unit  string
+	value reflect.Value
+}
+
+// fields walks cfg and returns every field tagged with `env`
+func fields(cfg *Config) []field {
+	var result []field
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i))
+				continue
+			}
+			if env := sf.Tag.Get("env"); env != "" {
+				result = append(result, field{env: env, unit: sf.Tag.Get("unit"), value: v.Field(i)})
+			}
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return result
+}
+
+// applyEnv overlays environment variables (and their _FILE variants) on cfg
+func applyEnv(cfg *Config) error {
+	var errs []error
+	for _, f := range fields(cfg) {
+		raw, ok, err := lookupEnv(f.env)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookupEnv reads NAME, or the contents of the file named by NAME_FILE
+func lookupEnv(name string) (string, bool, error) {
+	value, hasValue := os.LookupEnv(name)
+	path, hasFile := os.LookupEnv(name + "_FILE")
+
+	switch {
+	case hasValue && hasFile:
+		return "", false, fmt.Errorf("both %s and %s_FILE are set, use only one", name, name)
+	case hasFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	case hasValue && value != "":
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+// registerFlags adds a flag for every field, named after its environment
+// variable (JWT_SECRET -> -jwt-secret), returning the setters by flag name
+func registerFlags(fs *flag.FlagSet, cfg *Config) map[string]func(string) error {
+	setters := map[string]func(string) error{}
+	for _, f := range fields(cfg) {
+		name := strings.ToLower(strings.ReplaceAll(f.env, "_", "-"))
+		fs.String(name, "", "overrides "+f.env)
+		setters[name] = func(raw string) error {
+			if err := f.set(raw); err != nil {
+				return fmt.Errorf("-%s: %w", name, err)
+			}
+			return nil
+		}
+	}
+	return setters
+}
+
+// set parses raw according to the field type
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(raw)
+	case bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		f.value.SetBool(parsed)
+	case int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		f.value.SetInt(int64(parsed))
+	case time.Duration:
+		parsed, err := parseDuration(raw, f.unit)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(parsed))
+	case []string:
+		// Comma separated, e.g. REGISTRATION_ALLOWED_DOMAINS=example.com,example.org
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		f.value.Set(reflect.ValueOf(values))
+	case []OIDCProvider:
+		// A JSON list, e.g. OIDC_PROVIDERS=[{"name": "google", "issuer": "https://accounts.google.com", ...}]
+		var providers []OIDCProvider
+		if err := json.Unmarshal([]byte(raw), &providers); err != nil {
+			return fmt.Errorf("invalid JSON list of providers: %v", err)
+		}
+		f.value.Set(reflect.ValueOf(providers))
+	case []SAMLIdentityProvider:
+		// A JSON list, e.g. SAML_IDENTITY_PROVIDERS=[{"name": "okta", "metadata_url": "https://example.okta.com/app/.../sso/saml/metadata"}]
+		var idps []SAMLIdentityProvider
+		if err := json.Unmarshal([]byte(raw), &idps); err != nil {
+			return fmt.Errorf("invalid JSON list of identity providers: %v", err)
+		}
+		f.value.Set(reflect.ValueOf(idps))
+	case map[string]string:
+		// A JSON object, e.g. LDAP_GROUP_ROLES={"cn=admins,ou=groups,dc=example,dc=com": "admin"}
+		var values map[string]string
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			return fmt.Errorf("invalid JSON object: %v", err)
+		}
+		f.value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported config field type %s", f.value.Type())
+	}
+	return nil
+}
+
+// parseDuration accepts Go durations ("15m") or, when unit is set, plain numbers in that unit
+func parseDuration(raw, unit string) (time.Duration, error) {
+	if n, err := strconv.Atoi(raw); err == nil && unit != "" {
+		switch unit {
+		case "m":
+			return time.Duration(n) * time.Minute, nil
+		case "h":
+			return time.Duration(n) * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return d, nil
+}
@@ -1,10 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"go-auth-app/config"
 	"log"
-	"os"
 	"strings"
 
 	"github.com/DATA-DOG/go-txdb" // Transactional DB for testing
@@ -16,7 +17,7 @@ var DB *sql.DB
 
 // Register transactional test DB (runs once)
 func init() {
-	databaseURL := os.Getenv("DATABASE_URL")
+	databaseURL := config.Get().Database.URL
 	if databaseURL == "" {
 		fmt.Println("⚠️ DATABASE_URL not set, using default connection settings.")
 	} else if !strings.Contains(databaseURL, "sslmode") {
@@ -29,8 +30,10 @@ func init() {
 
 // ConnectDB initializes the database connection
 func ConnectDB() {
+	dbConfig := config.Get().Database
+
 	// ✅ Use `txdb` for tests if `TEST_MODE` is set
-	if os.Getenv("TEST_MODE") == "true" {
+	if dbConfig.TestMode {
 		var err error
 		DB, err = sql.Open("txdb", "test_db")
 		if err != nil {
@@ -40,17 +43,9 @@ func ConnectDB() {
 		return
 	}
 
-	// ✅ Prioritize `DATABASE_URL`
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		// Fallback to manual connection string
-		host := os.Getenv("DB_HOST")
-		user := os.Getenv("DB_USER")
-		password := os.Getenv("DB_PASSWORD")
-		dbName := os.Getenv("DB_NAME")
-		port := os.Getenv("DB_PORT")
-
-		dbURL = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", host, user, password, dbName, port)
+	// ✅ Prioritize `DATABASE_URL`, falling back to the DB_* settings
+	dbURL := dbConfig.DSN()
+	if dbConfig.URL == "" {
 		fmt.Println("⚠️ DATABASE_URL not set, using manually constructed DSN")
 	}
 
@@ -68,3 +63,24 @@ func ConnectDB() {
 
 	fmt.Println("✅ Database connected successfully!")
 }
+
+// SchemaVersion reports the version recorded by golang-migrate in schema_migrations
+func SchemaVersion(ctx context.Context) (version int, dirty bool, err error) {
+	err = DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+// CloseDB closes the connection pool, waiting for queries in progress to finish
+func CloseDB() {
+	if DB == nil {
+		return
+	}
+	if err := DB.Close(); err != nil {
+		fmt.Println("⚠️ Error closing database:", err)
+		return
+	}
+	fmt.Println("✅ Database connection closed")
+}
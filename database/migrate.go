@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/migrations"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// ExpectedSchemaVersion is the latest migration embedded in the binary
+var ExpectedSchemaVersion = latestMigrationVersion()
+
+// latestMigrationVersion reads the highest version prefix from the embedded *.up.sql files
+func latestMigrationVersion() int {
+	files, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil || len(files) == 0 {
+		panic("no embedded migrations found")
+	}
+	sort.Strings(files)
+	last := files[len(files)-1]
+	version, err := strconv.Atoi(strings.SplitN(last, "_", 2)[0])
+	if err != nil {
+		panic(fmt.Sprintf("invalid migration file name %q", last))
+	}
+	return version
+}
+
+// Migrator applies the embedded migrations to the database at dsn.
+// golang-migrate holds a Postgres advisory lock while it runs, so several
+// replicas migrating on boot wait for each other instead of racing.
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// NewMigrator opens a dedicated connection for running migrations
+func NewMigrator(dsn string) (*Migrator, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting migration driver: %w", err)
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("reading embedded migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+	m.Log = migrateLogger{}
+
+	return &Migrator{m: m}, nil
+}
+
+// Up applies all pending migrations
+func (mg *Migrator) Up() error {
+	return ignoreNoChange(mg.m.Up())
+}
+
+// Down rolls back the last n migrations
+func (mg *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	return ignoreNoChange(mg.m.Steps(-n))
+}
+
+// Goto migrates up or down to the given version
+func (mg *Migrator) Goto(version uint) error {
+	return ignoreNoChange(mg.m.Migrate(version))
+}
+
+// Force sets the recorded version without running any migration, clearing the dirty flag.
+// Use it after manually repairing a failed migration.
+func (mg *Migrator) Force(version int) error {
+	return mg.m.Force(version)
+}
+
+// Version returns the current schema version (0 if no migration was ever applied)
+func (mg *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Close releases the migration connection
+func (mg *Migrator) Close() error {
+	sourceErr, dbErr := mg.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// MigrateUp applies all pending migrations to the database at dsn
+func MigrateUp(dsn string) error {
+	mg, err := NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer mg.Close()
+
+	if err := mg.Up(); err != nil {
+		return err
+	}
+
+	version, _, err := mg.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Println("✅ Database schema at version", version)
+	return nil
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("✅ No migrations to apply")
+		return nil
+	}
+	return err
+}
+
+// migrateLogger prints golang-migrate progress in the same style as the rest of the app
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...interface{}) {
+	fmt.Printf("🔹 migrate: "+format, v...)
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
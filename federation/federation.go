@@ -0,0 +1,277 @@
+// Package federation logs users in through external identity providers:
+// OpenID Connect providers found by discovery, plain OAuth2 providers (such
+// as GitHub) that only offer a userinfo endpoint, and SAML 2.0 identity
+// providers.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/config"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrUnknownProvider is returned for provider names that are not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// DefaultScopes are requested when a provider does not configure any
+var DefaultScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// Identity is the account a user logged in with at a provider
+type Identity struct {
+	Subject       string // stable ID at the provider, never reassigned
+	Email         string
+	EmailVerified bool // only verified addresses may be matched to existing users
+	Name          string
+}
+
+// Provider runs the authorization code flow against one identity provider
+type Provider struct {
+	Name        string
+	oauth       oauth2.Config
+	verifier    *oidc.IDTokenVerifier // nil for plain OAuth2 providers
+	userInfoURL string
+}
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]*Provider{} // keyed by configuration, so config changes take effect
+	lookups     = map[string]*lookup{}   // discoveries and metadata fetches in flight, by key
+)
+
+// lookupTimeout bounds a discovery or metadata fetch. It runs detached from
+// the request that started it, since other requests may be waiting for it.
+const lookupTimeout = 10 * time.Second
+
+// lookup is a provider being set up; its result is ready once done is closed
+type lookup struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// lookupOnce runs setUp for key, or waits for the run already in flight, so
+// that concurrent logins through one provider fetch its configuration once.
+// setUp runs without providersMu held, so a slow or unreachable identity
+// provider only holds up the logins through it, each until its own request
+// context ends.
+func lookupOnce(ctx context.Context, key string, setUp func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	providersMu.Lock()
+	l, inFlight := lookups[key]
+	if !inFlight {
+		l = &lookup{done: make(chan struct{})}
+		lookups[key] = l
+		go func() {
+			setUpCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+			defer cancel()
+			l.value, l.err = setUp(setUpCtx)
+
+			providersMu.Lock()
+			delete(lookups, key)
+			providersMu.Unlock()
+			close(l.done)
+		}()
+	}
+	providersMu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Get returns the configured provider with this name. OpenID Connect
+// providers are discovered on first use; failed discoveries are retried.
+func Get(ctx context.Context, name string) (*Provider, error) {
+	cfg := config.Get().OIDC
+	providerCfg, ok := cfg.Provider(name)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	key := fmt.Sprintf("%s|%#v", cfg.RedirectBaseURL, providerCfg)
+	providersMu.Lock()
+	provider, ok := providers[key]
+	providersMu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	value, err := lookupOnce(ctx, "oidc|"+key, func(ctx context.Context) (interface{}, error) {
+		provider, err := newProvider(ctx, providerCfg, cfg.RedirectBaseURL)
+		if err != nil {
+			return nil, err
+		}
+		providersMu.Lock()
+		providers[key] = provider
+		providersMu.Unlock()
+		return provider, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Provider), nil
+}
+
+func newProvider(ctx context.Context, cfg config.OIDCProvider, redirectBaseURL string) (*Provider, error) {
+	provider := &Provider{
+		Name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  strings.TrimSuffix(redirectBaseURL, "/") + "/v1/auth/oidc/" + cfg.Name + "/callback",
+			Scopes:       cfg.Scopes,
+			Endpoint:     oauth2.Endpoint{AuthURL: cfg.AuthURL, TokenURL: cfg.TokenURL},
+		},
+		userInfoURL: cfg.UserInfoURL,
+	}
+	if len(provider.oauth.Scopes) == 0 {
+		provider.oauth.Scopes = DefaultScopes
+	}
+
+	if cfg.Issuer != "" {
+		discovered, err := oidc.NewProvider(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("discovering %s: %w", cfg.Name, err)
+		}
+		// Explicit URLs override the discovered ones
+		if cfg.AuthURL == "" {
+			provider.oauth.Endpoint.AuthURL = discovered.Endpoint().AuthURL
+		}
+		if cfg.TokenURL == "" {
+			provider.oauth.Endpoint.TokenURL = discovered.Endpoint().TokenURL
+		}
+		if cfg.UserInfoURL == "" {
+			provider.userInfoURL = discovered.UserInfoEndpoint()
+		}
+		provider.verifier = discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	}
+	return provider, nil
+}
+
+// AuthCodeURL is where to send the browser to log in. The code challenge is
+// derived from verifier (PKCE), and the nonce is bound into the ID token.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if p.verifier != nil {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+	return p.oauth.AuthCodeURL(state, opts...)
+}
+
+// Exchange redeems the authorization code and returns who logged in. For
+// OpenID Connect providers the ID token's signature, audience, expiry and
+// nonce are checked; plain OAuth2 providers are asked for the userinfo.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	if p.verifier == nil {
+		return p.userInfo(ctx, token)
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("verifying id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, errors.New("id_token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("reading id_token claims: %w", err)
+	}
+	identity := Identity{Subject: idToken.Subject, Email: claims.Email, EmailVerified: claims.EmailVerified, Name: claims.Name}
+
+	// Some providers leave the profile out of the ID token
+	if identity.Email == "" && p.userInfoURL != "" {
+		info, err := p.userInfo(ctx, token)
+		if err != nil {
+			return Identity{}, err
+		}
+		if info.Subject != identity.Subject {
+			return Identity{}, errors.New("userinfo subject does not match id_token")
+		}
+		identity.Email, identity.EmailVerified = info.Email, info.EmailVerified
+		if identity.Name == "" {
+			identity.Name = info.Name
+		}
+	}
+	return identity, nil
+}
+
+// userInfo fetches the profile with the access token. Subjects may be
+// numbers (GitHub's "id"), so they are read as raw JSON.
+func (p *Provider) userInfo(ctx context.Context, token *oauth2.Token) (Identity, error) {
+	if p.userInfoURL == "" {
+		return Identity{}, errors.New("provider has no userinfo endpoint")
+	}
+	resp, err := p.oauth.Client(ctx, token).Get(p.userInfoURL)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("fetching userinfo: status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Sub           json.RawMessage `json:"sub"`
+		ID            json.RawMessage `json:"id"`
+		Email         string          `json:"email"`
+		EmailVerified bool            `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&info); err != nil {
+		return Identity{}, fmt.Errorf("reading userinfo: %w", err)
+	}
+
+	subject := rawString(info.Sub)
+	if subject == "" {
+		subject = rawString(info.ID)
+	}
+	if subject == "" {
+		return Identity{}, errors.New("userinfo has no subject")
+	}
+	return Identity{Subject: subject, Email: info.Email, EmailVerified: info.EmailVerified, Name: info.Name}, nil
+}
+
+// rawString reads a JSON string or number as a string
+func rawString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// NewVerifier returns a random PKCE code verifier for a new login
+func NewVerifier() string {
+	return oauth2.GenerateVerifier()
+}
@@ -0,0 +1,226 @@
+package federation
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go-auth-app/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SAMLLogin is who an assertion logs in, and what is needed to refuse its replay
+type SAMLLogin struct {
+	Identity
+	AssertionID string
+	ExpiresAt   time.Time // the assertion is not accepted after this
+}
+
+// SAMLProvider is this service as the service provider of one SAML identity provider
+type SAMLProvider struct {
+	Name string
+	cfg  config.SAMLIdentityProvider
+	sp   saml.ServiceProvider
+}
+
+var samlProviders = map[string]*SAMLProvider{} // guarded by providersMu, keyed by configuration
+
+// GetSAML returns the configured SAML identity provider with this name. Its
+// metadata is fetched on first use; failed fetches are retried.
+func GetSAML(ctx context.Context, name string) (*SAMLProvider, error) {
+	cfg := config.Get().SAML
+	idpCfg, ok := cfg.IdentityProvider(name)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	key := fmt.Sprintf("%s|%s|%#v", cfg.BaseURL, cfg.Certificate, idpCfg)
+	providersMu.Lock()
+	provider, ok := samlProviders[key]
+	providersMu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	value, err := lookupOnce(ctx, "saml|"+key, func(ctx context.Context) (interface{}, error) {
+		provider, err := newSAMLProvider(ctx, cfg, idpCfg)
+		if err != nil {
+			return nil, err
+		}
+		providersMu.Lock()
+		samlProviders[key] = provider
+		providersMu.Unlock()
+		return provider, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*SAMLProvider), nil
+}
+
+func newSAMLProvider(ctx context.Context, cfg config.SAMLConfig, idpCfg config.SAMLIdentityProvider) (*SAMLProvider, error) {
+	base := strings.TrimSuffix(cfg.BaseURL, "/") + "/v1/auth/saml/" + idpCfg.Name
+	metadataURL, err := url.Parse(base + "/metadata")
+	if err != nil {
+		return nil, err
+	}
+	acsURL, _ := url.Parse(base + "/acs")
+
+	provider := &SAMLProvider{
+		Name: idpCfg.Name,
+		cfg:  idpCfg,
+		sp: saml.ServiceProvider{
+			EntityID:          metadataURL.String(),
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			AuthnNameIDFormat: saml.UnspecifiedNameIDFormat, // the identity provider's choice
+			AllowIDPInitiated: idpCfg.AllowIdPInitiated,
+		},
+	}
+
+	if cfg.Certificate != "" {
+		keyPair, err := tls.X509KeyPair([]byte(cfg.Certificate), []byte(cfg.Key))
+		if err != nil {
+			return nil, fmt.Errorf("loading the SAML certificate: %w", err)
+		}
+		rsaKey, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the SAML key must be an RSA key")
+		}
+		provider.sp.Key = rsaKey
+		provider.sp.Certificate = keyPair.Leaf
+		provider.sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+
+	raw := []byte(idpCfg.Metadata)
+	if idpCfg.MetadataURL != "" {
+		if raw, err = fetchMetadata(ctx, idpCfg.MetadataURL); err != nil {
+			return nil, fmt.Errorf("fetching metadata of %s: %w", idpCfg.Name, err)
+		}
+	}
+	provider.sp.IDPMetadata = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(raw, provider.sp.IDPMetadata); err != nil {
+		return nil, fmt.Errorf("reading metadata of %s: %w", idpCfg.Name, err)
+	}
+	if provider.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+		return nil, fmt.Errorf("metadata of %s has no HTTP-Redirect single sign-on service", idpCfg.Name)
+	}
+	return provider, nil
+}
+
+func fetchMetadata(ctx context.Context, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// Metadata is the service provider metadata to register at the identity provider
+func (p *SAMLProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// AuthnRequestURL is where to send the browser to log in, with the
+// HTTP-Redirect binding. The response must answer requestID.
+func (p *SAMLProvider) AuthnRequestURL(relayState string) (redirect, requestID string, err error) {
+	req, err := p.sp.MakeAuthenticationRequest(p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirectURL, err := req.Redirect(relayState, &p.sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirectURL.String(), req.ID, nil
+}
+
+// AllowsIdPInitiated tells whether assertions may arrive without a login started here
+func (p *SAMLProvider) AllowsIdPInitiated() bool {
+	return p.cfg.AllowIdPInitiated
+}
+
+// ParseResponse checks the signature, issuer, audience, recipient, validity
+// window and InResponseTo of the response posted to the ACS, and maps the
+// assertion's attributes to an identity. The identity provider is trusted
+// to vouch for email addresses.
+func (p *SAMLProvider) ParseResponse(r *http.Request, requestIDs []string) (SAMLLogin, error) {
+	assertion, err := p.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return SAMLLogin{}, err
+	}
+
+	login := SAMLLogin{AssertionID: assertion.ID, ExpiresAt: time.Now().Add(saml.MaxIssueDelay)}
+	if assertion.Conditions != nil && !assertion.Conditions.NotOnOrAfter.IsZero() {
+		login.ExpiresAt = assertion.Conditions.NotOnOrAfter.Add(saml.MaxClockSkew)
+	}
+
+	var nameID *saml.NameID
+	if assertion.Subject != nil {
+		nameID = assertion.Subject.NameID
+	}
+	login.Email = attribute(assertion, firstNonEmpty(p.cfg.EmailAttribute, "email"))
+	if login.Email == "" && nameID != nil && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		login.Email = nameID.Value
+	}
+	login.EmailVerified = login.Email != ""
+	login.Name = attribute(assertion, firstNonEmpty(p.cfg.NameAttribute, "name"))
+
+	// A transient NameID changes at every login, so it cannot identify a user
+	switch {
+	case p.cfg.SubjectAttribute != "":
+		login.Subject = attribute(assertion, p.cfg.SubjectAttribute)
+	case nameID != nil && nameID.Format != string(saml.TransientNameIDFormat):
+		login.Subject = nameID.Value
+	}
+	if login.Subject == "" {
+		return SAMLLogin{}, errors.New("assertion has no persistent subject; set subject_attribute")
+	}
+	return login, nil
+}
+
+// attribute returns the first value of the attribute with this name or friendly name
+func attribute(assertion *saml.Assertion, name string) string {
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0].Value)
+			}
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/database"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Page sizes of audit event listings
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// AuditEventList is a page of audit events, newest first. Pass NextCursor as
+// ?cursor= to get the next page; it is omitted on the last page.
+type AuditEventList struct {
+	Events     []models.AuditEvent `json:"events"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// ListAuditEvents lets admins search the audit log by type, actor, target,
+// outcome and time range (since inclusive, until exclusive)
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter repository.AuditFilter
+	var fieldErrors []apierror.FieldError
+
+	filter.Type = query.Get("type")
+	filter.ActorID = parseIDParam(query, "actor_id", &fieldErrors)
+	filter.TargetID = parseIDParam(query, "target_id", &fieldErrors)
+	filter.Outcome = query.Get("outcome")
+	if filter.Outcome != "" && filter.Outcome != audit.Success && filter.Outcome != audit.Failure {
+		fieldErrors = append(fieldErrors, apierror.FieldError{Field: "outcome", Code: "one_of", Message: "outcome must be one of: success, failure"})
+	}
+	filter.Since = parseTimeParam(query, "since", &fieldErrors)
+	filter.Until = parseTimeParam(query, "until", &fieldErrors)
+
+	listAuditEvents(w, r, filter, fieldErrors)
+}
+
+// GetUserActivity shows the authenticated user the audit events about their
+// account: logins (including failed attempts), password changes and so on
+func GetUserActivity(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	listAuditEvents(w, r, repository.AuditFilter{UserID: userID}, nil)
+}
+
+// listAuditEvents applies the limit and cursor parameters and writes one page of events
+func listAuditEvents(w http.ResponseWriter, r *http.Request, filter repository.AuditFilter, fieldErrors []apierror.FieldError) {
+	query := r.URL.Query()
+
+	limit := defaultAuditLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			fieldErrors = append(fieldErrors, apierror.FieldError{Field: "limit", Code: "range", Message: "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+		}
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		beforeID, err := decodeCursor(raw)
+		if err != nil {
+			fieldErrors = append(fieldErrors, apierror.FieldError{Field: "cursor", Code: "invalid", Message: "cursor must be a next_cursor value from a previous page"})
+		}
+		filter.BeforeID = beforeID
+	}
+	if len(fieldErrors) > 0 {
+		apierror.WriteProblem(w, r, apierror.Validation(fieldErrors...))
+		return
+	}
+
+	// Fetch one extra event to know whether there is a next page
+	auditRepo := repository.AuditRepository{DB: database.DB}
+	events, err := auditRepo.ListEvents(r.Context(), filter, limit+1)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch audit events")
+		return
+	}
+
+	response := AuditEventList{Events: events}
+	if len(events) > limit {
+		response.Events = events[:limit]
+		response.NextCursor = encodeCursor(events[limit-1].ID)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Cursors are opaque to clients so the pagination key can change later
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(raw), 10, 64)
+}
+
+func parseIDParam(query url.Values, name string, fieldErrors *[]apierror.FieldError) int {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 1 {
+		*fieldErrors = append(*fieldErrors, apierror.FieldError{Field: name, Code: "type", Message: name + " must be a user ID"})
+	}
+	return id
+}
+
+func parseTimeParam(query url.Values, name string, fieldErrors *[]apierror.FieldError) time.Time {
+	raw := query.Get(name)
+	if raw == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		*fieldErrors = append(*fieldErrors, apierror.FieldError{Field: name, Code: "type", Message: name + " must be an RFC 3339 timestamp"})
+	}
+	return t
+}
@@ -1,79 +1,132 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/authn"
+	"go-auth-app/config"
 	"go-auth-app/database"
+	"go-auth-app/middleware"
 	"go-auth-app/models"
 	"go-auth-app/repository"
 	"go-auth-app/utils"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
 // UserResponse struct (without password)
 type UserResponse struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Password string `json:"-"`
-	IsDeleted bool `json:"is_deleted"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Password  string `json:"-"`
+	IsDeleted bool   `json:"is_deleted"`
+}
 
+// RegisterRequest is the body of POST /register
+type RegisterRequest struct {
+	Name       string `json:"name" validate:"required,min=3,max=255"`
+	Email      string `json:"email" validate:"required,email,max=255"`
+	Password   string `json:"password" validate:"required,notrim,min=6,maxbytes=72"` // bcrypt rejects longer passwords
+	InviteCode string `json:"invite_code" validate:"max=128"`                        // Required in invite_only mode
 }
 
-// Validate user input
-func validateUserInput(user models.User) error {
-	// Trim spaces from input
-	user.Name = strings.TrimSpace(user.Name)
-	user.Email = strings.TrimSpace(user.Email)
-	user.Password = strings.TrimSpace(user.Password)
+// PendingRegistration is returned instead of the user when the account awaits approval
+type PendingRegistration struct {
+	ID      int    `json:"id"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
 
-	// Validate name (at least 3 characters)
-	if len(user.Name) < 3 {
-		return errors.New("name must be at least 3 characters long")
+func RegisterUser(w http.ResponseWriter, r *http.Request) {
+	// Decode and validate input
+	var req RegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
 	}
-
-	// Validate email format
-	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	if matched, _ := regexp.MatchString(emailRegex, user.Email); !matched {
-		return errors.New("invalid email format")
+	user := models.User{
+		Name:     strings.TrimSpace(req.Name),
+		Email:    strings.TrimSpace(req.Email),
+		Password: req.Password,
 	}
+	inviteCode := strings.TrimSpace(req.InviteCode)
 
-	// Validate password (at least 6 characters)
-	if len(user.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
+	// 🚧 Enforce the registration policy before doing any work
+	policy := config.Get().Registration
+	if fieldErr := checkEmailDomain(user.Email, policy.AllowedDomains); fieldErr != nil {
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "domain_not_allowed"})
+		apierror.WriteProblem(w, r, apierror.Validation(*fieldErr))
+		return
 	}
-
-	return nil
-}
-
-func RegisterUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	json.NewDecoder(r.Body).Decode(&user)
-	// Validate input
-	if err := validateUserInput(user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if inviteCode == "" && policy.Mode == config.RegistrationInviteOnly {
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "invite_required"})
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+			Field:   "invite_code",
+			Code:    "required",
+			Message: "invite_code is required, registration is by invitation only",
+		}))
 		return
 	}
+	// An invite code vouches for the user, so it also skips the approval queue
+	if inviteCode == "" && policy.Mode == config.RegistrationApproval {
+		user.Status = models.UserStatusPending
+	}
 
 	// Hash the password
-	hashedPassword, _ := utils.HashPassword(user.Password)
+	hashedPassword, err := utils.HashPassword(r.Context(), user.Password)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to hash password")
+		return
+	}
 	user.Password = hashedPassword
 
 	// Create user repository
 	userRepo := repository.UserRepository{DB: database.DB}
-	err := userRepo.CreateUser(&user) // Pass user as pointer
+	if inviteCode != "" {
+		inviteRepo := repository.InviteRepository{DB: database.DB}
+		err = inviteRepo.RegisterWithInvite(r.Context(), &user, utils.HashLinkToken(inviteCode))
+	} else {
+		err = userRepo.CreateUser(r.Context(), &user) // Pass user as pointer
+	}
 
 	// Handle errors
 	if err != nil {
-		if err.Error() == "email already registered" {
-			http.Error(w, "Email is already in use", http.StatusConflict)
-			return
+		switch {
+		case errors.Is(err, repository.ErrEmailTaken):
+			audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "email_taken"})
+			apierror.Write(w, r, apierror.EmailTaken, "Email is already in use")
+		case errors.Is(err, repository.ErrInviteInvalid):
+			audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "invalid_invite"})
+			apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+				Field:   "invite_code",
+				Code:    "invalid",
+				Message: "invite_code is invalid, expired or already used",
+			}))
+		case errors.Is(err, repository.ErrInviteEmail):
+			audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "invite_email_mismatch"})
+			apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+				Field:   "invite_code",
+				Code:    "email_mismatch",
+				Message: "invite_code was issued for another email address",
+			}))
+		default:
+			fmt.Println("❌ SQL Error in CreateUser:", err) // 🛑 Debug SQL errors
+			apierror.Write(w, r, apierror.Internal, "Error creating user")
 		}
-		fmt.Println("❌ SQL Error in CreateUser:", err) // 🛑 Debug SQL errors
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.UserRegistered, ActorID: user.ID, TargetID: user.ID, Reason: user.Status})
+
+	if user.Status == models.UserStatusPending {
+		fmt.Println("⏳ RegisterUser: User ID", user.ID, "waits for approval")
+		writeJSON(w, http.StatusAccepted, PendingRegistration{
+			ID:      user.ID,
+			Status:  user.Status,
+			Message: "Registration received. You can log in once an administrator approves your account.",
+		})
 		return
 	}
 
@@ -85,97 +138,261 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusCreated, response)
 }
 
+// checkEmailDomain rejects addresses outside the allowed domains; an empty list allows any
+func checkEmailDomain(email string, allowed []string) *apierror.FieldError {
+	if len(allowed) == 0 {
+		return nil
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	for _, candidate := range allowed {
+		if strings.EqualFold(domain, candidate) {
+			return nil
+		}
+	}
+	return &apierror.FieldError{
+		Field:   "email",
+		Code:    "domain_not_allowed",
+		Message: "email must be an address at " + strings.Join(allowed, ", "),
+	}
+}
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 // LoginResponse struct
 type LoginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"` // cookie session mode only, instead of the tokens
 }
 
 // LoginUser handles user authentication and token issuance
 func LoginUser(w http.ResponseWriter, r *http.Request) {
+	// Decode and validate input
 	var req LoginRequest
-	json.NewDecoder(r.Body).Decode(&req)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
-	// Validate input
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	// Check the credentials with the configured backends (database, LDAP)
+	result, err := authn.New(config.Get(), database.DB).Authenticate(r.Context(), req.Email, req.Password)
+	switch {
+	case errors.Is(err, authn.ErrUnknownUser):
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "unknown_email"})
+		apierror.Write(w, r, apierror.InvalidCredentials, "Invalid credentials")
+		return
+	case errors.Is(err, authn.ErrInvalidPassword):
+		audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: result.User.ID, Outcome: audit.Failure, Reason: "invalid_password"})
+		apierror.Write(w, r, apierror.InvalidCredentials, "Invalid credentials")
+		return
+	case errors.Is(err, authn.ErrAccountConflict):
+		// The directory password was right, so the account's existence is no secret
+		audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: result.User.ID, Outcome: audit.Failure, Reason: "account_conflict"})
+		apierror.Write(w, r, apierror.Conflict, "An account with this email already exists that the directory did not create. Contact an administrator.")
+		return
+	case err != nil:
+		// Like an unknown user, so that an outage does not tell which emails exist
+		fmt.Println("❌ LoginUser:", err)
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "backend_error"})
+		apierror.Write(w, r, apierror.InvalidCredentials, "Invalid credentials")
 		return
 	}
+	user := result.User
 
-	// Fetch user from DB
-	userRepo := repository.UserRepository{DB: database.DB}
-	user, err := userRepo.GetUserByEmail(req.Email)
-	if err != nil || !utils.CheckPasswordHash(req.Password, user.Password) {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	// 🗂️ Users and roles from the directory
+	if result.Provisioned {
+		fmt.Println("👤 LoginUser: Provisioned user ID", user.ID, "from", result.Backend)
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, ActorID: user.ID, TargetID: user.ID, Reason: result.Backend})
+	}
+	for _, role := range result.RolesAdded {
+		audit.Record(r, audit.Event{Type: audit.RoleGranted, TargetID: user.ID, Reason: role})
+	}
+	for _, role := range result.RolesDropped {
+		audit.Record(r, audit.Event{Type: audit.RoleRevoked, TargetID: user.ID, Reason: role})
+	}
+
+	method := ""
+	if result.Backend != config.AuthBackendDatabase {
+		method = result.Backend
+	}
+	completeLogin(w, r, user, method)
+}
+
+// completeLogin finishes a login once the user proved who they are, by
+// password or through an identity provider: it enforces the account status,
+// reactivates deleted accounts and starts a session. method is recorded as
+// the reason of the login event (empty for database passwords).
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.User, method string) {
+	// ⏳ Accounts from the approval queue can only log in once approved
+	switch user.Status {
+	case models.UserStatusPending:
+		audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: user.ID, Outcome: audit.Failure, Reason: "account_pending"})
+		apierror.Write(w, r, apierror.AccountPending, "Your account is waiting for approval by an administrator")
+		return
+	case models.UserStatusRejected:
+		audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: user.ID, Outcome: audit.Failure, Reason: "account_rejected"})
+		apierror.Write(w, r, apierror.AccountRejected, "Your registration was not approved")
 		return
 	}
 
-	// ❌ Prevent login if the user is deactivated
-	if user.IsDeleted {
-		http.Error(w, "Account is deactivated. Contact support.", http.StatusForbidden)
+	// ♻️ Logging in during the grace period reactivates an account the user deleted
+	if user.DeletedAt != nil {
+		if user.DeactivatedBy != models.DeactivatedBySelf {
+			audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: user.ID, Outcome: audit.Failure, Reason: "account_deactivated"})
+			apierror.Write(w, r, apierror.AccountDeactivated, "Account was deactivated by an administrator. Contact support.")
+			return
+		}
+		if !canReactivate(user) {
+			audit.Record(r, audit.Event{Type: audit.UserLogin, TargetID: user.ID, Outcome: audit.Failure, Reason: "account_deactivated"})
+			apierror.Write(w, r, apierror.AccountDeactivated, "Account was deleted and can no longer be reactivated. Contact support.")
+			return
+		}
+		userRepo := repository.UserRepository{DB: database.DB}
+		if err := userRepo.RestoreUser(r.Context(), user.ID); err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to reactivate account")
+			return
+		}
+		fmt.Println("♻️ completeLogin: Reactivated user ID", user.ID)
+		audit.Record(r, audit.Event{Type: audit.UserReactivated, ActorID: user.ID, TargetID: user.ID, Reason: "login"})
+	}
+
+	// Start a session so the tokens can be revoked later
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	session := models.Session{UserID: user.ID, IPAddress: utils.ClientIP(r), UserAgent: r.UserAgent()}
+	if err := sessionRepo.CreateSession(r.Context(), &session); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start session")
 		return
 	}
 
 	// Generate access & refresh tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID)
+	accessToken, err := utils.GenerateAccessToken(user.ID, session.ID, session.ActiveOrgID)
 	if err != nil {
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to generate access token")
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, session.ID)
 	if err != nil {
-		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to generate refresh token")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.UserLogin, ActorID: user.ID, TargetID: user.ID, Reason: method})
+
+	noStore(w)
+
+	// 🍪 In cookie session mode the tokens never reach the page's JavaScript
+	if config.Get().Cookies.Enabled {
+		setSessionCookies(w, accessToken, refreshToken, session.ID)
+		writeJSON(w, http.StatusOK, LoginResponse{CSRFToken: utils.CSRFToken(session.ID)})
 		return
 	}
 
 	// Send tokens to client
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(LoginResponse{
+	writeJSON(w, http.StatusOK, LoginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	})
 }
 
-
-
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
-// RefreshToken generates a new access token using a valid refresh token
+// RefreshToken generates a new access token using a valid refresh token. In
+// cookie session mode browsers post no body: the refresh token is read from
+// its cookie and the new access token set as a cookie.
 func RefreshToken(w http.ResponseWriter, r *http.Request) {
-	var req RefreshRequest
-	json.NewDecoder(r.Body).Decode(&req)
+	var refreshToken string
+	// ❌ Cookie mode is v1-only: the refresh cookie is scoped to /v1/refresh
+	if r.ContentLength == 0 && r.URL.Path != refreshCookiePath && config.Get().Cookies.Enabled {
+		apierror.Write(w, r, apierror.InvalidRequest, "Cookie sessions refresh at POST "+refreshCookiePath+"; /refresh only takes the refresh token in the body")
+		return
+	}
+	cookie, err := r.Cookie(middleware.RefreshTokenCookie)
+	viaCookie := err == nil && r.ContentLength == 0 && config.Get().Cookies.Enabled
+	if viaCookie {
+		refreshToken = cookie.Value
+	} else {
+		var req RefreshRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		refreshToken = req.RefreshToken
+	}
 
 	// Validate the refresh token
-	userID, err := utils.ValidateToken(req.RefreshToken, true)
+	claims, err := utils.ValidateToken(refreshToken, true)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		audit.Record(r, audit.Event{Type: audit.TokenRefreshed, Outcome: audit.Failure, Reason: "invalid_token"})
+		apierror.Write(w, r, apierror.InvalidToken, "Invalid refresh token")
+		return
+	}
+	if viaCookie && !middleware.ValidCSRF(r, claims.SessionID) {
+		audit.Record(r, audit.Event{Type: audit.TokenRefreshed, TargetID: claims.UserID, Outcome: audit.Failure, Reason: "invalid_csrf_token"})
+		apierror.Write(w, r, apierror.Forbidden, "Missing or invalid "+middleware.CSRFHeader+" header")
+		return
+	}
+
+	// ❌ Refuse to refresh revoked sessions
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	active, err := sessionRepo.IsSessionActive(r.Context(), claims.SessionID, claims.UserID)
+	if err != nil || !active {
+		audit.Record(r, audit.Event{Type: audit.TokenRefreshed, TargetID: claims.UserID, Outcome: audit.Failure, Reason: "session_revoked"})
+		apierror.Write(w, r, apierror.InvalidToken, "Invalid refresh token")
+		return
+	}
+
+	// The new access token carries the organization the session is switched to
+	orgID, err := sessionRepo.ActiveOrgID(r.Context(), claims.SessionID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to load session")
 		return
 	}
 
 	// Generate new access token
-	accessToken, err := utils.GenerateAccessToken(userID)
+	accessToken, err := utils.GenerateAccessToken(claims.UserID, claims.SessionID, orgID)
 	if err != nil {
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to generate access token")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.TokenRefreshed, ActorID: claims.UserID, TargetID: claims.UserID})
+
+	noStore(w)
+	if viaCookie {
+		setAccessCookie(w, accessToken)
+		setCSRFCookie(w, claims.SessionID)
+		writeJSON(w, http.StatusOK, map[string]string{
+			"csrf_token": utils.CSRFToken(claims.SessionID),
+		})
 		return
 	}
 
 	// Return new access token
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"access_token": accessToken,
 	})
 }
+
+// Logout revokes the session of the access token, and clears the session
+// cookies in cookie session mode
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(int)
+
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	if err := sessionRepo.RevokeSession(r.Context(), sessionID, userID); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to log out")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.UserLogout, ActorID: userID, TargetID: userID})
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
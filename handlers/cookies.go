@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"go-auth-app/config"
+	"go-auth-app/middleware"
+	"go-auth-app/utils"
+	"net/http"
+	"time"
+)
+
+// refreshCookiePath limits the refresh token cookie to the refresh endpoint
+const refreshCookiePath = "/v1/refresh"
+
+// sessionCookie builds a cookie of the cookie session mode with the configured attributes
+func sessionCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	cfg := config.Get().Cookies
+	sameSite := http.SameSiteLaxMode
+	switch cfg.SameSite {
+	case config.SameSiteStrict:
+		sameSite = http.SameSiteStrictMode
+	case config.SameSiteNone:
+		sameSite = http.SameSiteNoneMode
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   cfg.Secure,
+		SameSite: sameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// setAccessCookie sets the access token cookie, sent with every API request
+func setAccessCookie(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, sessionCookie(middleware.AccessTokenCookie, accessToken, "/", config.Get().JWT.AccessExpiration, true))
+}
+
+// setSessionCookies sets the token pair as HttpOnly cookies, and the CSRF
+// token as a cookie the page can read to echo it in the CSRF header
+func setSessionCookies(w http.ResponseWriter, accessToken, refreshToken string, sessionID int) {
+	setAccessCookie(w, accessToken)
+	http.SetCookie(w, sessionCookie(middleware.RefreshTokenCookie, refreshToken, refreshCookiePath, config.Get().JWT.RefreshExpiration, true))
+	setCSRFCookie(w, sessionID)
+}
+
+// setCSRFCookie (re)sets the CSRF token cookie, which follows the signing key
+func setCSRFCookie(w http.ResponseWriter, sessionID int) {
+	http.SetCookie(w, sessionCookie(middleware.CSRFCookie, utils.CSRFToken(sessionID), "/", config.Get().JWT.RefreshExpiration, false))
+}
+
+// clearSessionCookies removes the cookies of the cookie session mode
+func clearSessionCookies(w http.ResponseWriter) {
+	if !config.Get().Cookies.Enabled {
+		return
+	}
+	http.SetCookie(w, sessionCookie(middleware.AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, sessionCookie(middleware.RefreshTokenCookie, "", refreshCookiePath, -1, true))
+	http.SetCookie(w, sessionCookie(middleware.CSRFCookie, "", "/", -1, false))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/database"
+	"go-auth-app/middleware"
+	"go-auth-app/repository"
+	"net/http"
+	"strings"
+)
+
+// EraseRequest is the body of POST /users/me/erase
+type EraseRequest struct {
+	Password string `json:"password"` // not needed by users without a password who logged in recently
+}
+
+// ExportUserData returns everything stored about the authenticated user as a
+// downloadable JSON document, or as a ZIP archive with one file per section
+// when asked for with ?format=zip or Accept: application/zip
+func ExportUserData(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(r.Header.Get("Accept"), "application/zip") {
+			format = "zip"
+		}
+	}
+	if format != "json" && format != "zip" {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{Field: "format", Code: "one_of", Message: "format must be one of: json, zip"}))
+		return
+	}
+
+	exportRepo := repository.DataExportRepository{DB: database.DB}
+	export, err := exportRepo.ExportUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "User not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to export user data")
+		return
+	}
+
+	fmt.Println("📦 ExportUserData: Exporting data of user ID", userID, "as", format)
+	audit.Record(r, audit.Event{Type: audit.DataExported, ActorID: userID, TargetID: userID, Reason: format})
+	filename := fmt.Sprintf("user-%d-export-%s", userID, export.GeneratedAt.Format("20060102T150405Z"))
+
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		writeJSON(w, http.StatusOK, export)
+		return
+	}
+
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"roles.json", export.Roles},
+		{"memberships.json", export.Memberships},
+		{"invitations.json", export.Invitations},
+		{"sessions.json", export.Sessions},
+		{"identities.json", export.Identities},
+		{"email_changes.json", export.EmailChanges},
+		{"action_tokens.json", export.ActionTokens},
+		{"login_challenges.json", export.LoginChallenges},
+		{"audit_events.json", export.AuditEvents},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent by now, so a failure can only truncate the archive
+	archive := zip.NewWriter(w)
+	for _, section := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: section.name, Method: zip.Deflate, Modified: export.GeneratedAt})
+		if err != nil {
+			fmt.Println("❌ ExportUserData: Failed to write archive:", err)
+			return
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.data); err != nil {
+			fmt.Println("❌ ExportUserData: Failed to write archive:", err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		fmt.Println("❌ ExportUserData: Failed to write archive:", err)
+	}
+}
+
+// EraseUser anonymizes the authenticated user's account and personal data
+// immediately (right to erasure). Unlike DELETE /users/me/deactivate there is
+// no grace period: the account cannot be reactivated afterwards.
+func EraseUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req EraseRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Re-authenticate: erasure is irreversible
+	if !reauthenticate(w, r, req.Password, audit.UserErased) {
+		return
+	}
+
+	// Sessions are revoked as part of the anonymization
+	userRepo := repository.UserRepository{DB: database.DB}
+	err := userRepo.EraseUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "User not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to erase user")
+		return
+	}
+
+	// Recorded after the anonymization, so this event keeps the request's IP
+	// address as evidence of who asked for the erasure
+	fmt.Println("🧽 EraseUser: Anonymized user ID", userID)
+	audit.Record(r, audit.Event{Type: audit.UserErased, ActorID: userID, TargetID: userID})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Your account and personal data have been erased"})
+}
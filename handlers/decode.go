@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/config"
+	"go-auth-app/validation"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// decodeJSON reads a single JSON object from the request body into dst and
+// validates it. It enforces the JSON content type, the configured body size
+// limit and rejects unknown fields. On failure it writes a problem response
+// and returns false, so handlers just return.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		apierror.Write(w, r, apierror.UnsupportedMedia, "Content-Type must be application/json")
+		return false
+	}
+
+	maxBytes := int64(config.Get().Server.MaxBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		writeDecodeError(w, r, err, maxBytes)
+		return false
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		apierror.Write(w, r, apierror.InvalidRequest, "Request body must contain a single JSON object")
+		return false
+	}
+
+	if fieldErrors := validation.Struct(dst); len(fieldErrors) > 0 {
+		apierror.WriteProblem(w, r, apierror.Validation(fieldErrors...))
+		return false
+	}
+	return true
+}
+
+// writeDecodeError turns encoding/json errors into precise problem responses
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error, maxBytes int64) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		apierror.Write(w, r, apierror.RequestTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxBytes))
+	case errors.As(err, &syntaxErr):
+		apierror.Write(w, r, apierror.InvalidRequest, fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		apierror.Write(w, r, apierror.InvalidRequest, "Malformed JSON: unexpected end of body")
+	case errors.Is(err, io.EOF):
+		apierror.Write(w, r, apierror.InvalidRequest, "Request body must not be empty")
+	case errors.As(err, &typeErr):
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.Kind()),
+		}))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+			Field:   field,
+			Code:    "unknown_field",
+			Message: field + " is not a recognized field",
+		}))
+	default:
+		apierror.Write(w, r, apierror.InvalidRequest, "Request body is not valid JSON")
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChangeEmailRequest is the body of POST /users/me/email
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email,max=255"`
+	Password string `json:"password"` // not needed by users without a password who logged in recently
+}
+
+// LinkTokenRequest carries the token from an emailed link (confirm, revert, reactivate)
+type LinkTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// RequestEmailChange starts an email change: the new address gets a
+// confirmation link and the current one a notification with a revert link.
+// Nothing changes until the new address confirms.
+func RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req ChangeEmailRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	newEmail := strings.TrimSpace(req.NewEmail)
+
+	// Re-authenticate: a stolen access token alone must not be enough to take over the account
+	if !reauthenticate(w, r, req.Password, "") {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound, "User not found")
+		return
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+			Field:   "new_email",
+			Code:    "unchanged",
+			Message: "new_email must be different from the current email",
+		}))
+		return
+	}
+	if taken, err := userRepo.EmailExists(r.Context(), newEmail); err != nil || taken {
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to start email change")
+		} else {
+			apierror.Write(w, r, apierror.EmailTaken, "Email is already in use")
+		}
+		return
+	}
+
+	confirmToken, confirmHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start email change")
+		return
+	}
+	revertToken, revertHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start email change")
+		return
+	}
+
+	accounts := config.Get().Accounts
+	change := models.EmailChange{
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: confirmHash,
+		RevertTokenHash:  revertHash,
+		ConfirmExpiresAt: time.Now().Add(accounts.EmailChangeTTL),
+		RevertExpiresAt:  time.Now().Add(accounts.EmailRevertTTL),
+	}
+	changeRepo := repository.EmailChangeRepository{DB: database.DB}
+	if err := changeRepo.CreateEmailChange(r.Context(), &change); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start email change")
+		return
+	}
+
+	err = mailer.Send(r.Context(), mailer.Message{
+		To:      change.NewEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm that %s is your new email address by opening this link within %s:\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.Name, change.NewEmail, accounts.EmailChangeTTL, mailer.Link("/email-changes/confirm?token="+url.QueryEscape(confirmToken))),
+	})
+	if err != nil {
+		fmt.Println("❌ Failed to send email change confirmation:", err)
+		apierror.Write(w, r, apierror.Internal, "Failed to send the confirmation email")
+		return
+	}
+
+	err = mailer.Send(r.Context(), mailer.Message{
+		To:      change.OldEmail,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your account to %s.\n\nIf this was not you, open this link within %s to cancel or undo the change and sign out every session:\n\n%s\n",
+			user.Name, change.NewEmail, accounts.EmailRevertTTL, mailer.Link("/email-changes/revert?token="+url.QueryEscape(revertToken))),
+	})
+	if err != nil {
+		// The change is still pending, so this is worth failing the request for
+		fmt.Println("❌ Failed to send email change notification:", err)
+		apierror.Write(w, r, apierror.Internal, "Failed to send the notification email")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Confirmation link sent to " + change.NewEmail,
+	})
+}
+
+// ConfirmEmailChange completes an email change from the link sent to the new address
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req LinkTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	changeRepo := repository.EmailChangeRepository{DB: database.DB}
+	change, err := changeRepo.ConfirmEmailChange(r.Context(), utils.HashLinkToken(req.Token))
+	switch {
+	case errors.Is(err, repository.ErrEmailChangeNotFound):
+		apierror.Write(w, r, apierror.InvalidLink, "Confirmation link is invalid or has expired")
+		return
+	case errors.Is(err, repository.ErrEmailTaken):
+		apierror.Write(w, r, apierror.EmailTaken, "Email is already in use")
+		return
+	case err != nil:
+		apierror.Write(w, r, apierror.Internal, "Failed to change email")
+		return
+	}
+
+	fmt.Println("✅ Email changed for user ID", change.UserID)
+	audit.Record(r, audit.Event{Type: audit.EmailChanged, TargetID: change.UserID, Reason: "confirmed"})
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Email address updated. All sessions were signed out, please log in again.",
+	})
+}
+
+// RevertEmailChange cancels or undoes an email change from the link sent to the old address
+func RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req LinkTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	changeRepo := repository.EmailChangeRepository{DB: database.DB}
+	change, err := changeRepo.RevertEmailChange(r.Context(), utils.HashLinkToken(req.Token))
+	switch {
+	case errors.Is(err, repository.ErrEmailChangeNotFound):
+		apierror.Write(w, r, apierror.InvalidLink, "Revert link is invalid or has expired")
+		return
+	case errors.Is(err, repository.ErrEmailTaken):
+		apierror.Write(w, r, apierror.EmailTaken, "The previous email address is now used by another account")
+		return
+	case err != nil:
+		apierror.Write(w, r, apierror.Internal, "Failed to revert email change")
+		return
+	}
+
+	fmt.Println("⚠️ Email change reverted for user ID", change.UserID)
+	audit.Record(r, audit.Event{Type: audit.EmailChanged, TargetID: change.UserID, Reason: "reverted"})
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Email change reverted and all sessions signed out. Consider resetting your password.",
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/utils"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown flips readiness to failing once the server starts draining
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes /readyz report the service as unavailable so the
+// orchestrator stops routing new traffic while in-flight requests finish
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// ComponentStatus describes the health of a single dependency. /readyz is
+// unauthenticated, so errors from dependencies are only logged.
+type ComponentStatus struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Version *int   `json:"version,omitempty"`
+}
+
+// HealthResponse is returned by /healthz and /readyz
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Healthz reports that the process is alive (no dependency checks)
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: statusOK})
+}
+
+// Readyz reports whether the service can accept traffic: the database is
+// reachable, the schema is at the expected version and signing keys are loaded
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	components := map[string]ComponentStatus{
+		"database":     checkDatabase(ctx),
+		"migrations":   checkMigrations(ctx),
+		"signing_keys": checkSigningKeys(),
+	}
+
+	if shuttingDown.Load() {
+		components["server"] = ComponentStatus{Status: statusUnavailable, Error: "shutting down"}
+	}
+
+	response := HealthResponse{Status: statusOK, Components: components}
+	code := http.StatusOK
+	for _, component := range components {
+		if component.Status != statusOK {
+			response.Status = statusUnavailable
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	writeHealth(w, code, response)
+}
+
+func checkDatabase(ctx context.Context) ComponentStatus {
+	if database.DB == nil {
+		return ComponentStatus{Status: statusUnavailable, Error: "database not initialized"}
+	}
+	if err := database.DB.PingContext(ctx); err != nil {
+		fmt.Println("❌ Readyz: database:", err)
+		return ComponentStatus{Status: statusUnavailable}
+	}
+	return ComponentStatus{Status: statusOK}
+}
+
+func checkMigrations(ctx context.Context) ComponentStatus {
+	if database.DB == nil {
+		return ComponentStatus{Status: statusUnavailable, Error: "database not initialized"}
+	}
+
+	version, dirty, err := database.SchemaVersion(ctx)
+	if err != nil {
+		fmt.Println("❌ Readyz: migrations:", err)
+		return ComponentStatus{Status: statusUnavailable}
+	}
+
+	status := ComponentStatus{Status: statusOK, Version: &version}
+	switch {
+	case dirty:
+		status.Status = statusUnavailable
+		status.Error = "schema is dirty, a migration failed part-way"
+	case version != database.ExpectedSchemaVersion:
+		status.Status = statusUnavailable
+		status.Error = fmt.Sprintf("schema version %d, expected %d", version, database.ExpectedSchemaVersion)
+	}
+	return status
+}
+
+func checkSigningKeys() ComponentStatus {
+	if err := utils.SigningKeysLoaded(); err != nil {
+		fmt.Println("❌ Readyz: signing keys:", err)
+		return ComponentStatus{Status: statusUnavailable}
+	}
+	return ComponentStatus{Status: statusOK}
+}
+
+func writeHealth(w http.ResponseWriter, code int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Readiness fails once shutdown has started (503 Service Unavailable).
+// This lives next to the handler so it can reset the process-wide flag.
+func TestReadyz_ShuttingDown(t *testing.T) {
+	MarkShuttingDown()
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+
+	Readyz(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Expected 503 while shutting down")
+
+	var response HealthResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, "unavailable", response.Status)
+	assert.Equal(t, "unavailable", response.Components["server"].Status)
+	assert.Contains(t, response.Components, "database")
+	assert.Contains(t, response.Components, "migrations")
+	assert.Contains(t, response.Components, "signing_keys")
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/federation"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so an
+// attacker cannot log a victim into the attacker's account (login CSRF)
+const oidcStateCookie = "oidc_state"
+
+// AuthorizationURL is returned when linking a provider from an API client
+type AuthorizationURL struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// ListOIDCProviders returns the names of the providers users can log in with
+func ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, provider := range config.Get().OIDC.Providers {
+		names = append(names, provider.Name)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": names})
+}
+
+// AuthorizeOIDC redirects the browser to the provider to log in
+func AuthorizeOIDC(w http.ResponseWriter, r *http.Request) {
+	authURL, ok := startFederatedLogin(w, r, nil)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// StartIdentityLink starts a login at the provider whose account will be
+// linked to the authenticated user, and returns where to send the browser
+func StartIdentityLink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	authURL, ok := startFederatedLogin(w, r, &userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, AuthorizationURL{AuthorizationURL: authURL})
+}
+
+// startFederatedLogin stores a new login state for the provider in the URL
+// and sets the state cookie. linkUserID is set when linking an account.
+func startFederatedLogin(w http.ResponseWriter, r *http.Request, linkUserID *int) (string, bool) {
+	provider, err := federation.Get(r.Context(), mux.Vars(r)["provider"])
+	if errors.Is(err, federation.ErrUnknownProvider) {
+		apierror.Write(w, r, apierror.NotFound, "Unknown identity provider")
+		return "", false
+	}
+	if err != nil {
+		fmt.Println("❌ startFederatedLogin:", err)
+		apierror.Write(w, r, apierror.Internal, "Identity provider is unavailable")
+		return "", false
+	}
+
+	state, stateHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return "", false
+	}
+	nonce, _, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return "", false
+	}
+
+	cfg := config.Get().OIDC
+	login := models.OIDCLoginState{
+		StateHash:    stateHash,
+		Provider:     provider.Name,
+		CodeVerifier: federation.NewVerifier(),
+		Nonce:        nonce,
+		UserID:       linkUserID,
+		ExpiresAt:    time.Now().Add(cfg.StateTTL),
+	}
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	if err := identityRepo.CreateLoginState(r.Context(), &login); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return "", false
+	}
+
+	// Lax, not Strict: the provider sends the browser back with a cross-site redirect
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/auth/oidc/" + provider.Name,
+		MaxAge:   int(cfg.StateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.RedirectBaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return provider.AuthCodeURL(state, login.Nonce, login.CodeVerifier), true
+}
+
+// OIDCCallback completes a login at the provider and issues our own token
+// pair. The external account is matched to a user by its link, by verified
+// email, or becomes a new user if the registration policy allows it.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	provider, err := federation.Get(r.Context(), mux.Vars(r)["provider"])
+	if errors.Is(err, federation.ErrUnknownProvider) {
+		apierror.Write(w, r, apierror.NotFound, "Unknown identity provider")
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ OIDCCallback:", err)
+		apierror.Write(w, r, apierror.Internal, "Identity provider is unavailable")
+		return
+	}
+
+	// The state is single-use, whatever happens next
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/v1/auth/oidc/" + provider.Name, MaxAge: -1})
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "provider_error"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Login at the identity provider failed: "+providerErr)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "state_mismatch"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Login was not started from this browser")
+		return
+	}
+
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	login, err := identityRepo.ConsumeLoginState(r.Context(), provider.Name, utils.HashLinkToken(state))
+	if errors.Is(err, repository.ErrLoginStateInvalid) {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "invalid_state"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Login expired or was already completed, please start again")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+
+	external, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		fmt.Println("❌ OIDCCallback:", provider.Name, err)
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "exchange_failed"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Identity provider did not confirm the login")
+		return
+	}
+
+	userID, ok := resolveIdentity(w, r, provider.Name, external, login.UserID)
+	if !ok {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+	completeLogin(w, r, user, "oidc:"+provider.Name)
+}
+
+// resolveIdentity finds the user an external account logs in as, linking or
+// signing up as needed, and writes the error response when there is none
+func resolveIdentity(w http.ResponseWriter, r *http.Request, providerName string, external federation.Identity, linkUserID *int) (int, bool) {
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	identity, err := identityRepo.GetIdentity(r.Context(), providerName, external.Subject)
+	if err == nil {
+		if linkUserID != nil && *linkUserID != identity.UserID {
+			audit.Record(r, audit.Event{Type: audit.IdentityLinked, ActorID: *linkUserID, Outcome: audit.Failure, Reason: providerName})
+			apierror.Write(w, r, apierror.Conflict, "This account is already linked to another user")
+			return 0, false
+		}
+		if err := identityRepo.RecordIdentityLogin(r.Context(), identity.ID, external.Email); err != nil {
+			fmt.Println("⚠️ resolveIdentity: Failed to record login:", err)
+		}
+		return identity.UserID, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return 0, false
+	}
+
+	identity = models.UserIdentity{Provider: providerName, Subject: external.Subject, Email: external.Email}
+
+	// 🔗 Explicit link from an authenticated user
+	if linkUserID != nil {
+		identity.UserID = *linkUserID
+		return linkIdentity(w, r, identity)
+	}
+
+	// 🔗 A verified address proves the owner of the existing account logged in.
+	// Local addresses are never verified, though: anyone could have registered
+	// one with a password before its owner showed up, so only accounts without
+	// a password are linked. The others sign up, which fails with email_taken.
+	userRepo := repository.UserRepository{DB: database.DB}
+	if external.EmailVerified && external.Email != "" {
+		user, err := userRepo.GetUserByEmail(r.Context(), external.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = userRepo.GetDeletedUserByEmail(r.Context(), external.Email)
+		}
+		if err == nil && !user.HasPassword() {
+			identity.UserID = user.ID
+			return linkIdentity(w, r, identity)
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+			return 0, false
+		}
+	}
+
+	return signUpWithIdentity(w, r, external, identity)
+}
+
+// linkIdentity links identity to its user
+func linkIdentity(w http.ResponseWriter, r *http.Request, identity models.UserIdentity) (int, bool) {
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	err := identityRepo.LinkIdentity(r.Context(), &identity)
+	if errors.Is(err, repository.ErrIdentityLinked) {
+		apierror.Write(w, r, apierror.Conflict, "This account is already linked to another user")
+		return 0, false
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to link account")
+		return 0, false
+	}
+
+	fmt.Println("🔗 linkIdentity: Linked", identity.Provider, "account to user ID", identity.UserID)
+	audit.Record(r, audit.Event{Type: audit.IdentityLinked, ActorID: identity.UserID, TargetID: identity.UserID, Reason: identity.Provider})
+	return identity.UserID, true
+}
+
+// signUpWithIdentity creates a passwordless user for an external account,
+// under the same registration policy as POST /register
+func signUpWithIdentity(w http.ResponseWriter, r *http.Request, external federation.Identity, identity models.UserIdentity) (int, bool) {
+	if external.Email == "" {
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "no_email"})
+		apierror.Write(w, r, apierror.FederatedLogin, "The identity provider did not share an email address")
+		return 0, false
+	}
+
+	policy := config.Get().Registration
+	if fieldErr := checkEmailDomain(external.Email, policy.AllowedDomains); fieldErr != nil {
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "domain_not_allowed"})
+		apierror.Write(w, r, apierror.Forbidden, fieldErr.Message)
+		return 0, false
+	}
+	if policy.Mode == config.RegistrationInviteOnly {
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "invite_required"})
+		apierror.Write(w, r, apierror.Forbidden, "Registration is by invitation only")
+		return 0, false
+	}
+
+	user := models.User{Name: strings.TrimSpace(external.Name), Email: external.Email}
+	if user.Name == "" {
+		user.Name, _, _ = strings.Cut(external.Email, "@")
+	}
+	if policy.Mode == config.RegistrationApproval {
+		user.Status = models.UserStatusPending
+	}
+
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	err := identityRepo.CreateUserWithIdentity(r.Context(), &user, &identity)
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		// An unverified address must not take over the account that owns it
+		audit.Record(r, audit.Event{Type: audit.UserRegistered, Outcome: audit.Failure, Reason: "email_taken"})
+		apierror.Write(w, r, apierror.EmailTaken, "Email is already in use. Log in to your account and link "+identity.Provider+" from there.")
+		return 0, false
+	case errors.Is(err, repository.ErrIdentityLinked):
+		apierror.Write(w, r, apierror.Conflict, "This account was linked concurrently, please log in again")
+		return 0, false
+	case err != nil:
+		fmt.Println("❌ SQL Error in CreateUserWithIdentity:", err)
+		apierror.Write(w, r, apierror.Internal, "Error creating user")
+		return 0, false
+	}
+
+	fmt.Println("👤 signUpWithIdentity: Created user ID", user.ID, "from", identity.Provider)
+	audit.Record(r, audit.Event{Type: audit.UserRegistered, ActorID: user.ID, TargetID: user.ID, Reason: user.Status})
+	audit.Record(r, audit.Event{Type: audit.IdentityLinked, ActorID: user.ID, TargetID: user.ID, Reason: identity.Provider})
+	return user.ID, true
+}
+
+// ListMyIdentities returns the external accounts linked to the authenticated user
+func ListMyIdentities(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	identities, err := identityRepo.ListUserIdentities(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch linked accounts")
+		return
+	}
+	if identities == nil {
+		identities = []models.UserIdentity{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"identities": identities})
+}
+
+// UnlinkIdentity removes a linked external account, unless it is the only
+// way a user without a password can log in
+func UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	provider, err := identityRepo.UnlinkIdentity(r.Context(), userID, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		apierror.Write(w, r, apierror.NotFound, "No linked account with this ID")
+		return
+	case errors.Is(err, repository.ErrLastLoginMethod):
+		apierror.Write(w, r, apierror.Conflict, "This is the only way to log in to your account")
+		return
+	case err != nil:
+		apierror.Write(w, r, apierror.Internal, "Failed to unlink account")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.IdentityUnlinked, ActorID: userID, TargetID: userID, Reason: provider})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Account unlinked"})
+}
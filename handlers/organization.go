@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Slugs are lowercase words separated by single hyphens, e.g. "acme-corp"
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CreateOrganizationRequest is the body of POST /orgs
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=255"`
+	Slug string `json:"slug" validate:"required,min=2,max=64"`
+}
+
+// UpdateMemberRequest is the body of PATCH /org/members/{userID}
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// InviteMemberRequest is the body of POST /org/invitations
+type InviteMemberRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// CreateOrganization creates an organization owned by the caller
+func CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req CreateOrganizationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{
+			Field:   "slug",
+			Code:    "slug",
+			Message: "slug must be lowercase letters and digits separated by single hyphens",
+		}))
+		return
+	}
+
+	org := models.Organization{Name: strings.TrimSpace(req.Name), Slug: req.Slug}
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	err := orgRepo.CreateOrganization(r.Context(), &org, userID)
+	if errors.Is(err, repository.ErrSlugTaken) {
+		apierror.Write(w, r, apierror.Conflict, "Slug is already taken")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create organization")
+		return
+	}
+
+	fmt.Println("🏢 CreateOrganization: Org", org.ID, "created by user ID", userID)
+	audit.Record(r, audit.Event{Type: audit.OrgCreated, ActorID: userID, TargetID: userID, Reason: strconv.Itoa(org.ID)})
+	writeJSON(w, http.StatusCreated, models.UserOrganization{Organization: org, Role: models.OrgRoleOwner})
+}
+
+// ListMyOrganizations returns the organizations the caller belongs to
+func ListMyOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	orgs, err := orgRepo.ListUserOrganizations(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch organizations")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"organizations": orgs})
+}
+
+// SwitchOrganization makes an organization the active one of the current
+// session and returns an access token carrying it. Later refreshes keep it.
+func SwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(int)
+	orgID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	err := sessionRepo.SetActiveOrg(r.Context(), sessionID, userID, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "Organization not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to switch organization")
+		return
+	}
+
+	accessToken, err := utils.GenerateAccessToken(userID, sessionID, orgID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to generate access token")
+		return
+	}
+	noStore(w)
+	if middleware.CookieAuthenticated(r) {
+		setAccessCookie(w, accessToken)
+		writeJSON(w, http.StatusOK, map[string]string{"csrf_token": utils.CSRFToken(sessionID)})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": accessToken,
+	})
+}
+
+// ListOrgMembers returns the members of the active organization
+func ListOrgMembers(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	members, err := orgRepo.ListMembers(r.Context(), orgID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch members")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"members": members})
+}
+
+// UpdateOrgMember changes the role of a member. Admins manage admins and
+// members; only owners can grant or take away the owner role.
+func UpdateOrgMember(w http.ResponseWriter, r *http.Request) {
+	actorID := r.Context().Value(middleware.UserIDKey).(int)
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+	actorRole := r.Context().Value(middleware.OrgRoleKey).(string)
+	memberID, _ := strconv.Atoi(mux.Vars(r)["userID"])
+
+	var req UpdateMemberRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	membership, err := orgRepo.GetMembership(r.Context(), orgID, memberID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "Member not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to update member")
+		return
+	}
+	if actorRole != models.OrgRoleOwner && (membership.Role == models.OrgRoleOwner || req.Role == models.OrgRoleOwner) {
+		apierror.Write(w, r, apierror.Forbidden, "Only owners can change the owner role")
+		return
+	}
+
+	err = orgRepo.UpdateMemberRole(r.Context(), orgID, memberID, req.Role)
+	if !writeMembershipError(w, r, err, "Failed to update member") {
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.OrgMemberRoleSet, ActorID: actorID, TargetID: memberID, Reason: strconv.Itoa(orgID) + " " + req.Role})
+	membership.Role = req.Role
+	writeJSON(w, http.StatusOK, membership)
+}
+
+// RemoveOrgMember removes a member from the active organization. Owners and
+// admins remove others (admins cannot remove owners); anyone can leave.
+func RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	actorID := r.Context().Value(middleware.UserIDKey).(int)
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+	actorRole := r.Context().Value(middleware.OrgRoleKey).(string)
+	memberID, _ := strconv.Atoi(mux.Vars(r)["userID"])
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	if memberID != actorID {
+		if actorRole != models.OrgRoleOwner && actorRole != models.OrgRoleAdmin {
+			apierror.Write(w, r, apierror.Forbidden, "Only owners and admins can remove other members")
+			return
+		}
+		membership, err := orgRepo.GetMembership(r.Context(), orgID, memberID)
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Write(w, r, apierror.NotFound, "Member not found")
+			return
+		}
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to remove member")
+			return
+		}
+		if membership.Role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner {
+			apierror.Write(w, r, apierror.Forbidden, "Only owners can remove an owner")
+			return
+		}
+	}
+
+	err := orgRepo.RemoveMember(r.Context(), orgID, memberID)
+	if !writeMembershipError(w, r, err, "Failed to remove member") {
+		return
+	}
+
+	fmt.Println("🚪 RemoveOrgMember: User ID", memberID, "left org", orgID)
+	audit.Record(r, audit.Event{Type: audit.OrgMemberRemoved, ActorID: actorID, TargetID: memberID, Reason: strconv.Itoa(orgID)})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
+
+// writeMembershipError writes the problem for a failed membership change and
+// reports whether the change succeeded
+func writeMembershipError(w http.ResponseWriter, r *http.Request, err error, detail string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		apierror.Write(w, r, apierror.NotFound, "Member not found")
+	case errors.Is(err, repository.ErrLastOwner):
+		apierror.Write(w, r, apierror.Conflict, "The organization must keep at least one owner")
+	default:
+		apierror.Write(w, r, apierror.Internal, detail)
+	}
+	return false
+}
+
+// InviteOrgMember emails an invitation to join the active organization
+func InviteOrgMember(w http.ResponseWriter, r *http.Request) {
+	actorID := r.Context().Value(middleware.UserIDKey).(int)
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+	actorRole := r.Context().Value(middleware.OrgRoleKey).(string)
+
+	var req InviteMemberRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner {
+		apierror.Write(w, r, apierror.Forbidden, "Only owners can invite owners")
+		return
+	}
+
+	token, tokenHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create invitation")
+		return
+	}
+
+	ttl := config.Get().Accounts.InvitationTTL
+	inv := models.OrgInvitation{
+		OrgID:     orgID,
+		Email:     strings.TrimSpace(req.Email),
+		Role:      req.Role,
+		TokenHash: tokenHash,
+		InvitedBy: &actorID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	if err := orgRepo.CreateInvitation(r.Context(), &inv); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create invitation")
+		return
+	}
+
+	err = mailer.Send(r.Context(), mailer.Message{
+		To:      inv.Email,
+		Subject: "You are invited to join an organization",
+		Body: fmt.Sprintf("Hi,\n\nYou were invited to join an organization as %s. Sign in or create an account with this address, then open this link within %s to accept:\n\n%s\n\nIf you were not expecting this, ignore this email.\n",
+			inv.Role, ttl, mailer.Link("/invitations/accept?token="+url.QueryEscape(token))),
+	})
+	if err != nil {
+		fmt.Println("❌ Failed to send invitation:", err)
+		apierror.Write(w, r, apierror.Internal, "Failed to send the invitation email")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.OrgMemberInvited, ActorID: actorID, Reason: strconv.Itoa(orgID) + " " + inv.Role})
+	writeJSON(w, http.StatusCreated, inv)
+}
+
+// ListOrgInvitations returns the pending invitations of the active organization
+func ListOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	invitations, err := orgRepo.ListPendingInvitations(r.Context(), orgID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch invitations")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"invitations": invitations})
+}
+
+// AcceptInvitation adds the caller to the organization they were invited to.
+// The invitation must have been sent to the caller's email address.
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req LinkTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound, "User not found")
+		return
+	}
+
+	orgRepo := repository.OrgRepository{DB: database.DB}
+	inv, err := orgRepo.AcceptInvitation(r.Context(), utils.HashLinkToken(req.Token), user.ID, user.Email)
+	switch {
+	case errors.Is(err, repository.ErrInvitationNotFound):
+		apierror.Write(w, r, apierror.InvalidLink, "Invitation link is invalid or has expired")
+		return
+	case errors.Is(err, repository.ErrInvitationEmail):
+		apierror.Write(w, r, apierror.Forbidden, "The invitation was sent to another email address")
+		return
+	case err != nil:
+		apierror.Write(w, r, apierror.Internal, "Failed to accept invitation")
+		return
+	}
+
+	membership, err := orgRepo.GetMembership(r.Context(), inv.OrgID, user.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to accept invitation")
+		return
+	}
+
+	fmt.Println("✅ AcceptInvitation: User ID", user.ID, "joined org", inv.OrgID)
+	audit.Record(r, audit.Event{Type: audit.OrgMemberJoined, ActorID: user.ID, TargetID: user.ID, Reason: strconv.Itoa(inv.OrgID) + " " + membership.Role})
+	writeJSON(w, http.StatusOK, membership)
+}
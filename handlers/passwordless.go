@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const passwordlessCookie = "passwordless_nonce"
+
+// PasswordlessRequest is the body of POST /auth/passwordless
+type PasswordlessRequest struct {
+	Email  string `json:"email" validate:"required,email,max=255"`
+	Method string `json:"method" validate:"oneof=link code"` // link when empty
+}
+
+// PasswordlessVerifyRequest is the body of POST /auth/passwordless/verify:
+// the token of the emailed link, or the emailed code
+type PasswordlessVerifyRequest struct {
+	Token string `json:"token" validate:"max=128"`
+	Code  string `json:"code" validate:"max=6"`
+}
+
+// passwordlessRequested is returned whether or not the account exists, so the
+// endpoint cannot be used to find out which addresses are registered
+var passwordlessRequested = map[string]string{
+	"message": "If an account with this email exists, a login link or code has been sent to it",
+}
+
+// RequestPasswordlessLogin emails a single-use login link or code. It only
+// works in the browser that asked for it: the challenge is bound to a nonce
+// kept in an HttpOnly cookie.
+func RequestPasswordlessLogin(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().Passwordless
+	if !cfg.Enabled {
+		apierror.Write(w, r, apierror.Forbidden, "Passwordless login is disabled")
+		return
+	}
+
+	var req PasswordlessRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	method := req.Method
+	if method == "" {
+		method = models.LoginMethodLink
+	}
+
+	// 🚦 Requests for unknown addresses count too, so throttling tells nothing
+	challengeRepo := repository.LoginChallengeRepository{DB: database.DB}
+	recent, err := challengeRepo.CountLoginChallenges(r.Context(), email, time.Now().Add(-cfg.RequestWindow))
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+	if recent >= cfg.MaxRequests {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "passwordless_throttled"})
+		w.Header().Set("Retry-After", strconv.Itoa(int(cfg.RequestWindow.Seconds())))
+		apierror.Write(w, r, apierror.TooManyRequests, "Too many login emails requested for this address, try again later")
+		return
+	}
+
+	// Deleted accounts in their grace period are reactivated by logging in
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = userRepo.GetDeletedUserByEmail(r.Context(), email)
+		if err == nil && !canReactivate(user) {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.Internal, "Failed to look up account")
+		return
+	}
+	known := err == nil
+
+	nonce, nonceHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+	challenge := models.LoginChallenge{
+		Email:     email,
+		Method:    method,
+		NonceHash: nonceHash,
+		ExpiresAt: time.Now().Add(cfg.TTL),
+	}
+
+	var secret string
+	if known {
+		challenge.UserID = &user.ID
+		if method == models.LoginMethodCode {
+			secret, err = utils.NewLoginCode()
+			challenge.SecretHash = utils.HashLinkToken(nonce + ":" + secret)
+		} else {
+			secret, challenge.SecretHash, err = utils.NewLinkToken()
+		}
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to start login")
+			return
+		}
+	}
+	if err := challengeRepo.CreateLoginChallenge(r.Context(), &challenge); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+
+	if known {
+		body := fmt.Sprintf("Hi %s,\n\nOpen this link within %s, in the browser where you asked for it, to log in:\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.Name, cfg.TTL, mailer.Link("/auth/passwordless/verify?token="+url.QueryEscape(secret)))
+		if method == models.LoginMethodCode {
+			body = fmt.Sprintf("Hi %s,\n\nYour login code is %s. It is valid for %s.\n\nIf you did not ask for this, ignore this email and do not share the code.\n",
+				user.Name, secret, cfg.TTL)
+		}
+		err = mailer.Send(r.Context(), mailer.Message{To: user.Email, Subject: "Your login " + method, Body: body})
+		if err != nil {
+			fmt.Println("❌ Failed to send passwordless login:", err)
+			apierror.Write(w, r, apierror.Internal, "Failed to send the login email")
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordlessCookie,
+		Value:    nonce,
+		Path:     "/v1/auth/passwordless",
+		MaxAge:   int(cfg.TTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.Get().Mail.LinkBaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, http.StatusAccepted, passwordlessRequested)
+}
+
+// VerifyPasswordlessLogin completes a passwordless login with the emailed
+// link token or code and issues the same token pair as LoginUser
+func VerifyPasswordlessLogin(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().Passwordless
+	if !cfg.Enabled {
+		apierror.Write(w, r, apierror.Forbidden, "Passwordless login is disabled")
+		return
+	}
+
+	var req PasswordlessVerifyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if (req.Token == "") == (req.Code == "") {
+		apierror.Write(w, r, apierror.InvalidRequest, "Send either the token of the link or the code")
+		return
+	}
+
+	// A link opened in another browser, or a code typed there, is refused
+	fail := func(reason string) {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: reason})
+		if req.Token != "" {
+			apierror.Write(w, r, apierror.InvalidLink, "Login link is invalid or has expired, or was opened in another browser")
+		} else {
+			apierror.Write(w, r, apierror.InvalidCredentials, "Login code is invalid or has expired")
+		}
+	}
+	cookie, err := r.Cookie(passwordlessCookie)
+	if err != nil || cookie.Value == "" {
+		fail("passwordless_other_browser")
+		return
+	}
+
+	method, secretHash := models.LoginMethodLink, utils.HashLinkToken(req.Token)
+	if req.Code != "" {
+		method, secretHash = models.LoginMethodCode, utils.HashLinkToken(cookie.Value+":"+strings.TrimSpace(req.Code))
+	}
+	challengeRepo := repository.LoginChallengeRepository{DB: database.DB}
+	challenge, err := challengeRepo.ConsumeLoginChallenge(r.Context(), method, utils.HashLinkToken(cookie.Value), secretHash, cfg.MaxAttempts)
+	if errors.Is(err, repository.ErrLoginChallengeInvalid) {
+		fail("passwordless_invalid")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: passwordlessCookie, Path: "/v1/auth/passwordless", MaxAge: -1})
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), *challenge.UserID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+	completeLogin(w, r, user, "passwordless_"+method)
+}
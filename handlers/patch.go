@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/config"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON Merge Patch documents
+const MergePatchContentType = "application/merge-patch+json"
+
+// decodeMergePatch reads a JSON Merge Patch object from the request body with
+// the same size limit and error responses as decodeJSON. Plain
+// application/json is accepted too, for clients that cannot set the media type.
+func decodeMergePatch(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+		apierror.Write(w, r, apierror.UnsupportedMedia, "Content-Type must be "+MergePatchContentType)
+		return nil, false
+	}
+
+	maxBytes := int64(config.Get().Server.MaxBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	var patch interface{}
+	if err := decoder.Decode(&patch); err != nil {
+		writeDecodeError(w, r, err, maxBytes)
+		return nil, false
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		apierror.Write(w, r, apierror.InvalidRequest, "Request body must contain a single JSON object")
+		return nil, false
+	}
+
+	// A non-object patch would replace the whole resource, which is never valid here
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		apierror.Write(w, r, apierror.InvalidRequest, "A merge patch must be a JSON object")
+		return nil, false
+	}
+	return patchObj, true
+}
+
+// applyMergePatch applies an RFC 7396 merge patch to target without modifying it:
+// null removes a member, objects are merged recursively, anything else replaces
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	merged := map[string]interface{}{}
+	if targetObj, ok := target.(map[string]interface{}); ok {
+		for key, value := range targetObj {
+			merged[key] = value
+		}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = applyMergePatch(merged[key], value)
+		}
+	}
+	return merged
+}
+
+// toDocument converts a response struct to the generic form merge patches apply to
+func toDocument(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// etagFor builds a strong entity tag from a resource's ID and version
+func etagFor(id, version int) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// checkIfMatch requires an If-Match header matching the current ETag (strong
+// comparison, RFC 9110), writing 428 when it is missing and 412 when it is stale
+func checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		apierror.Write(w, r, apierror.PreconditionNeeded, "If-Match header is required; send the ETag of the version being modified")
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	apierror.Write(w, r, apierror.PreconditionFailed, "Resource has been modified since it was read; fetch it again and reapply the changes")
+	return false
+}
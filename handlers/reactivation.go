@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ReactivationRequest is the body of POST /reactivation
+type ReactivationRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// canReactivate reports whether a deleted account is still within its grace
+// period. Users only reactivate accounts they deleted themselves: those
+// deactivated by an operator stay so, and accounts managed by an identity
+// provider are only reactivated by it.
+func canReactivate(user models.User) bool {
+	if user.DeletedAt == nil || user.PurgedAt != nil || user.ManagedBySCIM || user.DeactivatedBy != models.DeactivatedBySelf {
+		return false
+	}
+	return time.Since(*user.DeletedAt) <= config.Get().Accounts.DeletionGracePeriod
+}
+
+// reactivationRequested is returned whether or not the account exists, so the
+// endpoint cannot be used to find out which addresses are registered
+var reactivationRequested = map[string]string{
+	"message": "If a deleted account with this email can be reactivated, a link has been sent to it",
+}
+
+// RequestReactivation emails a reactivation link to a deleted account still in its grace period
+func RequestReactivation(w http.ResponseWriter, r *http.Request) {
+	var req ReactivationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetDeletedUserByEmail(r.Context(), strings.TrimSpace(req.Email))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.Internal, "Failed to look up account")
+		return
+	}
+	if err != nil || !canReactivate(user) {
+		writeJSON(w, http.StatusAccepted, reactivationRequested)
+		return
+	}
+
+	token, tokenHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create reactivation link")
+		return
+	}
+	ttl := config.Get().Accounts.ReactivationLinkTTL
+	tokenRepo := repository.ActionTokenRepository{DB: database.DB}
+	err = tokenRepo.CreateActionToken(r.Context(), &models.ActionToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeReactivate,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create reactivation link")
+		return
+	}
+
+	err = mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reactivate your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was deleted on %s. Open this link within %s to reactivate it:\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.Name, user.DeletedAt.Format("2 January 2006"), ttl, mailer.Link("/reactivation/confirm?token="+url.QueryEscape(token))),
+	})
+	if err != nil {
+		fmt.Println("❌ Failed to send reactivation link:", err)
+		apierror.Write(w, r, apierror.Internal, "Failed to send the reactivation email")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, reactivationRequested)
+}
+
+// ConfirmReactivation reactivates the account from an emailed link
+func ConfirmReactivation(w http.ResponseWriter, r *http.Request) {
+	var req LinkTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	tokenRepo := repository.ActionTokenRepository{DB: database.DB}
+	token, err := tokenRepo.ConsumeActionToken(r.Context(), models.TokenPurposeReactivate, utils.HashLinkToken(req.Token))
+	if errors.Is(err, repository.ErrActionTokenInvalid) {
+		apierror.Write(w, r, apierror.InvalidLink, "Reactivation link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to reactivate account")
+		return
+	}
+
+	// The grace period may have ended, or an operator deactivated the account, since the link was sent
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), token.UserID)
+	if err == nil && user.DeletedAt != nil && user.DeactivatedBy != models.DeactivatedBySelf {
+		audit.Record(r, audit.Event{Type: audit.UserReactivated, TargetID: user.ID, Outcome: audit.Failure, Reason: "account_deactivated"})
+		apierror.Write(w, r, apierror.AccountDeactivated, "Account was deactivated by an administrator. Contact support.")
+		return
+	}
+	if err != nil || (user.DeletedAt != nil && !canReactivate(user)) {
+		apierror.Write(w, r, apierror.InvalidLink, "Reactivation link is invalid or has expired")
+		return
+	}
+	if user.DeletedAt != nil {
+		if err := userRepo.RestoreUser(r.Context(), user.ID); err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to reactivate account")
+			return
+		}
+	}
+
+	fmt.Println("♻️ ConfirmReactivation: Reactivated user ID", user.ID)
+	audit.Record(r, audit.Event{Type: audit.UserReactivated, TargetID: user.ID, Reason: "link"})
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Account reactivated, you can log in again",
+	})
+}
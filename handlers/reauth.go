@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/middleware"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"time"
+)
+
+// reauthenticate makes sure the caller of a sensitive action is the user and
+// not just someone holding their access token. Users with a password must
+// send it. Users without one (federated, directory, SCIM or passwordless
+// logins) must have logged in within ACCOUNT_REAUTH_WINDOW. Otherwise it
+// writes the error response, records a failed event of the given type
+// (unless empty) and returns false.
+func reauthenticate(w http.ResponseWriter, r *http.Request, password string, event audit.Type) bool {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	fail := func(kind apierror.Kind, reason, detail string) bool {
+		if event != "" {
+			audit.Record(r, audit.Event{Type: event, ActorID: userID, TargetID: userID, Outcome: audit.Failure, Reason: reason})
+		}
+		apierror.Write(w, r, kind, detail)
+		return false
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	hashedPassword, err := userRepo.GetUserPasswordByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to verify your identity")
+		return false
+	}
+	if hashedPassword != "" {
+		if !utils.CheckPasswordHash(r.Context(), password, hashedPassword) {
+			return fail(apierror.InvalidCredentials, "incorrect_password", "Incorrect password")
+		}
+		return true
+	}
+
+	window := config.Get().Accounts.ReauthWindow
+	sessionID := r.Context().Value(middleware.SessionIDKey).(int)
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	loggedInAt, err := sessionRepo.SessionCreatedAt(r.Context(), sessionID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.Internal, "Failed to verify your identity")
+		return false
+	}
+	if err != nil || time.Since(loggedInAt) > window {
+		return fail(apierror.ReauthRequired, "reauthentication_required",
+			fmt.Sprintf("Your account has no password: log in again, then retry within %s", window))
+	}
+	return true
+}
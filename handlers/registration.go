@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateInviteCodeRequest is the body of POST /admin/invite-codes
+type CreateInviteCodeRequest struct {
+	Email     string     `json:"email" validate:"email,max=255"` // Binds the code to this address
+	ExpiresAt *time.Time `json:"expires_at"`                     // Never expires when omitted
+}
+
+// CreatedInviteCode is returned once, on creation: it is the only time the code is shown
+type CreatedInviteCode struct {
+	models.InviteCode
+	Code string `json:"code"`
+}
+
+// CreateInviteCode issues a single-use registration code
+func CreateInviteCode(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req CreateInviteCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{Field: "expires_at", Code: "past", Message: "expires_at must be in the future"}))
+		return
+	}
+
+	code, codeHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create invite code")
+		return
+	}
+	invite := models.InviteCode{CodeHash: codeHash, CreatedBy: &adminID, ExpiresAt: req.ExpiresAt}
+	if email := strings.TrimSpace(req.Email); email != "" {
+		invite.Email = &email
+	}
+
+	inviteRepo := repository.InviteRepository{DB: database.DB}
+	if err := inviteRepo.CreateInvite(r.Context(), &invite); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create invite code")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.InviteCodeCreated, ActorID: adminID, Reason: strconv.Itoa(invite.ID)})
+	writeJSON(w, http.StatusCreated, CreatedInviteCode{InviteCode: invite, Code: code})
+}
+
+// ListInviteCodes returns every invite code with its state, without the codes themselves
+func ListInviteCodes(w http.ResponseWriter, r *http.Request) {
+	inviteRepo := repository.InviteRepository{DB: database.DB}
+	invites, err := inviteRepo.ListInvites(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch invite codes")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"invite_codes": invites})
+}
+
+// RevokeInviteCode makes an unused invite code unusable
+func RevokeInviteCode(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	inviteRepo := repository.InviteRepository{DB: database.DB}
+	err := inviteRepo.RevokeInvite(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "No unused invite code with this ID")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to revoke invite code")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.InviteCodeRevoked, ActorID: adminID, Reason: strconv.Itoa(id)})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Invite code revoked"})
+}
+
+// ListPendingRegistrations returns the approval queue
+func ListPendingRegistrations(w http.ResponseWriter, r *http.Request) {
+	userRepo := repository.UserRepository{DB: database.DB}
+	users, err := userRepo.ListPendingUsers(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch pending registrations")
+		return
+	}
+
+	userResponses := []UserResponse{}
+	for _, user := range users {
+		userResponses = append(userResponses, UserResponse{ID: user.ID, Name: user.Name, Email: user.Email})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": userResponses})
+}
+
+// ApproveRegistration lets a pending account log in
+func ApproveRegistration(w http.ResponseWriter, r *http.Request) {
+	decideRegistration(w, r, models.UserStatusApproved)
+}
+
+// RejectRegistration refuses a pending account; it can never log in
+func RejectRegistration(w http.ResponseWriter, r *http.Request) {
+	decideRegistration(w, r, models.UserStatusRejected)
+}
+
+func decideRegistration(w http.ResponseWriter, r *http.Request, status string) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int)
+	userID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	err := userRepo.DecideRegistration(r.Context(), userID, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound, "No pending registration for this user")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to update registration")
+		return
+	}
+
+	eventType := audit.UserApproved
+	message := mailer.Message{
+		Subject: "Your account has been approved",
+		Body:    "Your account has been approved. You can now log in:\n\n" + mailer.Link("/login") + "\n",
+	}
+	if status == models.UserStatusRejected {
+		eventType = audit.UserRejected
+		message = mailer.Message{
+			Subject: "Your registration was not approved",
+			Body:    "Your registration was reviewed and not approved.\n",
+		}
+	}
+	audit.Record(r, audit.Event{Type: eventType, ActorID: adminID, TargetID: userID})
+
+	// The decision stands even if the notification cannot be sent
+	if user, err := userRepo.GetUserByID(r.Context(), userID); err == nil {
+		message.To = user.Email
+		message.Body = "Hi " + user.Name + ",\n\n" + message.Body
+		if err := mailer.Send(r.Context(), message); err != nil {
+			fmt.Println("❌ Failed to send registration decision:", err)
+		}
+	}
+
+	fmt.Println("🛂 Registration of user ID", userID, "set to", status)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Registration " + status})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/federation"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/utils"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// samlRelayStateCookie binds a login to the browser that started it, like
+// the OIDC state cookie. It is SameSite=None: the identity provider posts the
+// response cross-site, and browsers leave Lax cookies out of such POSTs.
+const samlRelayStateCookie = "saml_relay_state"
+
+// ListSAMLIdentityProviders returns the names of the SAML identity providers users can log in with
+func ListSAMLIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, idp := range config.Get().SAML.IdentityProviders {
+		names = append(names, idp.Name)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"identity_providers": names})
+}
+
+// samlProvider returns the identity provider in the URL, or writes the error response
+func samlProvider(w http.ResponseWriter, r *http.Request) (*federation.SAMLProvider, bool) {
+	provider, err := federation.GetSAML(r.Context(), mux.Vars(r)["idp"])
+	if errors.Is(err, federation.ErrUnknownProvider) {
+		apierror.Write(w, r, apierror.NotFound, "Unknown identity provider")
+		return nil, false
+	}
+	if err != nil {
+		fmt.Println("❌ samlProvider:", err)
+		apierror.Write(w, r, apierror.Internal, "Identity provider is unavailable")
+		return nil, false
+	}
+	return provider, true
+}
+
+// SAMLMetadata returns the service provider metadata to register at the identity provider
+func SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	provider, ok := samlProvider(w, r)
+	if !ok {
+		return
+	}
+	metadata, err := provider.Metadata()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to build metadata")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// LoginSAML redirects the browser to the identity provider with an AuthnRequest
+func LoginSAML(w http.ResponseWriter, r *http.Request) {
+	provider, ok := samlProvider(w, r)
+	if !ok {
+		return
+	}
+
+	relayState, relayStateHash, err := utils.NewLinkToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+	redirect, requestID, err := provider.AuthnRequestURL(relayState)
+	if err != nil {
+		fmt.Println("❌ LoginSAML:", provider.Name, err)
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	request := models.SAMLRequest{
+		RelayStateHash: relayStateHash,
+		IdP:            provider.Name,
+		RequestID:      requestID,
+		ExpiresAt:      time.Now().Add(config.Get().SAML.RequestTTL),
+	}
+	if err := identityRepo.CreateSAMLRequest(r.Context(), &request); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to start login")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     samlRelayStateCookie,
+		Value:    relayState,
+		Path:     "/v1/auth/saml/" + provider.Name,
+		MaxAge:   int(config.Get().SAML.RequestTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true, // required for SameSite=None
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// SAMLAssertionConsumer receives the identity provider's response (HTTP-POST
+// binding) and issues our own token pair. The relay state finds the login it
+// answers and must match the browser's cookie; the user is matched like a
+// federated login.
+func SAMLAssertionConsumer(w http.ResponseWriter, r *http.Request) {
+	provider, ok := samlProvider(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest, "Invalid form body")
+		return
+	}
+
+	// The relay state is single-use, whatever happens next. A login started
+	// here must come back to the same browser, or an attacker could post
+	// their own assertion and log the victim into their account (login CSRF).
+	http.SetCookie(w, &http.Cookie{Name: samlRelayStateCookie, Path: "/v1/auth/saml/" + provider.Name, MaxAge: -1, Secure: true, SameSite: http.SameSiteNoneMode})
+	var requestIDs []string
+	identityRepo := repository.IdentityRepository{DB: database.DB}
+	if relayState := r.PostForm.Get("RelayState"); relayState != "" {
+		request, err := identityRepo.ConsumeSAMLRequest(r.Context(), provider.Name, utils.HashLinkToken(relayState))
+		if err == nil {
+			cookie, err := r.Cookie(samlRelayStateCookie)
+			if err != nil || cookie.Value != relayState {
+				audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "state_mismatch"})
+				apierror.Write(w, r, apierror.FederatedLogin, "Login was not started from this browser")
+				return
+			}
+			requestIDs = []string{request.RequestID}
+		} else if !errors.Is(err, repository.ErrLoginStateInvalid) {
+			apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+			return
+		}
+	}
+	if requestIDs == nil && !provider.AllowsIdPInitiated() {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "invalid_state"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Login expired or was already completed, please start again")
+		return
+	}
+
+	login, err := provider.ParseResponse(r, requestIDs)
+	if err != nil {
+		fmt.Println("❌ SAMLAssertionConsumer:", provider.Name, err)
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "invalid_assertion"})
+		apierror.Write(w, r, apierror.FederatedLogin, "Identity provider did not confirm the login")
+		return
+	}
+	err = identityRepo.UseAssertion(r.Context(), provider.Name, login.AssertionID, login.ExpiresAt)
+	if errors.Is(err, repository.ErrAssertionReplayed) {
+		audit.Record(r, audit.Event{Type: audit.UserLogin, Outcome: audit.Failure, Reason: "assertion_replayed"})
+		apierror.Write(w, r, apierror.FederatedLogin, "This assertion was already used")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+
+	providerName := "saml:" + provider.Name
+	userID, ok := resolveIdentity(w, r, providerName, login.Identity, nil)
+	if !ok {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to complete login")
+		return
+	}
+	completeLogin(w, r, user, providerName)
+}
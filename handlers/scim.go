@@ -0,0 +1,946 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/audit"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/scim"
+	"go-auth-app/utils"
+	"go-auth-app/validation"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// scimPrefix is where the SCIM endpoints are mounted; resource locations are relative to the API root
+const scimPrefix = "/scim/v2"
+
+// scimError is a SCIM error found while applying a request, written by the handler
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+func badSCIMValue(format string, args ...interface{}) *scimError {
+	return &scimError{http.StatusBadRequest, scim.InvalidValue, fmt.Sprintf(format, args...)}
+}
+
+// writeSCIMError writes err if it is a *scimError, or a 500 otherwise
+func writeSCIMError(w http.ResponseWriter, err error, internalDetail string) {
+	var scimErr *scimError
+	if errors.As(err, &scimErr) {
+		scim.WriteError(w, scimErr.status, scimErr.scimType, scimErr.detail)
+		return
+	}
+	fmt.Println("❌ SCIM:", internalDetail+":", err)
+	scim.WriteError(w, http.StatusInternalServerError, "", internalDetail)
+}
+
+// decodeSCIM reads a SCIM request body into dst. Unlike decodeJSON it
+// accepts unknown attributes, since identity providers send extension
+// schemas we do not store.
+func decodeSCIM(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != scim.ContentType && mediaType != "application/json") {
+		scim.WriteError(w, http.StatusUnsupportedMediaType, "", "Content-Type must be application/scim+json")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(config.Get().Server.MaxBodyBytes))
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		scim.WriteError(w, http.StatusBadRequest, scim.InvalidSyntax, "Request body is not a valid SCIM resource: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// scimID reads the numeric resource ID from the path; unknown IDs are a 404 like missing resources
+func scimID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		scim.WriteError(w, http.StatusNotFound, "", "Resource "+mux.Vars(r)["id"]+" not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// ServiceProviderConfig tells identity providers which SCIM features we support
+func ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+	scim.Write(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scim.MaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token configured as SCIM_TOKEN",
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": scimPrefix + "/ServiceProviderConfig"},
+	})
+}
+
+// toSCIMUser converts a user; groups is nil in list responses
+func toSCIMUser(user models.User, groups []models.Group) scim.User {
+	active := !user.IsDeleted
+	location := fmt.Sprintf("%s/Users/%d", scimPrefix, user.ID)
+	resource := scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          strconv.Itoa(user.ID),
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		Name:        &scim.Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			LastModified: user.UpdatedAt,
+			Version:      fmt.Sprintf(`W/"%d"`, user.Version),
+			Location:     location,
+		},
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, scim.GroupRef{
+			Value:   strconv.Itoa(group.ID),
+			Display: group.DisplayName,
+			Ref:     fmt.Sprintf("%s/Groups/%d", scimPrefix, group.ID),
+		})
+	}
+	return resource
+}
+
+// writeSCIMUser reloads a user and sends it with its groups
+func writeSCIMUser(w http.ResponseWriter, r *http.Request, status int, userID int) {
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err == nil && user.PurgedAt != nil {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("User %d not found", userID))
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch user")
+		return
+	}
+
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	groups, err := groupRepo.ListUserGroups(r.Context(), userID)
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch user")
+		return
+	}
+
+	if status == http.StatusCreated {
+		w.Header().Set("Location", fmt.Sprintf("%s/Users/%d", scimPrefix, userID))
+	}
+	scim.Write(w, status, toSCIMUser(user, groups))
+}
+
+// ListSCIMUsers returns a page of users, deactivated ones included. Identity
+// providers look users up with filter=userName eq "...".
+func ListSCIMUsers(w http.ResponseWriter, r *http.Request) {
+	filter, err := scim.ParseFilter(r.URL.Query().Get("filter"), "userName", "externalId")
+	if err != nil {
+		scim.WriteError(w, http.StatusBadRequest, scim.InvalidFilter, err.Error())
+		return
+	}
+	var userName, externalID string
+	if filter != nil && filter.Attribute == "userName" {
+		userName = filter.Value
+	}
+	if filter != nil && filter.Attribute == "externalId" {
+		externalID = filter.Value
+	}
+	startIndex, count := scim.Page(r)
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	users, total, err := userRepo.ListProvisionedUsers(r.Context(), userName, externalID, count, startIndex-1)
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch users")
+		return
+	}
+
+	resources := []scim.User{}
+	for _, user := range users {
+		resources = append(resources, toSCIMUser(user, nil))
+	}
+	scim.Write(w, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// GetSCIMUser returns a single user
+func GetSCIMUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	writeSCIMUser(w, r, http.StatusOK, userID)
+}
+
+// provisionedUser is the state of a user as the identity provider sees it
+type provisionedUser struct {
+	Name       string
+	Email      string
+	ExternalID string
+	Active     bool
+}
+
+// fromSCIMUser reads the attributes we store from a POST or PUT body
+func fromSCIMUser(resource scim.User) (provisionedUser, error) {
+	state := provisionedUser{
+		Name:       strings.TrimSpace(resource.FullName()),
+		Email:      strings.TrimSpace(resource.UserName),
+		ExternalID: resource.ExternalID,
+		Active:     resource.Active == nil || *resource.Active,
+	}
+	return state, state.validate()
+}
+
+// validate checks the attributes with the same rules as registration
+func (state provisionedUser) validate() error {
+	fieldErrors := validation.Struct(struct {
+		UserName   string `json:"userName" validate:"required,email,max=255"`
+		Name       string `json:"name" validate:"required,max=255"`
+		ExternalID string `json:"externalId" validate:"max=255"`
+	}{state.Email, state.Name, state.ExternalID})
+	if len(fieldErrors) > 0 {
+		return badSCIMValue("%s", fieldErrors[0].Message)
+	}
+	return nil
+}
+
+// CreateSCIMUser provisions a user. Users without a password can only sign
+// in through the identity provider's other integrations, not with /login.
+func CreateSCIMUser(w http.ResponseWriter, r *http.Request) {
+	var resource scim.User
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	state, err := fromSCIMUser(resource)
+	if err != nil {
+		writeSCIMError(w, err, "")
+		return
+	}
+
+	user := models.User{Name: state.Name, Email: state.Email, ExternalID: state.ExternalID, ManagedBySCIM: true}
+	if resource.Password != "" {
+		if len(resource.Password) < 6 || len(resource.Password) > 72 {
+			writeSCIMError(w, badSCIMValue("password must be between 6 and 72 characters"), "")
+			return
+		}
+		if user.Password, err = utils.HashPassword(r.Context(), resource.Password); err != nil {
+			writeSCIMError(w, err, "Failed to create user")
+			return
+		}
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	err = userRepo.CreateUser(r.Context(), &user)
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		scim.WriteError(w, http.StatusConflict, scim.Uniqueness, "userName is already in use")
+		return
+	case errors.Is(err, repository.ErrExternalIDTaken):
+		scim.WriteError(w, http.StatusConflict, scim.Uniqueness, "externalId is already in use")
+		return
+	case err != nil:
+		writeSCIMError(w, err, "Failed to create user")
+		return
+	}
+	fmt.Println("🪪 SCIM: Provisioned user ID", user.ID)
+	audit.Record(r, audit.Event{Type: audit.SCIMUserCreated, TargetID: user.ID})
+
+	// Users can be provisioned already deactivated
+	if !state.Active {
+		if err := setProvisionedUserActive(r, user.ID, false); err != nil {
+			writeSCIMError(w, err, "Failed to deactivate user")
+			return
+		}
+	}
+
+	writeSCIMUser(w, r, http.StatusCreated, user.ID)
+}
+
+// ReplaceSCIMUser overwrites a user with the identity provider's copy
+func ReplaceSCIMUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	var resource scim.User
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	replacement, err := fromSCIMUser(resource)
+	if err != nil {
+		writeSCIMError(w, err, "")
+		return
+	}
+
+	if updateSCIMUser(w, r, userID, func(state *provisionedUser) error {
+		*state = replacement
+		return nil
+	}) {
+		writeSCIMUser(w, r, http.StatusOK, userID)
+	}
+}
+
+// PatchSCIMUser applies add, replace and remove operations to a user.
+// Setting active to false soft-deletes the account and signs it out
+// everywhere; setting it back to true restores it.
+func PatchSCIMUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	var patch scim.PatchRequest
+	if !decodeSCIM(w, r, &patch) {
+		return
+	}
+
+	if updateSCIMUser(w, r, userID, func(state *provisionedUser) error {
+		return applyUserPatch(state, patch.Operations)
+	}) {
+		writeSCIMUser(w, r, http.StatusOK, userID)
+	}
+}
+
+// DeleteSCIMUser deprovisions a user. Like active=false it is a soft delete:
+// the purge job removes the account once its retention period is over.
+func DeleteSCIMUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+
+	if updateSCIMUser(w, r, userID, func(state *provisionedUser) error {
+		state.Active = false
+		return nil
+	}) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// updateSCIMUser loads the user, lets apply change its state, then saves the
+// attributes and the active flag. On failure it writes the error and returns false.
+func updateSCIMUser(w http.ResponseWriter, r *http.Request, userID int, apply func(*provisionedUser) error) bool {
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err == nil && user.PurgedAt != nil {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("User %d not found", userID))
+		return false
+	}
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch user")
+		return false
+	}
+
+	before := provisionedUser{Name: user.Name, Email: user.Email, ExternalID: user.ExternalID, Active: !user.IsDeleted}
+	state := before
+	if err := apply(&state); err != nil {
+		writeSCIMError(w, err, "Failed to update user")
+		return false
+	}
+	if err := state.validate(); err != nil {
+		writeSCIMError(w, err, "")
+		return false
+	}
+
+	// Saving also marks the account as managed by the identity provider, so
+	// it cannot reactivate itself once deactivated
+	user.Name, user.Email, user.ExternalID = state.Name, state.Email, state.ExternalID
+	err = userRepo.UpdateProvisionedUser(r.Context(), &user)
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		scim.WriteError(w, http.StatusConflict, scim.Uniqueness, "userName is already in use")
+		return false
+	case errors.Is(err, repository.ErrExternalIDTaken):
+		scim.WriteError(w, http.StatusConflict, scim.Uniqueness, "externalId is already in use")
+		return false
+	case err != nil:
+		writeSCIMError(w, err, "Failed to update user")
+		return false
+	}
+	if state.Name != before.Name || state.Email != before.Email || state.ExternalID != before.ExternalID {
+		audit.Record(r, audit.Event{Type: audit.SCIMUserUpdated, TargetID: userID})
+	}
+
+	if state.Active != before.Active {
+		if err := setProvisionedUserActive(r, userID, state.Active); err != nil {
+			writeSCIMError(w, err, "Failed to update user")
+			return false
+		}
+	}
+	return true
+}
+
+// setProvisionedUserActive maps the SCIM active flag onto soft deletion:
+// deactivated users are signed out everywhere
+func setProvisionedUserActive(r *http.Request, userID int, active bool) error {
+	userRepo := repository.UserRepository{DB: database.DB}
+	if active {
+		if err := userRepo.RestoreUser(r.Context(), userID); err != nil {
+			return err
+		}
+		fmt.Println("♻️ SCIM: Reactivated user ID", userID)
+		audit.Record(r, audit.Event{Type: audit.SCIMUserReactivated, TargetID: userID})
+		return nil
+	}
+
+	if err := userRepo.SoftDeleteUser(r.Context(), userID, models.DeactivatedBySCIM); err != nil {
+		return err
+	}
+	fmt.Println("🗑️ SCIM: Deactivated user ID", userID)
+	audit.Record(r, audit.Event{Type: audit.SCIMUserDeactivated, TargetID: userID})
+	return nil
+}
+
+// applyUserPatch applies PATCH operations to a user's state. Attributes we
+// do not store (extension schemas, phone numbers...) are ignored, since
+// identity providers send them regardless of what the service supports.
+func applyUserPatch(state *provisionedUser, operations []scim.PatchOperation) error {
+	var givenName, familyName string
+	nameSet := false
+
+	var set func(attribute string, value json.RawMessage) error
+	set = func(attribute string, value json.RawMessage) error {
+		var err error
+		switch attribute = strings.ToLower(attribute); {
+		case attribute == "active":
+			state.Active, err = scim.BoolValue(value)
+		case attribute == "username":
+			state.Email, err = scim.StringValue(value)
+		case attribute == "externalid":
+			state.ExternalID, err = scim.StringValue(value)
+		case attribute == "displayname" || attribute == "name.formatted":
+			state.Name, err = scim.StringValue(value)
+			nameSet = true
+		case attribute == "name.givenname":
+			givenName, err = scim.StringValue(value)
+		case attribute == "name.familyname":
+			familyName, err = scim.StringValue(value)
+		case attribute == "name":
+			var name scim.Name
+			if err = json.Unmarshal(value, &name); err == nil {
+				givenName, familyName = name.GivenName, name.FamilyName
+				if name.Formatted != "" {
+					state.Name, nameSet = name.Formatted, true
+				}
+			}
+		case attribute == "emails" || strings.HasPrefix(attribute, "emails["):
+			state.Email, err = primaryEmail(value)
+		}
+		if err != nil {
+			return badSCIMValue("%s: %v", attribute, err)
+		}
+		return nil
+	}
+
+	for _, operation := range operations {
+		switch op := strings.ToLower(operation.Op); {
+		case op == "remove" && operation.Path == "":
+			return &scimError{http.StatusBadRequest, scim.NoTarget, "remove requires a path"}
+		case op == "remove":
+			// Only optional attributes can be removed
+			if !strings.EqualFold(operation.Path, "externalId") {
+				return &scimError{http.StatusBadRequest, scim.Mutability, operation.Path + " cannot be removed"}
+			}
+			state.ExternalID = ""
+		case (op == "add" || op == "replace") && operation.Path == "":
+			// No path: the value is an object of attributes to set
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return badSCIMValue("value must be an object of attributes when no path is given")
+			}
+			for attribute, value := range attributes {
+				if err := set(attribute, value); err != nil {
+					return err
+				}
+			}
+		case op == "add" || op == "replace":
+			if err := set(operation.Path, operation.Value); err != nil {
+				return err
+			}
+		default:
+			return &scimError{http.StatusBadRequest, scim.InvalidSyntax, "Unsupported operation " + operation.Op}
+		}
+	}
+
+	// Some identity providers only send the parts of the name
+	if !nameSet && (givenName != "" || familyName != "") {
+		state.Name = strings.TrimSpace(givenName + " " + familyName)
+	}
+	state.Name, state.Email = strings.TrimSpace(state.Name), strings.TrimSpace(state.Email)
+	return nil
+}
+
+// primaryEmail reads an emails value: a list of addresses, a single one, or
+// just the address (when the path selects the value of one)
+func primaryEmail(value json.RawMessage) (string, error) {
+	var emails []scim.Email
+	if err := json.Unmarshal(value, &emails); err != nil {
+		var email scim.Email
+		if err := json.Unmarshal(value, &email); err != nil {
+			return scim.StringValue(value)
+		}
+		emails = []scim.Email{email}
+	}
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value, nil
+		}
+	}
+	if len(emails) == 0 {
+		return "", errors.New("at least one email is required")
+	}
+	return emails[0].Value, nil
+}
+
+// toSCIMGroup converts a group; members is nil when they were excluded
+func toSCIMGroup(group models.Group, members []models.GroupMember) scim.Group {
+	resource := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          strconv.Itoa(group.ID),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []scim.Member{},
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     fmt.Sprintf("%s/Groups/%d", scimPrefix, group.ID),
+		},
+	}
+	for _, member := range members {
+		resource.Members = append(resource.Members, scim.Member{
+			Value:   strconv.Itoa(member.UserID),
+			Display: member.Name,
+			Ref:     fmt.Sprintf("%s/Users/%d", scimPrefix, member.UserID),
+		})
+	}
+	return resource
+}
+
+// excludesMembers reports whether the client asked to leave members out,
+// which identity providers do to avoid fetching large groups
+func excludesMembers(r *http.Request) bool {
+	for _, attribute := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSCIMGroup reloads a group and sends it with its members
+func writeSCIMGroup(w http.ResponseWriter, r *http.Request, status int, groupID int) {
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	group, err := groupRepo.GetGroup(r.Context(), groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("Group %d not found", groupID))
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch group")
+		return
+	}
+
+	var members []models.GroupMember
+	if !excludesMembers(r) {
+		if members, err = groupRepo.ListGroupMembers(r.Context(), group.DisplayName); err != nil {
+			writeSCIMError(w, err, "Failed to fetch group")
+			return
+		}
+	}
+
+	if status == http.StatusCreated {
+		w.Header().Set("Location", fmt.Sprintf("%s/Groups/%d", scimPrefix, groupID))
+	}
+	scim.Write(w, status, toSCIMGroup(group, members))
+}
+
+// ListSCIMGroups returns a page of groups, optionally filtered with displayName eq "..."
+func ListSCIMGroups(w http.ResponseWriter, r *http.Request) {
+	filter, err := scim.ParseFilter(r.URL.Query().Get("filter"), "displayName")
+	if err != nil {
+		scim.WriteError(w, http.StatusBadRequest, scim.InvalidFilter, err.Error())
+		return
+	}
+	var displayName string
+	if filter != nil {
+		displayName = filter.Value
+	}
+	startIndex, count := scim.Page(r)
+
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	groups, total, err := groupRepo.ListGroups(r.Context(), displayName, count, startIndex-1)
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch groups")
+		return
+	}
+
+	resources := []scim.Group{}
+	for _, group := range groups {
+		var members []models.GroupMember
+		if !excludesMembers(r) {
+			if members, err = groupRepo.ListGroupMembers(r.Context(), group.DisplayName); err != nil {
+				writeSCIMError(w, err, "Failed to fetch groups")
+				return
+			}
+		}
+		resources = append(resources, toSCIMGroup(group, members))
+	}
+	scim.Write(w, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// GetSCIMGroup returns a single group
+func GetSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+	writeSCIMGroup(w, r, http.StatusOK, groupID)
+}
+
+// provisionedGroup is the state of a group as the identity provider sees it
+type provisionedGroup struct {
+	DisplayName string
+	ExternalID  string
+	MemberIDs   []int
+}
+
+// validate checks the display name, which is also the role name
+func (state provisionedGroup) validate() error {
+	fieldErrors := validation.Struct(struct {
+		DisplayName string `json:"displayName" validate:"required,max=50"`
+		ExternalID  string `json:"externalId" validate:"max=255"`
+	}{state.DisplayName, state.ExternalID})
+	if len(fieldErrors) > 0 {
+		return badSCIMValue("%s", fieldErrors[0].Message)
+	}
+	return nil
+}
+
+// add adds the users that are not members yet
+func (state *provisionedGroup) add(userIDs []int) {
+	for _, userID := range userIDs {
+		if !slices.Contains(state.MemberIDs, userID) {
+			state.MemberIDs = append(state.MemberIDs, userID)
+		}
+	}
+}
+
+// remove removes the users from the members
+func (state *provisionedGroup) remove(userIDs []int) {
+	state.MemberIDs = slices.DeleteFunc(state.MemberIDs, func(userID int) bool {
+		return slices.Contains(userIDs, userID)
+	})
+}
+
+// memberIDs reads a members value: a list of members or a single one
+func memberIDs(value json.RawMessage) ([]int, error) {
+	var members []scim.Member
+	if err := json.Unmarshal(value, &members); err != nil {
+		var member scim.Member
+		if err := json.Unmarshal(value, &member); err != nil {
+			return nil, badSCIMValue("members must be a list of {\"value\": \"<user id>\"}")
+		}
+		members = []scim.Member{member}
+	}
+	return memberValues(members)
+}
+
+// memberValues returns the distinct user IDs of members
+func memberValues(members []scim.Member) ([]int, error) {
+	ids := []int{}
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, badSCIMValue("member %q is not a user ID", member.Value)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// CreateSCIMGroup creates a group, granting its role to the members. A group
+// named after an existing role (such as admin) takes over that role: users
+// who already hold it show up as members.
+func CreateSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var resource scim.Group
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	ids, err := memberValues(resource.Members)
+	if err != nil {
+		writeSCIMError(w, err, "")
+		return
+	}
+	state := provisionedGroup{DisplayName: strings.TrimSpace(resource.DisplayName), ExternalID: resource.ExternalID, MemberIDs: ids}
+	if err := state.validate(); err != nil {
+		writeSCIMError(w, err, "")
+		return
+	}
+
+	group := models.Group{DisplayName: state.DisplayName, ExternalID: state.ExternalID}
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	err = groupRepo.CreateGroup(r.Context(), &group, state.MemberIDs)
+	if !writeGroupSaveError(w, err) {
+		return
+	}
+
+	fmt.Println("👥 SCIM: Created group", group.DisplayName)
+	audit.Record(r, audit.Event{Type: audit.SCIMGroupCreated, Reason: group.DisplayName})
+	writeSCIMGroup(w, r, http.StatusCreated, group.ID)
+}
+
+// ReplaceSCIMGroup overwrites a group, members included
+func ReplaceSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var resource scim.Group
+	if !decodeSCIM(w, r, &resource) {
+		return
+	}
+	updateSCIMGroup(w, r, func(state *provisionedGroup) error {
+		ids, err := memberValues(resource.Members)
+		if err != nil {
+			return err
+		}
+		*state = provisionedGroup{DisplayName: strings.TrimSpace(resource.DisplayName), ExternalID: resource.ExternalID, MemberIDs: ids}
+		return nil
+	})
+}
+
+// PatchSCIMGroup applies add, replace and remove operations to a group,
+// typically to add or remove members
+func PatchSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	var patch scim.PatchRequest
+	if !decodeSCIM(w, r, &patch) {
+		return
+	}
+	updateSCIMGroup(w, r, func(state *provisionedGroup) error {
+		return applyGroupPatch(state, patch.Operations)
+	})
+}
+
+// updateSCIMGroup loads the group and its members, lets apply change them, then saves the result
+func updateSCIMGroup(w http.ResponseWriter, r *http.Request, apply func(*provisionedGroup) error) {
+	groupID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	group, err := groupRepo.GetGroup(r.Context(), groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("Group %d not found", groupID))
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch group")
+		return
+	}
+	members, err := groupRepo.ListGroupMembers(r.Context(), group.DisplayName)
+	if err != nil {
+		writeSCIMError(w, err, "Failed to fetch group")
+		return
+	}
+
+	state := provisionedGroup{DisplayName: group.DisplayName, ExternalID: group.ExternalID}
+	for _, member := range members {
+		state.MemberIDs = append(state.MemberIDs, member.UserID)
+	}
+	if err := apply(&state); err != nil {
+		writeSCIMError(w, err, "Failed to update group")
+		return
+	}
+	if err := state.validate(); err != nil {
+		writeSCIMError(w, err, "")
+		return
+	}
+
+	group.DisplayName, group.ExternalID = state.DisplayName, state.ExternalID
+	err = groupRepo.SaveGroup(r.Context(), &group, state.MemberIDs)
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("Group %d not found", groupID))
+		return
+	}
+	if !writeGroupSaveError(w, err) {
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.SCIMGroupUpdated, Reason: group.DisplayName})
+	writeSCIMGroup(w, r, http.StatusOK, groupID)
+}
+
+// writeGroupSaveError writes the error of a group save, if any, and reports whether it succeeded
+func writeGroupSaveError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrGroupNameTaken):
+		scim.WriteError(w, http.StatusConflict, scim.Uniqueness, "displayName is already in use")
+	case errors.Is(err, repository.ErrUnknownMember):
+		scim.WriteError(w, http.StatusBadRequest, scim.InvalidValue, "Every member must be an existing user ID")
+	case err != nil:
+		writeSCIMError(w, err, "Failed to save group")
+	default:
+		return true
+	}
+	return false
+}
+
+// memberFilterPath matches paths such as members[value eq "42"]
+var memberFilterPath = regexp.MustCompile(`^(?i:members)\[(.*)\]$`)
+
+// applyGroupPatch applies PATCH operations to a group's state
+func applyGroupPatch(state *provisionedGroup, operations []scim.PatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return &scimError{http.StatusBadRequest, scim.InvalidSyntax, "Unsupported operation " + operation.Op}
+		}
+
+		// No path: the value is an object of attributes to set
+		if operation.Path == "" {
+			if op == "remove" {
+				return &scimError{http.StatusBadRequest, scim.NoTarget, "remove requires a path"}
+			}
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return badSCIMValue("value must be an object of attributes when no path is given")
+			}
+			for attribute, value := range attributes {
+				if err := setGroupAttribute(state, op, attribute, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// members[value eq "42"] selects a single member to remove
+		if match := memberFilterPath.FindStringSubmatch(operation.Path); match != nil {
+			filter, err := scim.ParseFilter(match[1], "value")
+			if err != nil || filter == nil || op != "remove" {
+				return &scimError{http.StatusBadRequest, scim.InvalidPath, "Unsupported path " + operation.Path}
+			}
+			id, err := strconv.Atoi(filter.Value)
+			if err != nil {
+				return badSCIMValue("member %q is not a user ID", filter.Value)
+			}
+			state.remove([]int{id})
+			continue
+		}
+
+		if op == "remove" {
+			switch {
+			case strings.EqualFold(operation.Path, "members") && len(operation.Value) == 0:
+				state.MemberIDs = nil
+			case strings.EqualFold(operation.Path, "members"):
+				ids, err := memberIDs(operation.Value)
+				if err != nil {
+					return err
+				}
+				state.remove(ids)
+			case strings.EqualFold(operation.Path, "externalId"):
+				state.ExternalID = ""
+			default:
+				return &scimError{http.StatusBadRequest, scim.Mutability, operation.Path + " cannot be removed"}
+			}
+			continue
+		}
+
+		if err := setGroupAttribute(state, op, operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setGroupAttribute applies an add or replace of a single attribute
+func setGroupAttribute(state *provisionedGroup, op, attribute string, value json.RawMessage) error {
+	var err error
+	switch strings.ToLower(attribute) {
+	case "displayname":
+		state.DisplayName, err = scim.StringValue(value)
+		state.DisplayName = strings.TrimSpace(state.DisplayName)
+	case "externalid":
+		state.ExternalID, err = scim.StringValue(value)
+	case "members":
+		var ids []int
+		if ids, err = memberIDs(value); err != nil {
+			return err
+		}
+		if op == "replace" {
+			state.MemberIDs = nil
+		}
+		state.add(ids)
+	case "id", "schemas", "meta":
+		// read-only, sent back as-is by some identity providers
+	default:
+		return &scimError{http.StatusBadRequest, scim.InvalidPath, "Unsupported attribute " + attribute}
+	}
+	if err != nil {
+		return badSCIMValue("%s: %v", attribute, err)
+	}
+	return nil
+}
+
+// DeleteSCIMGroup deletes a group and revokes its role from every member
+func DeleteSCIMGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := scimID(w, r)
+	if !ok {
+		return
+	}
+
+	groupRepo := repository.GroupRepository{DB: database.DB}
+	displayName, err := groupRepo.DeleteGroup(r.Context(), groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		scim.WriteError(w, http.StatusNotFound, "", fmt.Sprintf("Group %d not found", groupID))
+		return
+	}
+	if err != nil {
+		writeSCIMError(w, err, "Failed to delete group")
+		return
+	}
+
+	fmt.Println("👥 SCIM: Deleted group", displayName)
+	audit.Record(r, audit.Event{Type: audit.SCIMGroupDeleted, Reason: displayName})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,18 +1,22 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
 	"go-auth-app/database"
 	"go-auth-app/middleware"
+	"go-auth-app/models"
 	"go-auth-app/repository"
 	"go-auth-app/utils"
+	"go-auth-app/validation"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
-
-
 // GetUserDetails retrieves the authenticated user's details
 func GetUserDetails(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from middleware
@@ -20,22 +24,110 @@ func GetUserDetails(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch user from database
 	userRepo := repository.UserRepository{DB: database.DB}
-	user, err := userRepo.GetUserByID(userID)
+	user, err := userRepo.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound, "User not found")
 		return
 	}
 
 	// Return user details (without password)
 	response := UserResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
 		IsDeleted: user.IsDeleted,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("ETag", etagFor(user.ID, user.Version))
+	writeJSON(w, http.StatusOK, response)
+}
+
+// UserPatch holds the fields of the user resource that clients may change
+type UserPatch struct {
+	Name string `json:"name" validate:"required,min=3,max=255"`
+}
+
+// Fields of the user resource that may appear in a patch but not change
+var readOnlyUserFields = []string{"id", "email", "is_deleted"}
+
+// PatchUser applies a JSON Merge Patch (RFC 7396) to the authenticated user.
+// The If-Match header must carry the ETag from GET /users/me, so concurrent
+// edits fail with 412 instead of silently overwriting each other.
+func PatchUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	patch, ok := decodeMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	user, err := userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound, "User not found")
+		return
+	}
+	if !checkIfMatch(w, r, etagFor(user.ID, user.Version)) {
+		return
+	}
+
+	// Apply the patch to the current representation
+	current, err := toDocument(UserResponse{ID: user.ID, Name: user.Name, Email: user.Email, IsDeleted: user.IsDeleted})
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to update user")
+		return
+	}
+	merged := applyMergePatch(current, patch).(map[string]interface{})
+
+	// Read-only fields may be echoed back unchanged; anything unknown is rejected
+	var fieldErrors []apierror.FieldError
+	for _, field := range readOnlyUserFields {
+		if !reflect.DeepEqual(merged[field], current[field]) {
+			fieldErrors = append(fieldErrors, apierror.FieldError{Field: field, Code: "read_only", Message: field + " cannot be changed"})
+		}
+		delete(merged, field)
+	}
+	for field := range merged {
+		if field != "name" {
+			fieldErrors = append(fieldErrors, apierror.FieldError{Field: field, Code: "unknown_field", Message: field + " is not a recognized field"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		apierror.WriteProblem(w, r, apierror.Validation(fieldErrors...))
+		return
+	}
+
+	var updated UserPatch
+	if name, ok := merged["name"].(string); ok {
+		updated.Name = name
+	} else if merged["name"] != nil {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{Field: "name", Code: "type", Message: "name must be a string"}))
+		return
+	}
+	if fieldErrors := validation.Struct(updated); len(fieldErrors) > 0 {
+		apierror.WriteProblem(w, r, apierror.Validation(fieldErrors...))
+		return
+	}
+
+	// Save, failing if someone else saved since we read the user
+	user.Name = strings.TrimSpace(updated.Name)
+	err = userRepo.UpdateUser(r.Context(), &user)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		apierror.Write(w, r, apierror.PreconditionFailed, "Resource has been modified since it was read; fetch it again and reapply the changes")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(user.ID, user.Version))
+	writeJSON(w, http.StatusOK, UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		IsDeleted: user.IsDeleted,
+	})
 }
 
 // UpdateUser updates the authenticated user's details
@@ -45,80 +137,82 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var updatedData struct {
-		Name *string `json:"name"`
+		Name *string `json:"name" validate:"required,min=3,max=255"`
 	}
-	json.NewDecoder(r.Body).Decode(&updatedData)
-
-	// Ensure name is provided
-	if updatedData.Name == nil || *updatedData.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	if !decodeJSON(w, r, &updatedData) {
 		return
 	}
 
 	// Fetch user from DB
 	userRepo := repository.UserRepository{DB: database.DB}
-	user, err := userRepo.GetUserByID(userID)
+	user, err := userRepo.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, r, apierror.NotFound, "User not found")
 		return
 	}
 
 	// Update name
-	user.Name = *updatedData.Name
+	user.Name = strings.TrimSpace(*updatedData.Name)
 
 	// Save changes to DB
-	err = userRepo.UpdateUser(user)
+	err = userRepo.UpdateUser(r.Context(), &user)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		apierror.Write(w, r, apierror.PreconditionFailed, "User was modified concurrently, retry the request")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update name", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to update name")
 		return
 	}
 
 	// Return updated user details
 	response := UserResponse{
-		ID:   user.ID,
-		Name: user.Name,
-		Email: user.Email,
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
 		IsDeleted: user.IsDeleted,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// 🔹 Extract userID safely from context
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, r, apierror.Unauthorized, "Unauthorized")
 		return
 	}
 
 	fmt.Println("🗑️ DeleteUser: Request to delete user ID:", userID)
 
-	// Call repository to mark user as deleted
+	// Mark the user as deleted and sign them out everywhere; logging in again
+	// within the grace period reactivates the account
 	userRepo := repository.UserRepository{DB: database.DB}
-	err := userRepo.SoftDeleteUser(userID)
+	err := userRepo.SoftDeleteUser(r.Context(), userID, models.DeactivatedBySelf)
 
 	if err != nil {
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to delete user")
 		return
 	}
 
 	fmt.Println("✅ DeleteUser: User ID marked as deleted successfully", userID)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
+	audit.Record(r, audit.Event{Type: audit.UserDeactivated, ActorID: userID, TargetID: userID})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "User deleted successfully"})
 }
 
-
 type UserListResponse struct {
 	Users      []UserResponse `json:"users"`
-	TotalUsers int           `json:"total_users"`
-	Page       int           `json:"page"`
-	Limit      int           `json:"limit"`
+	TotalUsers int            `json:"total_users"`
+	Page       int            `json:"page"`
+	Limit      int            `json:"limit"`
 }
 
-// GetAllUsers retrieves all users with pagination
+// GetAllUsers retrieves the members of the caller's active organization with
+// pagination. It runs behind middleware.OrgScope.
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value(middleware.OrgIDKey).(int)
+
 	// Parse pagination query params (default: page=1, limit=10)
 	page, err := strconv.Atoi(r.URL.Query().Get("page"))
 	if err != nil || page < 1 {
@@ -134,14 +228,14 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch users from the database
 	userRepo := repository.UserRepository{DB: database.DB}
-	users, totalUsers, err := userRepo.GetUsersWithPagination(limit, offset)
+	users, totalUsers, err := userRepo.GetUsersWithPagination(r.Context(), orgID, limit, offset)
 	if err != nil {
-		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch users")
 		return
 	}
 
 	// Convert users to response format
-	var userResponses []UserResponse
+	userResponses := []UserResponse{}
 	for _, user := range users {
 		userResponses = append(userResponses, UserResponse{
 			ID:    user.ID,
@@ -158,15 +252,12 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		Limit:      limit,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
-
-
 type ResetPasswordRequest struct {
-	OldPassword string `json:"old_password"`
-	NewPassword string `json:"new_password"`
+	OldPassword string `json:"old_password"` // not needed to set a first password after a recent login
+	NewPassword string `json:"new_password" validate:"required,notrim,min=6,maxbytes=72"`
 }
 
 // ResetPassword allows a user to change their password
@@ -176,51 +267,42 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req ResetPasswordRequest
-	json.NewDecoder(r.Body).Decode(&req)
-
-	// Validate input
-	if req.OldPassword == "" || req.NewPassword == "" {
-		http.Error(w, "Both old and new passwords are required", http.StatusBadRequest)
-		return
-	}
-	if len(req.NewPassword) < 6 {
-		http.Error(w, "Password must be at least 6 characters long", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Fetch only the hashed password
-	userRepo := repository.UserRepository{DB: database.DB}
-	hashedPassword, err := userRepo.GetUserPasswordByID(userID)
-	if err != nil {
-		http.Error(w, "User not found or password retrieval failed", http.StatusNotFound)
-		return
-	}
-
-	fmt.Println("🔑 Stored Password Hash:", hashedPassword) // Debugging
-
-	// Verify old password
-	if !utils.CheckPasswordHash(req.OldPassword, hashedPassword) {
-		http.Error(w, "Incorrect old password", http.StatusUnauthorized)
+	// Verify the old password; accounts without one need a recent login instead
+	if !reauthenticate(w, r, req.OldPassword, audit.PasswordChanged) {
 		return
 	}
 
 	// Hash new password
-	newHashedPassword, err := utils.HashPassword(req.NewPassword)
+	newHashedPassword, err := utils.HashPassword(r.Context(), req.NewPassword)
 	if err != nil {
-		http.Error(w, "Failed to hash new password", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to hash new password")
 		return
 	}
 
 	// Update password in DB
-	err = userRepo.UpdateUserPassword(userID, newHashedPassword)
+	userRepo := repository.UserRepository{DB: database.DB}
+	err = userRepo.UpdateUserPassword(r.Context(), userID, newHashedPassword)
 	if err != nil {
-		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal, "Failed to update password")
 		return
 	}
 
+	// Anyone holding the old password is signed out; this session stays
+	sessionID := r.Context().Value(middleware.SessionIDKey).(int)
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	if _, err := sessionRepo.RevokeOtherSessions(r.Context(), userID, sessionID); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to sign out other sessions")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.PasswordChanged, ActorID: userID, TargetID: userID})
+
 	// Return success response
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"message": "Password updated successfully",
 	})
 }
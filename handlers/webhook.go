@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/audit"
+	"go-auth-app/database"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateWebhookRequest is the body of POST /admin/webhooks
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,max=2048"`
+	EventTypes  []string `json:"event_types"` // empty subscribes to every event type
+	Description string   `json:"description" validate:"max=255"`
+}
+
+// CreatedWebhook is returned once, on creation: it is the only time the secret is shown
+type CreatedWebhook struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook subscribes an endpoint to user lifecycle events
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var req CreateWebhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var fieldErrors []apierror.FieldError
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		fieldErrors = append(fieldErrors, apierror.FieldError{Field: "url", Code: "url", Message: "url must be an absolute http(s) URL"})
+	}
+	for _, eventType := range req.EventTypes {
+		if !contains(models.WebhookEventTypes, eventType) {
+			fieldErrors = append(fieldErrors, apierror.FieldError{
+				Field:   "event_types",
+				Code:    "one_of",
+				Message: "event_types must only contain: " + strings.Join(models.WebhookEventTypes, ", "),
+			})
+			break
+		}
+	}
+	if len(fieldErrors) > 0 {
+		apierror.WriteProblem(w, r, apierror.Validation(fieldErrors...))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create webhook")
+		return
+	}
+	sub := models.WebhookSubscription{
+		URL:         req.URL,
+		Secret:      "whsec_" + base64.RawURLEncoding.EncodeToString(secret),
+		EventTypes:  req.EventTypes,
+		Description: strings.TrimSpace(req.Description),
+	}
+
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	if err := webhookRepo.CreateSubscription(r.Context(), &sub); err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to create webhook")
+		return
+	}
+
+	fmt.Println("🪝 CreateWebhook: Subscription", sub.ID, "to", sub.URL)
+	audit.Record(r, audit.Event{Type: audit.WebhookCreated, ActorID: adminID, Reason: strconv.Itoa(sub.ID)})
+	writeJSON(w, http.StatusCreated, CreatedWebhook{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// ListWebhooks returns the active subscriptions, without their secrets
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	subs, err := webhookRepo.ListSubscriptions(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch webhooks")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": subs})
+}
+
+// DeleteWebhook stops deliveries to a subscription
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int)
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	err := webhookRepo.DeleteSubscription(r.Context(), id)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		apierror.Write(w, r, apierror.NotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to delete webhook")
+		return
+	}
+
+	audit.Record(r, audit.Event{Type: audit.WebhookDeleted, ActorID: adminID, Reason: strconv.Itoa(id)})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveries shows the latest deliveries of a subscription;
+// ?status=dead lists the dead-lettered ones
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryDead {
+		apierror.WriteProblem(w, r, apierror.Validation(apierror.FieldError{Field: "status", Code: "one_of", Message: "status must be one of: pending, delivered, dead"}))
+		return
+	}
+
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	deliveries, err := webhookRepo.ListDeliveries(r.Context(), id, status, 100)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to fetch deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+// RetryWebhookDelivery requeues a dead-lettered delivery
+func RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	deliveryID, _ := strconv.ParseInt(mux.Vars(r)["deliveryID"], 10, 64)
+
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	err := webhookRepo.RetryDelivery(r.Context(), id, deliveryID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		apierror.Write(w, r, apierror.NotFound, "No dead-lettered delivery with this ID")
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal, "Failed to retry delivery")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Delivery requeued"})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
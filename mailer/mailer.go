@@ -0,0 +1,102 @@
+// Package mailer sends transactional emails (confirmation links, security notifications)
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/tracing"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Default is the mailer used by Send. It is replaced at startup from the
+// configuration and can be swapped in tests to capture outgoing messages.
+var Default Mailer = LogMailer{}
+
+// New returns the mailer selected by mail.driver
+func New(cfg config.MailConfig) Mailer {
+	if cfg.Driver == "smtp" {
+		return SMTPMailer{Config: cfg}
+	}
+	return LogMailer{}
+}
+
+// Send delivers msg with the Default mailer
+func Send(ctx context.Context, msg Message) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "mailer.Send")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	return Default.Send(ctx, msg)
+}
+
+// Link builds an absolute link for emails from mail.link_base_url
+func Link(path string) string {
+	return strings.TrimRight(config.Get().Mail.LinkBaseURL, "/") + path
+}
+
+// LogMailer prints messages to stdout. Links in them are live credentials,
+// so it must not be used in production.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	fmt.Printf("📧 Mail to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP relay, using STARTTLS when offered
+type SMTPMailer struct {
+	Config config.MailConfig
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.Config.SMTPHost, strconv.Itoa(m.Config.SMTPPort))
+
+	var auth smtp.Auth
+	if m.Config.SMTPUser != "" {
+		auth = smtp.PlainAuth("", m.Config.SMTPUser, m.Config.SMTPPassword, m.Config.SMTPHost)
+	}
+
+	if err := smtp.SendMail(addr, auth, m.Config.From, []string{msg.To}, m.format(msg)); err != nil {
+		return fmt.Errorf("sending mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// format renders the RFC 5322 message, stripping line breaks from headers
+func (m SMTPMailer) format(msg Message) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(m.Config.From))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
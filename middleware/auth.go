@@ -3,11 +3,19 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/repository"
+	"go-auth-app/tracing"
 	"go-auth-app/utils"
 
 	// "log"
 	"net/http"
 	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Context key for storing user ID
@@ -15,37 +23,82 @@ type contextKey string
 
 const UserIDKey contextKey = "user_id"
 
+// SessionIDKey stores the ID of the session the access token belongs to
+const SessionIDKey contextKey = "session_id"
+
+// orgClaimKey stores the org_id claim until OrgScope has checked the membership
+const orgClaimKey contextKey = "org_claim"
+
 // JWTMiddleware ensures that only authenticated users can access protected routes
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract Authorization header
+		// The span only covers authentication, the wrapped handler runs under the request span
+		spanCtx, span := tracing.Tracer().Start(r.Context(), "JWTMiddleware")
+
+		// Extract Authorization header, or the cookie in cookie session mode
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-			return
+		var tokenString string
+		viaCookie := false
+		if cookie, err := r.Cookie(AccessTokenCookie); authHeader == "" && err == nil && config.Get().Cookies.Enabled {
+			tokenString, viaCookie = cookie.Value, true
+		} else {
+			if authHeader == "" {
+				span.SetStatus(codes.Error, "missing authorization header")
+				span.End()
+				apierror.Write(w, r, apierror.Unauthorized, "Missing Authorization header")
+				return
+			}
+
+			// Extract token (Format: "Bearer <token>")
+			tokenParts := strings.Split(authHeader, " ")
+			if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+				span.SetStatus(codes.Error, "invalid authorization header format")
+				span.End()
+				apierror.Write(w, r, apierror.Unauthorized, "Invalid Authorization header format")
+				return
+			}
+
+			tokenString = tokenParts[1]
 		}
 
-		// Extract token (Format: "Bearer <token>")
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+		// Validate JWT token
+		claims, err := utils.ValidateToken(tokenString, false) // false = access token
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "invalid token")
+			span.End()
+			apierror.Write(w, r, apierror.InvalidToken, "Invalid token")
 			return
 		}
 
-		tokenString := tokenParts[1]
+		// ❌ Reject tokens whose session was revoked (logout, password change, operator action)
+		sessionRepo := repository.SessionRepository{DB: database.DB}
+		active, err := sessionRepo.IsSessionActive(spanCtx, claims.SessionID, claims.UserID)
+		if err != nil || !active {
+			span.SetStatus(codes.Error, "session revoked")
+			span.End()
+			apierror.Write(w, r, apierror.InvalidToken, "Invalid token")
+			return
+		}
 
-		// Validate JWT token
-		userID, err := utils.ValidateToken(tokenString, false) // false = access token
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		// 🛡️ Browsers send the cookie with requests other sites make, the CSRF header they cannot
+		if viaCookie && !ValidCSRF(r, claims.SessionID) {
+			span.SetStatus(codes.Error, "invalid csrf token")
+			span.End()
+			apierror.Write(w, r, apierror.Forbidden, "Missing or invalid "+CSRFHeader+" header")
 			return
 		}
 
+		userID := claims.UserID
 		fmt.Println("✅ JWTMiddleware: User ID extracted from token\n", userID)
+		span.SetAttributes(attribute.Int("enduser.id", userID))
+		span.End()
 
-		// Store user ID in request context
+		// Store user ID and session ID in request context
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, orgClaimKey, claims.OrgID)
+		ctx = context.WithValue(ctx, cookieAuthKey, viaCookie)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
-
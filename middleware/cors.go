@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"go-auth-app/config"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Request headers the API reads, and response headers browser apps may read
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID, " + CSRFHeader
+	corsExposedHeaders = "ETag, Location, Retry-After, X-Request-ID, Deprecation, Sunset, Link"
+)
+
+// CORS lets the configured origins call the API from the browser, and
+// answers their preflight requests before routing (which would reject OPTIONS)
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().CORS
+		origin := r.Header.Get("Origin")
+		if len(cfg.AllowedOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses differ per origin, so caches must not share them
+		w.Header().Add("Vary", "Origin")
+		allowed := OriginAllowed(cfg.AllowedOrigins, origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		// 🛫 Preflight: a disallowed origin gets no CORS headers and the browser stops there
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OriginAllowed matches an Origin header against the allowed origins:
+// exact origins, * for any, and https://*.example.com for any subdomain of
+// example.com (not example.com itself) with the same scheme and port
+func OriginAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	for _, pattern := range allowed {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		scheme, host, ok := strings.Cut(pattern, "://*.")
+		if !ok || scheme != parsed.Scheme {
+			continue
+		}
+		domain, port, _ := strings.Cut(host, ":")
+		if port == parsed.Port() && strings.HasSuffix(parsed.Hostname(), "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"go-auth-app/utils"
+	"net/http"
+)
+
+// Cookies and header of the cookie session mode (config.CookieConfig)
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token" // readable by the page, which echoes it in CSRFHeader
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// cookieAuthKey marks requests authenticated by the access token cookie
+const cookieAuthKey contextKey = "cookie_auth"
+
+// CookieAuthenticated reports whether the access token came from the cookie
+// rather than the Authorization header
+func CookieAuthenticated(r *http.Request) bool {
+	viaCookie, _ := r.Context().Value(cookieAuthKey).(bool)
+	return viaCookie
+}
+
+// ValidCSRF checks the CSRF header of a request authenticated by cookie.
+// Safe methods need none: they must not change anything.
+func ValidCSRF(r *http.Request, sessionID int) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return utils.ValidCSRFToken(sessionID, r.Header.Get(CSRFHeader))
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecated marks every response as coming from a deprecated endpoint
+// (RFC 9745 Deprecation and RFC 8594 Sunset headers) and links to the same
+// path under successorPrefix, e.g. /users/me -> /v1/users/me
+func Deprecated(deprecatedAt, sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, successorPrefix, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/database"
+	"go-auth-app/repository"
+	"net/http"
+	"strings"
+)
+
+// OrgIDKey stores the active organization, once OrgScope checked the membership
+const OrgIDKey contextKey = "org_id"
+
+// OrgRoleKey stores the caller's role in the active organization
+const OrgRoleKey contextKey = "org_role"
+
+// OrgScope restricts a route to the organization of the access token. The
+// membership is checked on every request, so removed members lose access
+// right away instead of when their token expires. It must be applied after
+// JWTMiddleware.
+func OrgScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if !ok {
+			apierror.Write(w, r, apierror.Unauthorized, "Unauthorized")
+			return
+		}
+		orgID, _ := r.Context().Value(orgClaimKey).(int)
+		if orgID == 0 {
+			apierror.Write(w, r, apierror.Forbidden, "No active organization, create or switch to one first")
+			return
+		}
+
+		orgRepo := repository.OrgRepository{DB: database.DB}
+		membership, err := orgRepo.GetMembership(r.Context(), orgID, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Println("⛔ OrgScope: User ID", userID, "is not a member of org", orgID)
+			apierror.Write(w, r, apierror.Forbidden, "You are not a member of the active organization")
+			return
+		}
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal, "Failed to check membership")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), OrgIDKey, orgID)
+		ctx = context.WithValue(ctx, OrgRoleKey, membership.Role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireOrgRole only lets members with one of roles in the active
+// organization through. It must be applied after OrgScope.
+func RequireOrgRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(OrgRoleKey).(string)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			apierror.Write(w, r, apierror.Forbidden, fmt.Sprintf("One of the organization roles %s is required", strings.Join(roles, ", ")))
+		})
+	}
+}
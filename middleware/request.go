@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/utils"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// Incoming IDs are only trusted if they look like an ID (no header injection, bounded length)
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID propagates the caller's X-Request-ID (or generates one), echoes it
+// in the response and stores it in the context for logs and error responses
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = utils.NewRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// Recover turns panics into a 500 problem response instead of dropping the connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				fmt.Printf("❌ Panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, utils.RequestIDFromContext(r.Context()), rec, debug.Stack())
+				apierror.Write(w, r, apierror.Internal, "An unexpected error occurred")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
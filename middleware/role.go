@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"go-auth-app/apierror"
+	"go-auth-app/database"
+	"go-auth-app/repository"
+	"net/http"
+)
+
+// RequireRole only lets users who were granted role through. It reads the
+// user ID stored by JWTMiddleware, so it must be applied after it.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(UserIDKey).(int)
+			if !ok {
+				apierror.Write(w, r, apierror.Unauthorized, "Unauthorized")
+				return
+			}
+
+			userRepo := repository.UserRepository{DB: database.DB}
+			hasRole, err := userRepo.HasRole(r.Context(), userID, role)
+			if err != nil {
+				apierror.Write(w, r, apierror.Internal, "Failed to check permissions")
+				return
+			}
+			if !hasRole {
+				fmt.Println("⛔ RequireRole: User ID", userID, "lacks role", role)
+				apierror.Write(w, r, apierror.Forbidden, fmt.Sprintf("The %q role is required", role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/scim"
+	"net/http"
+	"strings"
+)
+
+// SCIMAuth only lets the identity provider through: requests must carry the
+// configured SCIM token as a bearer token. Errors use the SCIM format since
+// SCIM clients do not understand problem+json.
+func SCIMAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := config.Get().SCIM.Token
+		if expected == "" {
+			scim.WriteError(w, http.StatusNotFound, "", "SCIM provisioning is not enabled")
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			fmt.Println("⛔ SCIMAuth: Rejected request with a missing or invalid token")
+			scim.WriteError(w, http.StatusUnauthorized, "", "Invalid or missing bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"go-auth-app/config"
+	"net/http"
+)
+
+// SecurityHeaders sets the browser security headers on every response. The
+// API serves no pages to frame or scripts to sniff, so the defaults are strict.
+// Responses carrying tokens also disable caching, see handlers.noStore.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().SecurityHeaders
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", cfg.FrameOptions)
+		if cfg.ReferrerPolicy != "" {
+			w.Header().Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		// Browsers ignore it over plain HTTP, so it is safe to always send
+		if cfg.HSTSMaxAge > 0 {
+			hsts := fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds()))
+			if cfg.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
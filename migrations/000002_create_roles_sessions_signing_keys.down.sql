@@ -0,0 +1,3 @@
+DROP TABLE signing_keys;
+DROP TABLE sessions;
+DROP TABLE user_roles;
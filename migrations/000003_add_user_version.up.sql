@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN version INT NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
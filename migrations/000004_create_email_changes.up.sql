@@ -0,0 +1,15 @@
+CREATE TABLE email_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email VARCHAR(255) NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    confirm_token_hash CHAR(64) UNIQUE NOT NULL,
+    revert_token_hash CHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    confirm_expires_at TIMESTAMPTZ NOT NULL,
+    revert_expires_at TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    reverted_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_email_changes_user_id ON email_changes (user_id);
@@ -0,0 +1,5 @@
+DROP TABLE action_tokens;
+
+ALTER TABLE users
+    DROP COLUMN purged_at,
+    DROP COLUMN deleted_at;
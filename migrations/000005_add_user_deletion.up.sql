@@ -0,0 +1,20 @@
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMPTZ,
+    ADD COLUMN purged_at TIMESTAMPTZ;
+
+-- Accounts deactivated before this migration start their grace period now
+UPDATE users SET deleted_at = NOW() WHERE is_deleted;
+
+CREATE INDEX idx_users_pending_purge ON users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
+
+CREATE TABLE action_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_action_tokens_user_id ON action_tokens (user_id);
@@ -0,0 +1,41 @@
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    type VARCHAR(64) NOT NULL,
+    source VARCHAR(16) NOT NULL CHECK (source IN ('api', 'cli', 'job')),
+    actor_id INT REFERENCES users(id),
+    target_id INT REFERENCES users(id),
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    outcome VARCHAR(16) NOT NULL CHECK (outcome IN ('success', 'failure')),
+    reason VARCHAR(255),
+    request_id VARCHAR(128)
+);
+
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id, id);
+CREATE INDEX idx_audit_events_target_id ON audit_events (target_id, id);
+CREATE INDEX idx_audit_events_type ON audit_events (type, id);
+
+-- Events are append-only. The only change allowed is erasing the IP address
+-- and user agent when the user they belong to is anonymized.
+CREATE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.ip_address IS NULL AND NEW.user_agent IS NULL
+        AND (NEW.id, NEW.occurred_at, NEW.type, NEW.source, NEW.actor_id, NEW.target_id, NEW.outcome, NEW.reason, NEW.request_id)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.occurred_at, OLD.type, OLD.source, OLD.actor_id, OLD.target_id, OLD.outcome, OLD.reason, OLD.request_id)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only (% not allowed)', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,5 @@
+ALTER TABLE sessions DROP COLUMN active_org_id;
+
+DROP TABLE org_invitations;
+DROP TABLE memberships;
+DROP TABLE organizations;
@@ -0,0 +1,34 @@
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE memberships (
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_memberships_user_id ON memberships (user_id);
+
+CREATE TABLE org_invitations (
+    id SERIAL PRIMARY KEY,
+    org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    invited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    accepted_by INT REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_org_invitations_org_id ON org_invitations (org_id);
+
+-- The organization the session acts in; access tokens carry it as a claim
+ALTER TABLE sessions ADD COLUMN active_org_id INT REFERENCES organizations(id) ON DELETE SET NULL;
@@ -0,0 +1,18 @@
+-- Accounts registered under the approval policy stay pending until an admin decides
+ALTER TABLE users ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'approved'
+    CHECK (status IN ('approved', 'pending', 'rejected'));
+
+CREATE INDEX idx_users_pending ON users (id) WHERE status = 'pending';
+
+-- Single-use registration invite codes; only the hash of the code is stored
+CREATE TABLE invite_codes (
+    id SERIAL PRIMARY KEY,
+    code_hash CHAR(64) UNIQUE NOT NULL,
+    email VARCHAR(255),
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    used_at TIMESTAMPTZ,
+    used_by INT REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMPTZ
+);
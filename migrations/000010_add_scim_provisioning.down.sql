@@ -0,0 +1,4 @@
+DROP TABLE scim_groups;
+
+ALTER TABLE users DROP COLUMN managed_by_scim;
+ALTER TABLE users DROP COLUMN external_id;
@@ -0,0 +1,18 @@
+-- Identifier of the user in the identity provider that provisions it over SCIM
+ALTER TABLE users ADD COLUMN external_id VARCHAR(255);
+
+-- The identity provider owns the lifecycle of the accounts it manages: they
+-- cannot reactivate themselves after it deactivated them
+ALTER TABLE users ADD COLUMN managed_by_scim BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_users_external_id ON users (external_id) WHERE external_id IS NOT NULL;
+
+-- SCIM groups. A group is a role: its members are the users granted the role
+-- named after the group's display name in user_roles.
+CREATE TABLE scim_groups (
+    id SERIAL PRIMARY KEY,
+    display_name VARCHAR(50) UNIQUE NOT NULL,
+    external_id VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DELETE FROM user_identities WHERE provider LIKE 'saml:%';
+ALTER TABLE user_identities ALTER COLUMN provider TYPE VARCHAR(32);
+DROP TABLE saml_assertions;
+DROP TABLE saml_requests;
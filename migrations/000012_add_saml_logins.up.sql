@@ -0,0 +1,22 @@
+-- SAML logins in progress, consumed by the assertion consumer service. The
+-- relay state sent with the AuthnRequest finds the request ID the response
+-- must answer.
+CREATE TABLE saml_requests (
+    relay_state_hash VARCHAR(64) PRIMARY KEY,
+    idp VARCHAR(32) NOT NULL,
+    request_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Assertions already used to log in, kept until they expire so that a
+-- captured response cannot be replayed
+CREATE TABLE saml_assertions (
+    idp VARCHAR(32) NOT NULL,
+    assertion_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (idp, assertion_id)
+);
+
+-- SAML identities are stored as saml:<idp>
+ALTER TABLE user_identities ALTER COLUMN provider TYPE VARCHAR(64);
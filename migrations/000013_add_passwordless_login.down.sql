@@ -0,0 +1,3 @@
+DROP TABLE login_challenges;
+UPDATE users SET password = '' WHERE password IS NULL;
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
@@ -0,0 +1,22 @@
+-- Passwordless accounts have no password hash instead of an empty one
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+UPDATE users SET password = NULL WHERE password = '';
+
+-- Emailed login links and codes. Requests for addresses without an account
+-- are recorded too (user_id NULL, no secret) so that throttling does not
+-- tell which addresses are registered. The nonce is the hash of the cookie
+-- set in the browser that asked.
+CREATE TABLE login_challenges (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    method VARCHAR(8) NOT NULL, -- link or code
+    secret_hash CHAR(64),
+    nonce_hash CHAR(64) UNIQUE NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_login_challenges_email ON login_challenges (LOWER(email), created_at);
@@ -0,0 +1,3 @@
+-- New keys only verify tokens until every server has loaded them, then sign
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+UPDATE signing_keys SET activates_at = created_at;
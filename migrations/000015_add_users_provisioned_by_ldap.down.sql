@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN provisioned_by_ldap;
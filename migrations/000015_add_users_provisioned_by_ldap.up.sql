@@ -0,0 +1,6 @@
+-- Directory logins only adopt accounts the directory created; the audit
+-- trail tells which existing accounts those are
+ALTER TABLE users ADD COLUMN provisioned_by_ldap BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET provisioned_by_ldap = TRUE
+    WHERE password IS NULL
+    AND id IN (SELECT target_id FROM audit_events WHERE type = 'user.registered' AND outcome = 'success' AND reason = 'ldap');
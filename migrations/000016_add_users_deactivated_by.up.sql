@@ -0,0 +1,15 @@
+-- Who deactivated an account: users only reactivate what they deleted
+-- themselves. The audit trail tells who deactivated the deleted accounts.
+ALTER TABLE users ADD COLUMN deactivated_by VARCHAR(16) CHECK (deactivated_by IN ('self', 'operator', 'scim'));
+UPDATE users SET deactivated_by = CASE
+        WHEN e.type = 'scim.user_deactivated' THEN 'scim'
+        WHEN e.reason = 'operator' THEN 'operator'
+        ELSE 'self'
+    END
+    FROM (
+        SELECT DISTINCT ON (target_id) target_id, type, reason FROM audit_events
+        WHERE type IN ('user.deactivated', 'scim.user_deactivated') AND outcome = 'success'
+        ORDER BY target_id, id DESC
+    ) e
+    WHERE e.target_id = users.id AND users.deleted_at IS NOT NULL;
+UPDATE users SET deactivated_by = 'self' WHERE deleted_at IS NOT NULL AND deactivated_by IS NULL;
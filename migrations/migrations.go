@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the binary can apply
+// them without the files being present on disk.
+package migrations
+
+import "embed"
+
+// FS holds every *.up.sql / *.down.sql file in this directory
+//
+//go:embed *.sql
+var FS embed.FS
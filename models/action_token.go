@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Purposes of single-use action tokens sent by email
+const (
+	TokenPurposeReactivate = "reactivate"
+)
+
+// ActionToken is a single-use token behind an emailed link. Only its hash is stored.
+type ActionToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditEvent is an append-only record of a security-relevant action.
+// ActorID is who did it (nil for anonymous callers and operators), TargetID
+// the account it was done to.
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Type       string    `json:"type"`
+	Source     string    `json:"source"`
+	ActorID    *int      `json:"actor_id"`
+	TargetID   *int      `json:"target_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason"`
+	RequestID  string    `json:"request_id"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// DataExport is everything stored about a user, as handed out for a data
+// subject access request. Secrets (password hash, token hashes) are left out.
+type DataExport struct {
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Profile         ExportedProfile  `json:"profile"`
+	Roles           []ExportedRole   `json:"roles"`
+	Memberships     []Membership     `json:"memberships"`
+	Invitations     []OrgInvitation  `json:"invitations"`
+	Sessions        []Session        `json:"sessions"`
+	Identities      []UserIdentity   `json:"identities"`
+	EmailChanges    []EmailChange    `json:"email_changes"`
+	ActionTokens    []ActionToken    `json:"action_tokens"`
+	LoginChallenges []LoginChallenge `json:"login_challenges"`
+	AuditEvents     []AuditEvent     `json:"audit_events"`
+}
+
+// ExportedProfile is the user row without credentials
+type ExportedProfile struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	IsDeleted bool       `json:"is_deleted"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+// ExportedRole is a role grant with its date
+type ExportedRole struct {
+	Role      string    `json:"role"`
+	GrantedAt time.Time `json:"granted_at"`
+}
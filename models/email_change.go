@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmailChange is a pending or completed change of a user's email address.
+// The new address confirms it, the old one can revert it.
+type EmailChange struct {
+	ID               int        `json:"id"`
+	UserID           int        `json:"user_id"`
+	OldEmail         string     `json:"old_email"`
+	NewEmail         string     `json:"new_email"`
+	ConfirmTokenHash string     `json:"-"`
+	RevertTokenHash  string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ConfirmExpiresAt time.Time  `json:"confirm_expires_at"`
+	RevertExpiresAt  time.Time  `json:"revert_expires_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at"`
+	RevertedAt       *time.Time `json:"reverted_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Group is a SCIM group. It stands for the role named after its display name:
+// the members of the group are the users granted that role.
+type Group struct {
+	ID          int       `json:"id"`
+	DisplayName string    `json:"display_name"`
+	ExternalID  string    `json:"external_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupMember is a user in a group
+type GroupMember struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
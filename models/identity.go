@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserIdentity is an account at an external identity provider linked to a user
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"` // the user's stable ID at the provider
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState is a login in progress at a provider. Only the hash of the
+// state parameter is stored; UserID is set when linking an identity.
+type OIDCLoginState struct {
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	UserID       *int
+	ExpiresAt    time.Time
+}
+
+// SAMLRequest is a login in progress at a SAML identity provider. Only the
+// hash of the relay state is stored.
+type SAMLRequest struct {
+	RelayStateHash string
+	IdP            string
+	RequestID      string
+	ExpiresAt      time.Time
+}
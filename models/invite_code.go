@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// InviteCode lets one person register when registration is invite-only. Only
+// the hash of the code is stored.
+type InviteCode struct {
+	ID        int        `json:"id"`
+	CodeHash  string     `json:"-"`
+	Email     *string    `json:"email"` // When set, only this address can use the code
+	CreatedBy *int       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	UsedBy    *int       `json:"used_by"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Ways to receive a passwordless login
+const (
+	LoginMethodLink = "link" // a magic link
+	LoginMethodCode = "code" // a 6-digit one-time code
+)
+
+// LoginChallenge is a passwordless login in progress. Only hashes of the
+// secret and of the browser's nonce are stored; UserID is nil when no
+// account has the email.
+type LoginChallenge struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	UserID     *int       `json:"user_id"`
+	Method     string     `json:"method"`
+	SecretHash string     `json:"-"`
+	NonceHash  string     `json:"-"`
+	Attempts   int        `json:"attempts"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Roles within an organization. Owners and admins manage members and
+// invitations; only owners can make other owners.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant (a customer company) that users belong to
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Membership gives a user a role in an organization
+type Membership struct {
+	OrgID     int       `json:"org_id"`
+	UserID    int       `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgInvitation invites an email address to join an organization. Only the
+// hash of the emailed token is stored.
+type OrgInvitation struct {
+	ID         int        `json:"id"`
+	OrgID      int        `json:"org_id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  *int       `json:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+// UserOrganization is an organization together with the caller's role in it
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// OrgMember is a user listed with their role in an organization
+type OrgMember struct {
+	UserID   int       `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -0,0 +1,4 @@
+package models
+
+// RoleAdmin grants access to operator endpoints
+const RoleAdmin = "admin"
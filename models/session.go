@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is created on every login; tokens carry its ID so they can be revoked
+type Session struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// ActiveOrgID is the organization the session acts in (0 for none)
+	ActiveOrgID int `json:"-"`
+}
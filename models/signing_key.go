@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Signing key purposes
+const (
+	KeyPurposeAccess  = "access"
+	KeyPurposeRefresh = "refresh"
+)
+
+// SigningKey is an HMAC secret used to sign JWTs, identified by the token's "kid" header.
+// A new key only verifies until ActivatesAt, so every server knows it before
+// it signs. Retired keys no longer sign new tokens but still verify existing ones.
+type SigningKey struct {
+	ID          int        `json:"id"`
+	KID         string     `json:"kid"`
+	Purpose     string     `json:"purpose"`
+	Secret      string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
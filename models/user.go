@@ -1,9 +1,45 @@
 package models
 
+import "time"
+
+// Registration statuses. Only approved users can log in.
+const (
+	UserStatusApproved = "approved"
+	UserStatusPending  = "pending" // waiting in the admin approval queue
+	UserStatusRejected = "rejected"
+)
+
+// Who deactivated an account. Users can only reactivate an account they deleted themselves.
+const (
+	DeactivatedBySelf     = "self"
+	DeactivatedByOperator = "operator" // `user deactivate`
+	DeactivatedBySCIM     = "scim"     // the identity provider
+)
+
 type User struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`        
-	IsDeleted bool   `json:"is_deleted"`
-}
\ No newline at end of file
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Password  string     `json:"password"` // bcrypt hash; empty (NULL) for passwordless accounts
+	IsDeleted bool       `json:"is_deleted"`
+	Version   int        `json:"version"` // Bumped on every change, for optimistic concurrency
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"` // Start of the reactivation grace period
+	PurgedAt  *time.Time `json:"purged_at"`  // Set once the account has been anonymized
+	// DeactivatedBy tells who deleted the account, empty while it is active
+	DeactivatedBy string `json:"deactivated_by,omitempty"`
+	Status    string     `json:"status"`     // Registration status, empty means approved on creation
+	// ExternalID identifies the user in the identity provider that provisions it over SCIM
+	ExternalID string `json:"external_id,omitempty"`
+	// ManagedBySCIM is set once the identity provider manages the account; only it can reactivate it
+	ManagedBySCIM bool `json:"managed_by_scim"`
+	// ProvisionedByLDAP is set on accounts created by a directory login; only those are adopted by later ones
+	ProvisionedByLDAP bool `json:"-"`
+}
+
+// HasPassword reports whether the user can log in with a password. Users
+// provisioned by an identity provider or a directory, and users who only log
+// in with emailed links or codes, have none.
+func (u User) HasPassword() bool {
+	return u.Password != ""
+}
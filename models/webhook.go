@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// User lifecycle events delivered to webhook subscribers
+const (
+	WebhookUserRegistered      = "user.registered"
+	WebhookUserEmailChanged    = "user.email_changed"
+	WebhookUserPasswordChanged = "user.password_changed"
+	WebhookUserDeactivated     = "user.deactivated"
+	WebhookUserReactivated     = "user.reactivated"
+	WebhookUserErased          = "user.erased"
+)
+
+// WebhookEventTypes lists every event type subscribers can ask for. There is
+// no email-verified event: addresses are not verified by this service, so
+// one can only be added together with an email verification flow.
+var WebhookEventTypes = []string{
+	WebhookUserRegistered, WebhookUserEmailChanged, WebhookUserPasswordChanged,
+	WebhookUserDeactivated, WebhookUserReactivated, WebhookUserErased,
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // gave up after the last attempt
+)
+
+// WebhookSubscription is an endpoint that receives events. The secret signs
+// every delivery and is only shown when the subscription is created.
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the body POSTed to subscribers
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookDelivery is one event sent to one subscription
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/apierror"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// recorder buffers the handler's response so it can be checked before reaching the client
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+// ValidationMiddleware checks every routed request and response against the
+// spec. Any drift (an undocumented route, status, content type or body shape,
+// or an invalid request that still succeeded) is replaced by a 500 problem so
+// tests fail loudly. It buffers whole responses and is meant for test mode only.
+func ValidationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := Spec()
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal, err.Error())
+			return
+		}
+
+		template := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				template = PathTemplate(tmpl)
+			}
+		}
+
+		op, ok := doc.Operation(r.Method, template)
+		if !ok {
+			reject(w, r, []string{fmt.Sprintf("%s %s is not documented", r.Method, template)})
+			return
+		}
+
+		// Read the body up front and hand the handler an identical copy
+		var requestBody []byte
+		if r.Body != nil {
+			requestBody, _ = io.ReadAll(r.Body)
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+		requestErrs := doc.checkRequest(op, r.Header.Get("Content-Type"), requestBody)
+
+		rec := &recorder{header: http.Header{}}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		violations := doc.checkResponse(op, rec)
+		if len(requestErrs) > 0 && rec.status < 300 {
+			violations = append(violations, "request does not match the spec but the handler accepted it:")
+			violations = append(violations, requestErrs...)
+		}
+		if len(violations) > 0 {
+			reject(w, r, violations)
+			return
+		}
+
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+func (d *Document) checkRequest(op *Operation, contentType string, body []byte) []string {
+	if op.RequestBody == nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return []string{"request body is required"}
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		return []string{fmt.Sprintf("request content type %q is not documented", contentType)}
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+	return d.checkBody(media.Schema, body, "request")
+}
+
+func (d *Document) checkResponse(op *Operation, rec *recorder) []string {
+	resp, ok := d.response(op, rec.status)
+	if !ok {
+		return []string{fmt.Sprintf("response status %d is not documented", rec.status)}
+	}
+	if len(resp.Content) == 0 {
+		if rec.body.Len() > 0 {
+			return []string{fmt.Sprintf("response status %d is documented without a body", rec.status)}
+		}
+		return nil
+	}
+
+	contentType := rec.header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return []string{fmt.Sprintf("response content type %q is not documented for status %d", contentType, rec.status)}
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+	return d.checkBody(media.Schema, rec.body.Bytes(), "response")
+}
+
+func (d *Document) checkBody(schema *Schema, body []byte, what string) []string {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{fmt.Sprintf("%s body is not valid JSON: %v", what, err)}
+	}
+	var errs []string
+	for _, err := range d.Validate(schema, value) {
+		errs = append(errs, what+" "+err)
+	}
+	return errs
+}
+
+// reject reports spec drift as a 500 problem and logs it for the test output
+func reject(w http.ResponseWriter, r *http.Request, violations []string) {
+	fmt.Println("❌ OpenAPI violation on", r.Method, r.URL.Path+":", strings.Join(violations, "; "))
+	apierror.Write(w, r, apierror.Internal, "OpenAPI violation: "+strings.Join(violations, "; "))
+}
@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema (2020-12, as used by OpenAPI 3.1) the validator checks
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 schemaType         `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// schemaType accepts both "type": "string" and "type": ["string", "null"]
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// Validate checks a decoded JSON value against the schema and returns every violation
+func (d *Document) Validate(schema *Schema, value interface{}) []string {
+	var errs []string
+	d.validate(schema, value, "$", &errs)
+	return errs
+}
+
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, at string, errs *[]string) {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	if len(schema.Type) > 0 && !typeMatches(schema.Type, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: expected %s, got %s", at, strings.Join(schema.Type, " or "), jsonType(value)))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: %v is not one of %v", at, value, schema.Enum))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			*errs = append(*errs, fmt.Sprintf("%s: shorter than %d characters", at, *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			*errs = append(*errs, fmt.Sprintf("%s: longer than %d characters", at, *schema.MaxLength))
+		}
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			*errs = append(*errs, fmt.Sprintf("%s: less than %v", at, *schema.Minimum))
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			*errs = append(*errs, fmt.Sprintf("%s: greater than %v", at, *schema.Maximum))
+		}
+	case []interface{}:
+		for i, item := range v {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), errs)
+		}
+	case map[string]interface{}:
+		d.validateObject(schema, v, at, errs)
+	}
+}
+
+func (d *Document) validateObject(schema *Schema, obj map[string]interface{}, at string, errs *[]string) {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", at, name))
+		}
+	}
+
+	// additionalProperties is either a boolean or a schema for the extra values
+	allowExtra, extraSchema := true, (*Schema)(nil)
+	if len(schema.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(schema.AdditionalProperties, &allowExtra); err != nil {
+			allowExtra = true
+			extraSchema = &Schema{}
+			json.Unmarshal(schema.AdditionalProperties, extraSchema)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := at + "." + name
+		if propSchema, ok := schema.Properties[name]; ok {
+			d.validate(propSchema, obj[name], path, errs)
+		} else if !allowExtra {
+			*errs = append(*errs, fmt.Sprintf("%s: property is not documented", path))
+		} else if extraSchema != nil {
+			d.validate(extraSchema, obj[name], path, errs)
+		}
+	}
+}
+
+func typeMatches(types []string, value interface{}) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a value decoded by encoding/json
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, option := range enum {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+// Package openapi serves the hand-maintained OpenAPI 3.1 document describing
+// the API and validates live traffic against it in test mode.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var rawSpec []byte
+
+// Document is the subset of an OpenAPI 3.1 document the validator understands
+type Document struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]Operation       `json:"-"`
+	RawPaths   map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+// Operation is a single method on a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Deprecated  bool                 `json:"deprecated"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// RequestBody describes the accepted request payloads
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one documented status code
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of a payload
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// HTTP methods that can appear as keys of a path item
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+var (
+	loadOnce sync.Once
+	document *Document
+	loadErr  error
+)
+
+// Spec returns the embedded OpenAPI document
+func Spec() (*Document, error) {
+	loadOnce.Do(func() {
+		document, loadErr = parse(rawSpec)
+	})
+	return document, loadErr
+}
+
+func parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI document: %w", err)
+	}
+
+	// Path items mix operations with shared keys such as "parameters"
+	doc.Paths = map[string]map[string]Operation{}
+	for path, item := range doc.RawPaths {
+		doc.Paths[path] = map[string]Operation{}
+		for key, raw := range item {
+			if !methods[key] {
+				continue
+			}
+			var op Operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("parsing %s %s: %w", strings.ToUpper(key), path, err)
+			}
+			doc.Paths[path][strings.ToUpper(key)] = op
+		}
+	}
+	return &doc, nil
+}
+
+// Operation returns the documented method on a path template such as "/users/{id}"
+func (d *Document) Operation(method, pathTemplate string) (*Operation, bool) {
+	op, ok := d.Paths[pathTemplate][strings.ToUpper(method)]
+	if !ok {
+		return nil, false
+	}
+	return &op, true
+}
+
+// PathTemplate converts a mux route template ("/users/{id:[0-9]+}") to OpenAPI form ("/users/{id}")
+func PathTemplate(muxTemplate string) string {
+	var b strings.Builder
+	depth := 0
+	skipping := false
+	for _, c := range muxTemplate {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skipping = false
+			}
+		case c == ':' && depth == 1:
+			skipping = true
+		}
+		if !skipping || (c == '}' && depth == 0) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// response resolves the documented response for a status code, falling back to "default"
+func (d *Document) response(op *Operation, status int) (*Response, bool) {
+	resp, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return nil, false
+	}
+	if resp.Ref != "" {
+		resolved, found := d.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+		if !found {
+			return nil, false
+		}
+		resp = resolved
+	}
+	return resp, true
+}
+
+// ServeSpec serves the OpenAPI document at /openapi.json
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(rawSpec)
+}
+
+// docsPage renders the document with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Go Auth App API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" }); };
+  </script>
+</body>
+</html>
+`
+
+// ServeDocs serves the interactive documentation at /docs
+func ServeDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+)
+
+// ErrActionTokenInvalid is returned for unknown, expired or already used tokens
+var ErrActionTokenInvalid = errors.New("token is invalid or expired")
+
+// ActionTokenRepository handles database operations for single-use emailed tokens
+type ActionTokenRepository struct {
+	DB *sql.DB
+}
+
+// CreateActionToken stores a token, invalidating the user's unused tokens for the same purpose
+func (repo *ActionTokenRepository) CreateActionToken(ctx context.Context, token *models.ActionToken) (err error) {
+	query := `INSERT INTO action_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "ActionTokenRepository.CreateActionToken", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM action_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, token.UserID, token.Purpose)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeActionToken marks a valid token as used and returns it, so each token works once
+func (repo *ActionTokenRepository) ConsumeActionToken(ctx context.Context, purpose, tokenHash string) (token models.ActionToken, err error) {
+	query := `UPDATE action_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, created_at, expires_at, used_at`
+	ctx, span := startSpan(ctx, "ActionTokenRepository.ConsumeActionToken", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, tokenHash, purpose).Scan(
+		&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrActionTokenInvalid
+	}
+	return token, err
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-auth-app/models"
+	"strings"
+	"time"
+)
+
+// AuditRepository stores and queries audit events. There is deliberately no
+// update or delete: the table rejects both.
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+// AuditFilter narrows an audit event query. Zero values match everything.
+type AuditFilter struct {
+	Type     string
+	ActorID  int
+	TargetID int
+	// UserID matches events where the user is either the actor or the target
+	UserID  int
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	// BeforeID is the pagination cursor: only events older than it are returned
+	BeforeID int64
+}
+
+const auditEventColumns = `id, occurred_at, type, source, actor_id, target_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+	outcome, COALESCE(reason, ''), COALESCE(request_id, '')`
+
+func scanAuditEvent(rows *sql.Rows, event *models.AuditEvent) error {
+	return rows.Scan(&event.ID, &event.OccurredAt, &event.Type, &event.Source, &event.ActorID, &event.TargetID,
+		&event.IPAddress, &event.UserAgent, &event.Outcome, &event.Reason, &event.RequestID)
+}
+
+// CreateEvent appends an event
+func (repo *AuditRepository) CreateEvent(ctx context.Context, event *models.AuditEvent) (err error) {
+	query := `INSERT INTO audit_events (type, source, actor_id, target_id, ip_address, user_agent, outcome, reason, request_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, '')) RETURNING id, occurred_at`
+	ctx, span := startSpan(ctx, "AuditRepository.CreateEvent", query)
+	defer func() { endSpan(span, err) }()
+
+	return repo.DB.QueryRowContext(ctx, query, event.Type, event.Source, event.ActorID, event.TargetID,
+		event.IPAddress, event.UserAgent, event.Outcome, event.Reason, event.RequestID).Scan(&event.ID, &event.OccurredAt)
+}
+
+// ListEvents returns up to limit events matching the filter, newest first
+func (repo *AuditRepository) ListEvents(ctx context.Context, filter AuditFilter, limit int) (events []models.AuditEvent, err error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Type != "" {
+		where("type = $%d", filter.Type)
+	}
+	if filter.ActorID != 0 {
+		where("actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		where("target_id = $%d", filter.TargetID)
+	}
+	if filter.UserID != 0 {
+		where("(actor_id = $%[1]d OR target_id = $%[1]d)", filter.UserID)
+	}
+	if filter.Outcome != "" {
+		where("outcome = $%d", filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		where("occurred_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("occurred_at < $%d", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		where("id < $%d", filter.BeforeID)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	ctx, span := startSpan(ctx, "AuditRepository.ListEvents", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events = []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		if err = scanAuditEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"go-auth-app/models"
+	"time"
+)
+
+// DataExportRepository gathers a user's data from every table for export
+type DataExportRepository struct {
+	DB *sql.DB
+}
+
+// ExportUser reads everything stored about a user in a single read-only
+// snapshot, so the sections of the export are consistent with each other
+func (repo *DataExportRepository) ExportUser(ctx context.Context, userID int) (export models.DataExport, err error) {
+	query := `SELECT id, name, email, is_deleted, updated_at, deleted_at FROM users WHERE id = $1 AND purged_at IS NULL`
+	ctx, span := startSpan(ctx, "DataExportRepository.ExportUser", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return export, err
+	}
+	defer tx.Rollback()
+
+	profile := &export.Profile
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&profile.ID, &profile.Name, &profile.Email, &profile.IsDeleted, &profile.UpdatedAt, &profile.DeletedAt)
+	if err != nil {
+		return export, err
+	}
+
+	export.Roles = []models.ExportedRole{}
+	err = queryEach(ctx, tx, `SELECT role, granted_at FROM user_roles WHERE user_id = $1 ORDER BY granted_at`, userID, func(rows *sql.Rows) error {
+		var role models.ExportedRole
+		err := rows.Scan(&role.Role, &role.GrantedAt)
+		export.Roles = append(export.Roles, role)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.Memberships = []models.Membership{}
+	err = queryEach(ctx, tx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE user_id = $1 ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var membership models.Membership
+		err := rows.Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt)
+		export.Memberships = append(export.Memberships, membership)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	// Invitations are addressed to an email, not to an account
+	export.Invitations = []models.OrgInvitation{}
+	err = queryEach(ctx, tx, `SELECT `+orgInvitationColumns+` FROM org_invitations
+		WHERE LOWER(email) = (SELECT LOWER(email) FROM users WHERE id = $1) ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var inv models.OrgInvitation
+		err := scanOrgInvitation(rows, &inv)
+		export.Invitations = append(export.Invitations, inv)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	// Every login creates a session, so this is the login history too
+	export.Sessions = []models.Session{}
+	err = queryEach(ctx, tx, `SELECT id, user_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at, revoked_at
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.IPAddress, &session.UserAgent, &session.CreatedAt, &session.RevokedAt)
+		export.Sessions = append(export.Sessions, session)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.Identities = []models.UserIdentity{}
+	err = queryEach(ctx, tx, `SELECT `+identityColumns+` FROM user_identities WHERE user_id = $1 ORDER BY id`, userID, func(rows *sql.Rows) error {
+		identity, err := scanIdentity(rows)
+		export.Identities = append(export.Identities, identity)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.EmailChanges = []models.EmailChange{}
+	err = queryEach(ctx, tx, `SELECT id, user_id, old_email, new_email, created_at, confirm_expires_at, revert_expires_at, confirmed_at, reverted_at
+		FROM email_changes WHERE user_id = $1 ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var change models.EmailChange
+		err := rows.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.CreatedAt,
+			&change.ConfirmExpiresAt, &change.RevertExpiresAt, &change.ConfirmedAt, &change.RevertedAt)
+		export.EmailChanges = append(export.EmailChanges, change)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.ActionTokens = []models.ActionToken{}
+	err = queryEach(ctx, tx, `SELECT id, user_id, purpose, created_at, expires_at, used_at
+		FROM action_tokens WHERE user_id = $1 ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var token models.ActionToken
+		err := rows.Scan(&token.ID, &token.UserID, &token.Purpose, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+		export.ActionTokens = append(export.ActionTokens, token)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.LoginChallenges = []models.LoginChallenge{}
+	err = queryEach(ctx, tx, `SELECT id, email, user_id, method, attempts, created_at, expires_at, used_at
+		FROM login_challenges WHERE user_id = $1 ORDER BY created_at`, userID, func(rows *sql.Rows) error {
+		var challenge models.LoginChallenge
+		err := rows.Scan(&challenge.ID, &challenge.Email, &challenge.UserID, &challenge.Method, &challenge.Attempts,
+			&challenge.CreatedAt, &challenge.ExpiresAt, &challenge.UsedAt)
+		export.LoginChallenges = append(export.LoginChallenges, challenge)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.AuditEvents = []models.AuditEvent{}
+	err = queryEach(ctx, tx, `SELECT `+auditEventColumns+` FROM audit_events
+		WHERE actor_id = $1 OR target_id = $1 ORDER BY id`, userID, func(rows *sql.Rows) error {
+		var event models.AuditEvent
+		err := scanAuditEvent(rows, &event)
+		export.AuditEvents = append(export.AuditEvents, event)
+		return err
+	})
+	if err != nil {
+		return export, err
+	}
+
+	export.GeneratedAt = time.Now().UTC()
+	return export, tx.Commit()
+}
+
+// queryEach runs a query for one user and calls scan for every row
+func queryEach(ctx context.Context, tx *sql.Tx, query string, userID int, scan func(rows *sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+)
+
+// ErrEmailChangeNotFound is returned for unknown, expired or already used email change links
+var ErrEmailChangeNotFound = errors.New("email change link is invalid or expired")
+
+// EmailChangeRepository handles database operations for email address changes
+type EmailChangeRepository struct {
+	DB *sql.DB
+}
+
+const emailChangeColumns = `id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash,
+	created_at, confirm_expires_at, revert_expires_at, confirmed_at, reverted_at`
+
+func scanEmailChange(row *sql.Row, change *models.EmailChange) error {
+	return row.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.ConfirmTokenHash, &change.RevertTokenHash,
+		&change.CreatedAt, &change.ConfirmExpiresAt, &change.RevertExpiresAt, &change.ConfirmedAt, &change.RevertedAt)
+}
+
+// CreateEmailChange records a requested change, replacing any change the user has pending
+func (repo *EmailChangeRepository) CreateEmailChange(ctx context.Context, change *models.EmailChange) (err error) {
+	query := `INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, revert_token_hash, confirm_expires_at, revert_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "EmailChangeRepository.CreateEmailChange", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1 AND confirmed_at IS NULL AND reverted_at IS NULL`, change.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, change.UserID, change.OldEmail, change.NewEmail, change.ConfirmTokenHash,
+		change.RevertTokenHash, change.ConfirmExpiresAt, change.RevertExpiresAt).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange switches the user to the new address and revokes their sessions.
+// Uniqueness is checked again here since the address may have been taken since the request.
+func (repo *EmailChangeRepository) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (change models.EmailChange, err error) {
+	query := `SELECT ` + emailChangeColumns + ` FROM email_changes
+		WHERE confirm_token_hash = $1 AND confirmed_at IS NULL AND reverted_at IS NULL AND confirm_expires_at > NOW()
+		FOR UPDATE`
+	ctx, span := startSpan(ctx, "EmailChangeRepository.ConfirmEmailChange", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback()
+
+	err = scanEmailChange(tx.QueryRowContext(ctx, query, confirmTokenHash), &change)
+	if errors.Is(err, sql.ErrNoRows) {
+		return change, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return change, err
+	}
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)`, change.NewEmail, change.UserID).Scan(&taken)
+	if err != nil {
+		return change, err
+	}
+	if taken {
+		return change, ErrEmailTaken
+	}
+
+	// The user's address must not have changed in the meantime (e.g. by an admin)
+	result, err := tx.ExecContext(ctx, `UPDATE users SET email = $1, version = version + 1, updated_at = NOW() WHERE id = $2 AND email = $3`,
+		change.NewEmail, change.UserID, change.OldEmail)
+	if isUniqueViolation(err) {
+		return change, ErrEmailTaken
+	}
+	if err != nil {
+		return change, err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return change, ErrEmailChangeNotFound
+	}
+
+	err = tx.QueryRowContext(ctx, `UPDATE email_changes SET confirmed_at = NOW() WHERE id = $1 RETURNING confirmed_at`, change.ID).Scan(&change.ConfirmedAt)
+	if err != nil {
+		return change, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, change.UserID)
+	if err != nil {
+		return change, err
+	}
+
+	err = enqueueWebhookEvent(ctx, tx, models.WebhookUserEmailChanged, webhookUserData{UserID: change.UserID, Email: change.NewEmail})
+	if err != nil {
+		return change, err
+	}
+
+	return change, tx.Commit()
+}
+
+// RevertEmailChange cancels a pending change or restores the old address of a
+// confirmed one, and revokes the user's sessions since the change was not theirs
+func (repo *EmailChangeRepository) RevertEmailChange(ctx context.Context, revertTokenHash string) (change models.EmailChange, err error) {
+	query := `SELECT ` + emailChangeColumns + ` FROM email_changes
+		WHERE revert_token_hash = $1 AND reverted_at IS NULL AND revert_expires_at > NOW()
+		FOR UPDATE`
+	ctx, span := startSpan(ctx, "EmailChangeRepository.RevertEmailChange", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback()
+
+	err = scanEmailChange(tx.QueryRowContext(ctx, query, revertTokenHash), &change)
+	if errors.Is(err, sql.ErrNoRows) {
+		return change, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return change, err
+	}
+
+	if change.ConfirmedAt != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE users SET email = $1, version = version + 1, updated_at = NOW() WHERE id = $2`, change.OldEmail, change.UserID)
+		if isUniqueViolation(err) {
+			return change, ErrEmailTaken
+		}
+		if err != nil {
+			return change, err
+		}
+
+		err = enqueueWebhookEvent(ctx, tx, models.WebhookUserEmailChanged, webhookUserData{UserID: change.UserID, Email: change.OldEmail})
+		if err != nil {
+			return change, err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `UPDATE email_changes SET reverted_at = NOW() WHERE id = $1 RETURNING reverted_at`, change.ID).Scan(&change.RevertedAt)
+	if err != nil {
+		return change, err
+	}
+
+	// Drop any follow-up change still waiting for confirmation
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1 AND confirmed_at IS NULL AND reverted_at IS NULL`, change.UserID)
+	if err != nil {
+		return change, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, change.UserID)
+	if err != nil {
+		return change, err
+	}
+
+	return change, tx.Commit()
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrGroupNameTaken is returned when another group already has the display name
+var ErrGroupNameTaken = errors.New("group display name already taken")
+
+// ErrUnknownMember is returned when a group member is not an existing, unpurged user
+var ErrUnknownMember = errors.New("group member is not a known user")
+
+// GroupRepository handles SCIM groups. A group's members are the users
+// granted the role named after it, so membership lives in user_roles.
+type GroupRepository struct {
+	DB *sql.DB
+}
+
+const groupColumns = `id, display_name, COALESCE(external_id, ''), created_at, updated_at`
+
+func scanGroup(row interface{ Scan(...interface{}) error }) (group models.Group, err error) {
+	err = row.Scan(&group.ID, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt)
+	return group, err
+}
+
+// ListGroups pages through the groups; an empty displayName matches any group
+func (repo *GroupRepository) ListGroups(ctx context.Context, displayName string, limit, offset int) (groups []models.Group, total int, err error) {
+	const where = `WHERE $1 = '' OR display_name = $1`
+	countQuery := `SELECT COUNT(*) FROM scim_groups ` + where
+	countCtx, span := startSpan(ctx, "GroupRepository.CountGroups", countQuery)
+	err = repo.DB.QueryRowContext(countCtx, countQuery, displayName).Scan(&total)
+	endSpan(span, err)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + groupColumns + ` FROM scim_groups ` + where + ` ORDER BY id LIMIT $2 OFFSET $3`
+	ctx, span = startSpan(ctx, "GroupRepository.ListGroups", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, displayName, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, total, rows.Err()
+}
+
+// GetGroup fetches a group by ID
+func (repo *GroupRepository) GetGroup(ctx context.Context, groupID int) (group models.Group, err error) {
+	query := `SELECT ` + groupColumns + ` FROM scim_groups WHERE id = $1`
+	ctx, span := startSpan(ctx, "GroupRepository.GetGroup", query)
+	defer func() { endSpan(span, err) }()
+
+	return scanGroup(repo.DB.QueryRowContext(ctx, query, groupID))
+}
+
+// ListGroupMembers returns the users holding the group's role
+func (repo *GroupRepository) ListGroupMembers(ctx context.Context, displayName string) (members []models.GroupMember, err error) {
+	query := `SELECT u.id, u.name FROM user_roles ur JOIN users u ON u.id = ur.user_id
+		WHERE ur.role = $1 AND u.purged_at IS NULL ORDER BY u.id`
+	ctx, span := startSpan(ctx, "GroupRepository.ListGroupMembers", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, displayName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.GroupMember
+		if err = rows.Scan(&member.UserID, &member.Name); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// ListUserGroups returns the groups whose role the user holds
+func (repo *GroupRepository) ListUserGroups(ctx context.Context, userID int) (groups []models.Group, err error) {
+	query := `SELECT g.id, g.display_name, COALESCE(g.external_id, ''), g.created_at, g.updated_at
+		FROM scim_groups g JOIN user_roles ur ON ur.role = g.display_name
+		WHERE ur.user_id = $1 ORDER BY g.id`
+	ctx, span := startSpan(ctx, "GroupRepository.ListUserGroups", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// CreateGroup creates a group and grants its role to memberIDs. Users who
+// already hold the role stay members: creating a group never revokes a role.
+func (repo *GroupRepository) CreateGroup(ctx context.Context, group *models.Group, memberIDs []int) (err error) {
+	query := `INSERT INTO scim_groups (display_name, external_id) VALUES ($1, NULLIF($2, '')) RETURNING id, created_at, updated_at`
+	ctx, span := startSpan(ctx, "GroupRepository.CreateGroup", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, group.DisplayName, group.ExternalID).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrGroupNameTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = grantGroupRole(ctx, tx, group.DisplayName, memberIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveGroup stores the display name and external ID of a group and makes
+// memberIDs its exact member list. Renaming a group renames its role.
+// Returns sql.ErrNoRows if the group does not exist.
+func (repo *GroupRepository) SaveGroup(ctx context.Context, group *models.Group, memberIDs []int) (err error) {
+	query := `UPDATE scim_groups SET display_name = $2, external_id = NULLIF($3, ''), updated_at = NOW()
+		WHERE id = $1 RETURNING created_at, updated_at`
+	ctx, span := startSpan(ctx, "GroupRepository.SaveGroup", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRowContext(ctx, `SELECT display_name FROM scim_groups WHERE id = $1 FOR UPDATE`, group.ID).Scan(&oldName)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, query, group.ID, group.DisplayName, group.ExternalID).Scan(&group.CreatedAt, &group.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrGroupNameTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	// A renamed group's role moves to the new name; users not in the list lose it
+	if oldName != group.DisplayName {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM user_roles WHERE role = $1`, oldName); err != nil {
+			return err
+		}
+	}
+	if err = grantGroupRole(ctx, tx, group.DisplayName, memberIDs); err != nil {
+		return err
+	}
+	if memberIDs == nil {
+		memberIDs = []int{} // a nil array is NULL and would match nobody
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_roles WHERE role = $1 AND NOT (user_id = ANY($2))`, group.DisplayName, pq.Array(memberIDs))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteGroup deletes a group and revokes its role from every member.
+// Returns sql.ErrNoRows if the group does not exist.
+func (repo *GroupRepository) DeleteGroup(ctx context.Context, groupID int) (displayName string, err error) {
+	query := `DELETE FROM scim_groups WHERE id = $1 RETURNING display_name`
+	ctx, span := startSpan(ctx, "GroupRepository.DeleteGroup", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if err = tx.QueryRowContext(ctx, query, groupID).Scan(&displayName); err != nil {
+		return "", err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_roles WHERE role = $1`, displayName); err != nil {
+		return "", err
+	}
+	return displayName, tx.Commit()
+}
+
+// grantGroupRole grants role to every user in userIDs, failing with
+// ErrUnknownMember if one of them does not exist or was purged
+func grantGroupRole(ctx context.Context, tx *sql.Tx, role string, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	var unknown int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM unnest($1::int[]) AS m(id)
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = m.id AND u.purged_at IS NULL)`, pq.Array(userIDs)).Scan(&unknown)
+	if err != nil {
+		return err
+	}
+	if unknown > 0 {
+		return ErrUnknownMember
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role) SELECT unnest($1::int[]), $2 ON CONFLICT DO NOTHING`, pq.Array(userIDs), role)
+	return err
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+	"time"
+)
+
+// ErrLoginStateInvalid is returned for unknown, expired or already used login states
+var ErrLoginStateInvalid = errors.New("login state is invalid or expired")
+
+// ErrIdentityLinked is returned when the external account is already linked to a user
+var ErrIdentityLinked = errors.New("identity already linked to a user")
+
+// ErrAssertionReplayed is returned when a SAML assertion was already used to log in
+var ErrAssertionReplayed = errors.New("assertion already used")
+
+// ErrLastLoginMethod is returned when unlinking would leave a user without any way to log in
+var ErrLastLoginMethod = errors.New("cannot remove the last way to log in")
+
+// IdentityRepository handles external identities and the logins in progress at their providers
+type IdentityRepository struct {
+	DB *sql.DB
+}
+
+// CreateLoginState stores a login started at a provider
+func (repo *IdentityRepository) CreateLoginState(ctx context.Context, state *models.OIDCLoginState) (err error) {
+	query := `INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, user_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	ctx, span := startSpan(ctx, "IdentityRepository.CreateLoginState", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.UserID, state.ExpiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes and returns a pending login, so a state can only
+// be used once. Returns ErrLoginStateInvalid if it is unknown or expired.
+func (repo *IdentityRepository) ConsumeLoginState(ctx context.Context, provider, stateHash string) (state models.OIDCLoginState, err error) {
+	query := `DELETE FROM oidc_login_states WHERE state_hash = $1 AND provider = $2
+		RETURNING state_hash, provider, code_verifier, nonce, user_id, expires_at, expires_at > NOW()`
+	ctx, span := startSpan(ctx, "IdentityRepository.ConsumeLoginState", query)
+	defer func() { endSpan(span, err) }()
+
+	var valid bool
+	err = repo.DB.QueryRowContext(ctx, query, stateHash, provider).Scan(&state.StateHash, &state.Provider, &state.CodeVerifier, &state.Nonce, &state.UserID, &state.ExpiresAt, &valid)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !valid) {
+		return models.OIDCLoginState{}, ErrLoginStateInvalid
+	}
+	return state, err
+}
+
+// DeleteExpiredLoginStates removes abandoned logins
+func (repo *IdentityRepository) DeleteExpiredLoginStates(ctx context.Context) (deleted int64, err error) {
+	query := `DELETE FROM oidc_login_states WHERE expires_at < NOW()`
+	ctx, span := startSpan(ctx, "IdentityRepository.DeleteExpiredLoginStates", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateSAMLRequest stores a login started at a SAML identity provider
+func (repo *IdentityRepository) CreateSAMLRequest(ctx context.Context, request *models.SAMLRequest) (err error) {
+	query := `INSERT INTO saml_requests (relay_state_hash, idp, request_id, expires_at) VALUES ($1, $2, $3, $4)`
+	ctx, span := startSpan(ctx, "IdentityRepository.CreateSAMLRequest", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, request.RelayStateHash, request.IdP, request.RequestID, request.ExpiresAt)
+	return err
+}
+
+// ConsumeSAMLRequest deletes and returns the unexpired login of the relay state.
+// It returns ErrLoginStateInvalid if there is none.
+func (repo *IdentityRepository) ConsumeSAMLRequest(ctx context.Context, idp, relayStateHash string) (request models.SAMLRequest, err error) {
+	query := `DELETE FROM saml_requests WHERE relay_state_hash = $1 AND idp = $2
+		RETURNING relay_state_hash, idp, request_id, expires_at, expires_at > NOW()`
+	ctx, span := startSpan(ctx, "IdentityRepository.ConsumeSAMLRequest", query)
+	defer func() { endSpan(span, err) }()
+
+	var valid bool
+	err = repo.DB.QueryRowContext(ctx, query, relayStateHash, idp).Scan(&request.RelayStateHash, &request.IdP, &request.RequestID, &request.ExpiresAt, &valid)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !valid) {
+		return models.SAMLRequest{}, ErrLoginStateInvalid
+	}
+	return request, err
+}
+
+// UseAssertion records that an assertion was used to log in, until it
+// expires. It returns ErrAssertionReplayed if it already was.
+func (repo *IdentityRepository) UseAssertion(ctx context.Context, idp, assertionID string, expiresAt time.Time) (err error) {
+	query := `INSERT INTO saml_assertions (idp, assertion_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	ctx, span := startSpan(ctx, "IdentityRepository.UseAssertion", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, idp, assertionID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err == nil && inserted == 0 {
+		return ErrAssertionReplayed
+	}
+	return nil
+}
+
+// DeleteExpiredSAMLRequests deletes abandoned SAML logins and the assertions
+// that can no longer be replayed
+func (repo *IdentityRepository) DeleteExpiredSAMLRequests(ctx context.Context) (deleted int64, err error) {
+	query := `WITH requests AS (DELETE FROM saml_requests WHERE expires_at < NOW() RETURNING 1),
+		assertions AS (DELETE FROM saml_assertions WHERE expires_at < NOW() RETURNING 1)
+		SELECT (SELECT COUNT(*) FROM requests) + (SELECT COUNT(*) FROM assertions)`
+	ctx, span := startSpan(ctx, "IdentityRepository.DeleteExpiredSAMLRequests", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query).Scan(&deleted)
+	return deleted, err
+}
+
+const identityColumns = `id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at`
+
+func scanIdentity(row interface{ Scan(...interface{}) error }) (identity models.UserIdentity, err error) {
+	err = row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	return identity, err
+}
+
+// GetIdentity finds the identity of subject at provider
+func (repo *IdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (identity models.UserIdentity, err error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+	ctx, span := startSpan(ctx, "IdentityRepository.GetIdentity", query)
+	defer func() { endSpan(span, err) }()
+
+	return scanIdentity(repo.DB.QueryRowContext(ctx, query, provider, subject))
+}
+
+// ListUserIdentities returns the identities linked to a user
+func (repo *IdentityRepository) ListUserIdentities(ctx context.Context, userID int) (identities []models.UserIdentity, err error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY id`
+	ctx, span := startSpan(ctx, "IdentityRepository.ListUserIdentities", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+const insertIdentityQuery = `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+	VALUES ($1, $2, $3, NULLIF($4, ''), NOW()) RETURNING id, created_at, last_login_at`
+
+// LinkIdentity links an external account to an existing user. Returns
+// ErrIdentityLinked if it is already linked (to this or another user).
+func (repo *IdentityRepository) LinkIdentity(ctx context.Context, identity *models.UserIdentity) (err error) {
+	ctx, span := startSpan(ctx, "IdentityRepository.LinkIdentity", insertIdentityQuery)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, insertIdentityQuery, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+	if isUniqueViolation(err) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+// CreateUserWithIdentity signs up a user from an external account, without
+// a password. Returns ErrEmailTaken or ErrIdentityLinked on conflicts.
+func (repo *IdentityRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.UserIdentity) (err error) {
+	ctx, span := startSpan(ctx, "IdentityRepository.CreateUserWithIdentity", insertIdentityQuery)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	err = tx.QueryRowContext(ctx, insertIdentityQuery, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+	if isUniqueViolation(err) {
+		return ErrIdentityLinked // linked concurrently by another login
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordIdentityLogin stamps a login through the identity and keeps its email current
+func (repo *IdentityRepository) RecordIdentityLogin(ctx context.Context, identityID int, email string) (err error) {
+	query := `UPDATE user_identities SET last_login_at = NOW(), email = NULLIF($2, '') WHERE id = $1`
+	ctx, span := startSpan(ctx, "IdentityRepository.RecordIdentityLogin", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, identityID, email)
+	return err
+}
+
+// UnlinkIdentity removes one of a user's identities and returns its provider.
+// Returns sql.ErrNoRows if the user has no such identity, and
+// ErrLastLoginMethod if the user has no password and this is their only identity.
+func (repo *IdentityRepository) UnlinkIdentity(ctx context.Context, userID, identityID int) (provider string, err error) {
+	query := `DELETE FROM user_identities WHERE id = $1 AND user_id = $2 RETURNING provider`
+	ctx, span := startSpan(ctx, "IdentityRepository.UnlinkIdentity", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so two concurrent unlinks cannot both pass the check
+	var hasPassword bool
+	err = tx.QueryRowContext(ctx, `SELECT password IS NOT NULL FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&hasPassword)
+	if err != nil {
+		return "", err
+	}
+	if err = tx.QueryRowContext(ctx, query, identityID, userID).Scan(&provider); err != nil {
+		return "", err
+	}
+
+	var remaining int
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1`, userID).Scan(&remaining); err != nil {
+		return "", err
+	}
+	if !hasPassword && remaining == 0 {
+		return "", ErrLastLoginMethod
+	}
+	return provider, tx.Commit()
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+	"strings"
+)
+
+// ErrInviteInvalid is returned for unknown, expired, revoked or already used invite codes
+var ErrInviteInvalid = errors.New("invite code is invalid, expired or already used")
+
+// ErrInviteEmail is returned when the invite code was issued for another email address
+var ErrInviteEmail = errors.New("invite code was issued for another email address")
+
+// InviteRepository handles registration invite codes
+type InviteRepository struct {
+	DB *sql.DB
+}
+
+const inviteCodeColumns = `id, code_hash, email, created_by, created_at, expires_at, used_at, used_by, revoked_at`
+
+func scanInviteCode(scanner interface{ Scan(...interface{}) error }, invite *models.InviteCode) error {
+	return scanner.Scan(&invite.ID, &invite.CodeHash, &invite.Email, &invite.CreatedBy, &invite.CreatedAt,
+		&invite.ExpiresAt, &invite.UsedAt, &invite.UsedBy, &invite.RevokedAt)
+}
+
+// CreateInvite stores a new invite code
+func (repo *InviteRepository) CreateInvite(ctx context.Context, invite *models.InviteCode) (err error) {
+	query := `INSERT INTO invite_codes (code_hash, email, created_by, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "InviteRepository.CreateInvite", query)
+	defer func() { endSpan(span, err) }()
+
+	return repo.DB.QueryRowContext(ctx, query, invite.CodeHash, invite.Email, invite.CreatedBy, invite.ExpiresAt).Scan(&invite.ID, &invite.CreatedAt)
+}
+
+// ListInvites returns every invite code, newest first
+func (repo *InviteRepository) ListInvites(ctx context.Context) (invites []models.InviteCode, err error) {
+	query := `SELECT ` + inviteCodeColumns + ` FROM invite_codes ORDER BY id DESC`
+	ctx, span := startSpan(ctx, "InviteRepository.ListInvites", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites = []models.InviteCode{}
+	for rows.Next() {
+		var invite models.InviteCode
+		if err = scanInviteCode(rows, &invite); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite makes an unused invite code unusable. Returns sql.ErrNoRows if
+// the code does not exist, was used or is already revoked.
+func (repo *InviteRepository) RevokeInvite(ctx context.Context, id int) (err error) {
+	query := `UPDATE invite_codes SET revoked_at = NOW() WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL`
+	ctx, span := startSpan(ctx, "InviteRepository.RevokeInvite", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if revoked, _ := result.RowsAffected(); revoked == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RegisterWithInvite creates the user and uses up the invite code in one
+// transaction, so a code can never admit two accounts
+func (repo *InviteRepository) RegisterWithInvite(ctx context.Context, user *models.User, codeHash string) (err error) {
+	query := `SELECT ` + inviteCodeColumns + ` FROM invite_codes
+		WHERE code_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		FOR UPDATE`
+	ctx, span := startSpan(ctx, "InviteRepository.RegisterWithInvite", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var invite models.InviteCode
+	err = scanInviteCode(tx.QueryRowContext(ctx, query, codeHash), &invite)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInviteInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if invite.Email != nil && !strings.EqualFold(*invite.Email, user.Email) {
+		return ErrInviteEmail
+	}
+
+	if err = insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE invite_codes SET used_at = NOW(), used_by = $2 WHERE id = $1`, invite.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
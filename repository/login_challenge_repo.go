@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+	"time"
+)
+
+// ErrLoginChallengeInvalid is returned for unknown, expired, used or wrong links and codes
+var ErrLoginChallengeInvalid = errors.New("login link or code is invalid or expired")
+
+// LoginChallengeRepository handles passwordless logins in progress
+type LoginChallengeRepository struct {
+	DB *sql.DB
+}
+
+// CreateLoginChallenge stores a challenge and expires the earlier unused ones for the same email
+func (repo *LoginChallengeRepository) CreateLoginChallenge(ctx context.Context, challenge *models.LoginChallenge) (err error) {
+	query := `INSERT INTO login_challenges (email, user_id, method, secret_hash, nonce_hash, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "LoginChallengeRepository.CreateLoginChallenge", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE login_challenges SET expires_at = NOW()
+		WHERE LOWER(email) = LOWER($1) AND used_at IS NULL AND expires_at > NOW()`, challenge.Email)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, challenge.Email, challenge.UserID, challenge.Method, challenge.SecretHash, challenge.NonceHash, challenge.ExpiresAt).
+		Scan(&challenge.ID, &challenge.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountLoginChallenges returns how many challenges were requested for email since a time
+func (repo *LoginChallengeRepository) CountLoginChallenges(ctx context.Context, email string, since time.Time) (count int, err error) {
+	query := `SELECT COUNT(*) FROM login_challenges WHERE LOWER(email) = LOWER($1) AND created_at > $2`
+	ctx, span := startSpan(ctx, "LoginChallengeRepository.CountLoginChallenges", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, email, since).Scan(&count)
+	return count, err
+}
+
+// ConsumeLoginChallenge marks the challenge of the nonce as used if the
+// secret matches and returns it. A wrong secret counts as an attempt, and the
+// challenge is spent after maxAttempts of them.
+func (repo *LoginChallengeRepository) ConsumeLoginChallenge(ctx context.Context, method, nonceHash, secretHash string, maxAttempts int) (challenge models.LoginChallenge, err error) {
+	query := `UPDATE login_challenges SET used_at = NOW()
+		WHERE nonce_hash = $1 AND method = $2 AND secret_hash = $3 AND user_id IS NOT NULL
+			AND used_at IS NULL AND expires_at > NOW() AND attempts < $4
+		RETURNING id, email, user_id, method, secret_hash, nonce_hash, attempts, created_at, expires_at, used_at`
+	ctx, span := startSpan(ctx, "LoginChallengeRepository.ConsumeLoginChallenge", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, nonceHash, method, secretHash, maxAttempts).Scan(
+		&challenge.ID, &challenge.Email, &challenge.UserID, &challenge.Method, &challenge.SecretHash, &challenge.NonceHash,
+		&challenge.Attempts, &challenge.CreatedAt, &challenge.ExpiresAt, &challenge.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = repo.DB.ExecContext(ctx, `UPDATE login_challenges SET attempts = attempts + 1
+			WHERE nonce_hash = $1 AND used_at IS NULL`, nonceHash)
+		if err != nil {
+			return models.LoginChallenge{}, err
+		}
+		return models.LoginChallenge{}, ErrLoginChallengeInvalid
+	}
+	return challenge, err
+}
+
+// DeleteLoginChallenges deletes the challenges created before a time, once
+// they no longer count towards throttling
+func (repo *LoginChallengeRepository) DeleteLoginChallenges(ctx context.Context, before time.Time) (deleted int64, err error) {
+	query := `DELETE FROM login_challenges WHERE created_at < $1 AND expires_at < NOW()`
+	ctx, span := startSpan(ctx, "LoginChallengeRepository.DeleteLoginChallenges", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-auth-app/models"
+	"strings"
+)
+
+// ErrSlugTaken is returned when another organization already uses the slug
+var ErrSlugTaken = errors.New("organization slug already taken")
+
+// ErrLastOwner is returned when a change would leave an organization without an owner
+var ErrLastOwner = errors.New("an organization must keep at least one owner")
+
+// ErrInvitationNotFound is returned for unknown, expired or already accepted invitations
+var ErrInvitationNotFound = errors.New("invitation is invalid or expired")
+
+// ErrInvitationEmail is returned when the invitation was sent to another address
+var ErrInvitationEmail = errors.New("invitation was sent to another email address")
+
+// OrgRepository handles organizations, memberships and invitations
+type OrgRepository struct {
+	DB *sql.DB
+}
+
+// CreateOrganization creates an organization with ownerID as its first owner
+func (repo *OrgRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID int) (err error) {
+	query := `INSERT INTO organizations (name, slug) VALUES ($1, $2) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "OrgRepository.CreateOrganization", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, org.Name, org.Slug).Scan(&org.ID, &org.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO memberships (org_id, user_id, role) VALUES ($1, $2, $3)`, org.ID, ownerID, models.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListUserOrganizations returns the organizations a user belongs to, oldest membership first
+func (repo *OrgRepository) ListUserOrganizations(ctx context.Context, userID int) (orgs []models.UserOrganization, err error) {
+	query := `SELECT o.id, o.name, o.slug, o.created_at, m.role FROM memberships m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1 ORDER BY m.created_at, o.id`
+	ctx, span := startSpan(ctx, "OrgRepository.ListUserOrganizations", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs = []models.UserOrganization{}
+	for rows.Next() {
+		var org models.UserOrganization
+		if err = rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt, &org.Role); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetMembership returns the membership of a user, or sql.ErrNoRows if they are not a member
+func (repo *OrgRepository) GetMembership(ctx context.Context, orgID, userID int) (membership models.Membership, err error) {
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = $1 AND user_id = $2`
+	ctx, span := startSpan(ctx, "OrgRepository.GetMembership", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt)
+	return membership, err
+}
+
+// ListMembers returns the members of an organization
+func (repo *OrgRepository) ListMembers(ctx context.Context, orgID int) (members []models.OrgMember, err error) {
+	query := `SELECT u.id, u.name, u.email, m.role, m.created_at FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 ORDER BY m.created_at, u.id`
+	ctx, span := startSpan(ctx, "OrgRepository.ListMembers", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members = []models.OrgMember{}
+	for rows.Next() {
+		var member models.OrgMember
+		if err = rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes the role of a member. Returns sql.ErrNoRows if the
+// user is not a member, and ErrLastOwner when demoting the only owner.
+func (repo *OrgRepository) UpdateMemberRole(ctx context.Context, orgID, userID int, role string) (err error) {
+	query := `UPDATE memberships SET role = $3 WHERE org_id = $1 AND user_id = $2`
+	ctx, span := startSpan(ctx, "OrgRepository.UpdateMemberRole", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != models.OrgRoleOwner {
+		if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes a user from an organization and switches their
+// sessions out of it. Returns sql.ErrNoRows if the user is not a member, and
+// ErrLastOwner when removing the only owner.
+func (repo *OrgRepository) RemoveMember(ctx context.Context, orgID, userID int) (err error) {
+	query := `DELETE FROM memberships WHERE org_id = $1 AND user_id = $2`
+	ctx, span := startSpan(ctx, "OrgRepository.RemoveMember", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET active_org_id = NULL WHERE user_id = $1 AND active_org_id = $2`, userID, orgID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkNotLastOwner returns ErrLastOwner if userID is the only owner of the
+// organization. The owners are locked so concurrent demotions cannot both pass.
+func checkNotLastOwner(ctx context.Context, tx *sql.Tx, orgID, userID int) error {
+	rows, err := tx.QueryContext(ctx, `SELECT user_id FROM memberships WHERE org_id = $1 AND role = $2 FOR UPDATE`, orgID, models.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	isOwner, owners := false, 0
+	for rows.Next() {
+		var ownerID int
+		if err := rows.Scan(&ownerID); err != nil {
+			return err
+		}
+		owners++
+		isOwner = isOwner || ownerID == userID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if isOwner && owners == 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+const orgInvitationColumns = `id, org_id, email, role, token_hash, invited_by, created_at, expires_at, accepted_at`
+
+func scanOrgInvitation(scanner interface{ Scan(...interface{}) error }, inv *models.OrgInvitation) error {
+	return scanner.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt)
+}
+
+// CreateInvitation records an invitation, replacing any pending one for the same address
+func (repo *OrgRepository) CreateInvitation(ctx context.Context, inv *models.OrgInvitation) (err error) {
+	query := `INSERT INTO org_invitations (org_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "OrgRepository.CreateInvitation", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM org_invitations WHERE org_id = $1 AND LOWER(email) = LOWER($2) AND accepted_at IS NULL`, inv.OrgID, inv.Email)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, inv.OrgID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListPendingInvitations returns the invitations of an organization that can still be accepted
+func (repo *OrgRepository) ListPendingInvitations(ctx context.Context, orgID int) (invitations []models.OrgInvitation, err error) {
+	query := `SELECT ` + orgInvitationColumns + ` FROM org_invitations
+		WHERE org_id = $1 AND accepted_at IS NULL AND expires_at > NOW() ORDER BY id`
+	ctx, span := startSpan(ctx, "OrgRepository.ListPendingInvitations", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations = []models.OrgInvitation{}
+	for rows.Next() {
+		var inv models.OrgInvitation
+		if err = scanOrgInvitation(rows, &inv); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// AcceptInvitation adds the user to the organization of the invitation. The
+// user's email must be the invited address. Users who are already members
+// keep their current role.
+func (repo *OrgRepository) AcceptInvitation(ctx context.Context, tokenHash string, userID int, email string) (inv models.OrgInvitation, err error) {
+	query := `SELECT ` + orgInvitationColumns + ` FROM org_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`
+	ctx, span := startSpan(ctx, "OrgRepository.AcceptInvitation", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	err = scanOrgInvitation(tx.QueryRowContext(ctx, query, tokenHash), &inv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return inv, ErrInvitationNotFound
+	}
+	if err != nil {
+		return inv, err
+	}
+	if !strings.EqualFold(inv.Email, email) {
+		return inv, ErrInvitationEmail
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO memberships (org_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT (org_id, user_id) DO NOTHING`,
+		inv.OrgID, userID, inv.Role)
+	if err != nil {
+		return inv, err
+	}
+
+	err = tx.QueryRowContext(ctx, `UPDATE org_invitations SET accepted_at = NOW(), accepted_by = $2 WHERE id = $1 RETURNING accepted_at`,
+		inv.ID, userID).Scan(&inv.AcceptedAt)
+	if err != nil {
+		return inv, err
+	}
+	return inv, tx.Commit()
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"go-auth-app/models"
+	"time"
+)
+
+// SessionRepository handles database operations for login sessions
+type SessionRepository struct {
+	DB *sql.DB
+}
+
+// CreateSession records a new login and returns its ID. The session starts in
+// the organization the user joined first, if any.
+func (repo *SessionRepository) CreateSession(ctx context.Context, session *models.Session) (err error) {
+	query := `INSERT INTO sessions (user_id, ip_address, user_agent, active_org_id)
+		VALUES ($1, $2, $3, (SELECT org_id FROM memberships WHERE user_id = $1 ORDER BY created_at, org_id LIMIT 1))
+		RETURNING id, created_at, COALESCE(active_org_id, 0)`
+	ctx, span := startSpan(ctx, "SessionRepository.CreateSession", query)
+	defer func() { endSpan(span, err) }()
+
+	return repo.DB.QueryRowContext(ctx, query, session.UserID, session.IPAddress, session.UserAgent).Scan(&session.ID, &session.CreatedAt, &session.ActiveOrgID)
+}
+
+// ActiveOrgID returns the active organization of a session, or 0 when there is
+// none or the user has since left it
+func (repo *SessionRepository) ActiveOrgID(ctx context.Context, sessionID int) (orgID int, err error) {
+	query := `SELECT COALESCE(m.org_id, 0) FROM sessions s
+		LEFT JOIN memberships m ON m.org_id = s.active_org_id AND m.user_id = s.user_id
+		WHERE s.id = $1`
+	ctx, span := startSpan(ctx, "SessionRepository.ActiveOrgID", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, sessionID).Scan(&orgID)
+	return orgID, err
+}
+
+// SetActiveOrg switches the session to an organization the user is a member
+// of, returning sql.ErrNoRows otherwise
+func (repo *SessionRepository) SetActiveOrg(ctx context.Context, sessionID, userID, orgID int) (err error) {
+	query := `UPDATE sessions SET active_org_id = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		AND EXISTS (SELECT 1 FROM memberships WHERE org_id = $3 AND user_id = $2)`
+	ctx, span := startSpan(ctx, "SessionRepository.SetActiveOrg", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, sessionID, userID, orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsSessionActive checks that the session exists, belongs to the user and has not been revoked
+func (repo *SessionRepository) IsSessionActive(ctx context.Context, sessionID, userID int) (active bool, err error) {
+	query := `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL)`
+	ctx, span := startSpan(ctx, "SessionRepository.IsSessionActive", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, sessionID, userID).Scan(&active)
+	return active, err
+}
+
+// SessionCreatedAt returns when an active session of the user started, i.e. when they logged in
+func (repo *SessionRepository) SessionCreatedAt(ctx context.Context, sessionID, userID int) (createdAt time.Time, err error) {
+	query := `SELECT created_at FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	ctx, span := startSpan(ctx, "SessionRepository.SessionCreatedAt", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, sessionID, userID).Scan(&createdAt)
+	return createdAt, err
+}
+
+// RevokeSession revokes one session of a user
+func (repo *SessionRepository) RevokeSession(ctx context.Context, sessionID, userID int) (err error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	ctx, span := startSpan(ctx, "SessionRepository.RevokeSession", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, sessionID, userID)
+	return err
+}
+
+// RevokeUserSessions revokes every active session of a user and returns how many were revoked
+func (repo *SessionRepository) RevokeUserSessions(ctx context.Context, userID int) (revoked int64, err error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	ctx, span := startSpan(ctx, "SessionRepository.RevokeUserSessions", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeOtherSessions revokes every active session of a user except one and returns how many were revoked
+func (repo *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, keepSessionID int) (revoked int64, err error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+	ctx, span := startSpan(ctx, "SessionRepository.RevokeOtherSessions", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, userID, keepSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
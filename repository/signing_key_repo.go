@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"go-auth-app/models"
+	"time"
+)
+
+// SigningKeyRepository handles database operations for JWT signing keys
+type SigningKeyRepository struct {
+	DB *sql.DB
+}
+
+// ListSigningKeys returns every key that can still verify tokens, newest first
+func (repo *SigningKeyRepository) ListSigningKeys(ctx context.Context) (keys []models.SigningKey, err error) {
+	query := `SELECT id, kid, purpose, secret, created_at, activates_at, retired_at FROM signing_keys ORDER BY created_at DESC, id DESC`
+	ctx, span := startSpan(ctx, "SigningKeyRepository.ListSigningKeys", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key models.SigningKey
+		if err = rows.Scan(&key.ID, &key.KID, &key.Purpose, &key.Secret, &key.CreatedAt, &key.ActivatesAt, &key.RetiredAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RotateSigningKey stores a new key for the purpose that starts signing after
+// delay, retires the previous one at the same time, and deletes keys retired
+// for longer than retention (tokens they signed have expired). The delay lets
+// every server load the new key before tokens signed with it reach them.
+func (repo *SigningKeyRepository) RotateSigningKey(ctx context.Context, key *models.SigningKey, delay, retention time.Duration) (err error) {
+	query := `INSERT INTO signing_keys (kid, purpose, secret, activates_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "SigningKeyRepository.RotateSigningKey", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM signing_keys WHERE purpose = $1 AND retired_at < $2`, key.Purpose, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	key.ActivatesAt = time.Now().Add(delay)
+	_, err = tx.ExecContext(ctx, `UPDATE signing_keys SET retired_at = $2 WHERE purpose = $1 AND (retired_at IS NULL OR retired_at > $2)`, key.Purpose, key.ActivatesAt)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.QueryRowContext(ctx, query, key.KID, key.Purpose, key.Secret, key.ActivatesAt).Scan(&key.ID, &key.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -1,54 +1,108 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"go-auth-app/models"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when another user already has the email address
+var ErrEmailTaken = errors.New("email already registered")
+
+// ErrVersionConflict is returned when a user was modified since it was read
+var ErrVersionConflict = errors.New("user was modified concurrently")
+
+// ErrExternalIDTaken is returned when another user already has the SCIM external ID
+var ErrExternalIDTaken = errors.New("external ID already in use")
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 type UserRepository struct {
 	DB *sql.DB
 }
 
 // CreateUser inserts a new user, but first checks if the email already exists
-func (repo *UserRepository) CreateUser(user *models.User) error {
+func (repo *UserRepository) CreateUser(ctx context.Context, user *models.User) (err error) {
 	// Check if email already exists
 	var exists bool
 	queryCheck := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`
-	err := repo.DB.QueryRow(queryCheck, user.Email).Scan(&exists)
+	checkCtx, span := startSpan(ctx, "UserRepository.CheckEmailExists", queryCheck)
+	err = repo.DB.QueryRowContext(checkCtx, queryCheck, user.Email).Scan(&exists)
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
 
 	// If email exists, return an error
 	if exists {
-		return errors.New("email already registered")
+		return ErrEmailTaken
 	}
 
 	// Insert new user if email does not exist
-	queryInsert := `INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING id`
-	err = repo.DB.QueryRow(queryInsert, user.Name, user.Email, user.Password).Scan(&user.ID)
+	ctx, span = startSpan(ctx, "UserRepository.CreateUser", insertUserQuery)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
 	if err != nil {
-		fmt.Println("❌ SQL Error in CreateUser:", err) // 🛑 Debug SQL errors
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+const insertUserQuery = `INSERT INTO users (name, email, password, status, external_id, managed_by_scim, provisioned_by_ldap)
+	VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7) RETURNING id`
 
+// insertUser creates the user row and queues the user.registered webhook in tx
+func insertUser(ctx context.Context, tx *sql.Tx, user *models.User) error {
+	if user.Status == "" {
+		user.Status = models.UserStatusApproved
+	}
+	err := tx.QueryRowContext(ctx, insertUserQuery, user.Name, user.Email, user.Password, user.Status, user.ExternalID, user.ManagedBySCIM, user.ProvisionedByLDAP).Scan(&user.ID)
+	if err != nil && isUniqueViolation(err) {
+		return uniqueUserError(err)
+	}
+	if err != nil {
+		fmt.Println("❌ SQL Error in CreateUser:", err) // 🛑 Debug SQL errors
+		return err
+	}
 
+	return enqueueWebhookEvent(ctx, tx, models.WebhookUserRegistered, webhookUserData{UserID: user.ID, Email: user.Email})
+}
 
-// UserRepository handles database operations for users
-
+// uniqueUserError tells which unique column of users a violation is about
+func uniqueUserError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == "idx_users_external_id" {
+		return ErrExternalIDTaken
+	}
+	return ErrEmailTaken
+}
 
-// GetUserByEmail fetches a user by email
-func (repo *UserRepository) GetUserByID(userID int) (models.User, error) {
-	var user models.User
-	query := `SELECT id, name, email, is_deleted FROM users WHERE id = $1`
-	err := repo.DB.QueryRow(query, userID).Scan(&user.ID, &user.Name, &user.Email, &user.IsDeleted)
+// GetUserByID fetches a user by ID
+func (repo *UserRepository) GetUserByID(ctx context.Context, userID int) (user models.User, err error) {
+	query := `SELECT id, name, email, is_deleted, version, updated_at, deleted_at, purged_at, COALESCE(deactivated_by, ''), status, COALESCE(external_id, ''), managed_by_scim FROM users WHERE id = $1`
+	ctx, span := startSpan(ctx, "UserRepository.GetUserByID", query)
+	defer func() { endSpan(span, err) }()
 
+	err = repo.DB.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Name, &user.Email, &user.IsDeleted, &user.Version, &user.UpdatedAt, &user.DeletedAt, &user.PurgedAt, &user.DeactivatedBy, &user.Status, &user.ExternalID, &user.ManagedBySCIM)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -56,11 +110,12 @@ func (repo *UserRepository) GetUserByID(userID int) (models.User, error) {
 	return user, nil
 }
 
-func (repo *UserRepository) GetUserPasswordByID(userID int) (string, error) {
-	var passwordHash string
-	query := `SELECT password FROM users WHERE id = $1`
-	err := repo.DB.QueryRow(query, userID).Scan(&passwordHash)
+func (repo *UserRepository) GetUserPasswordByID(ctx context.Context, userID int) (passwordHash string, err error) {
+	query := `SELECT COALESCE(password, '') FROM users WHERE id = $1`
+	ctx, span := startSpan(ctx, "UserRepository.GetUserPasswordByID", query)
+	defer func() { endSpan(span, err) }()
 
+	err = repo.DB.QueryRowContext(ctx, query, userID).Scan(&passwordHash)
 	if err != nil {
 		return "", err
 	}
@@ -68,13 +123,13 @@ func (repo *UserRepository) GetUserPasswordByID(userID int) (string, error) {
 	return passwordHash, nil
 }
 
+// GetUserByEmail fetches an active user by email (for authentication)
+func (repo *UserRepository) GetUserByEmail(ctx context.Context, email string) (user models.User, err error) {
+	query := `SELECT id, name, email, COALESCE(password, ''), is_deleted, status, managed_by_scim, provisioned_by_ldap FROM users WHERE email = $1 AND deleted_at IS NULL`
+	ctx, span := startSpan(ctx, "UserRepository.GetUserByEmail", query)
+	defer func() { endSpan(span, err) }()
 
-// GetUserByEmail fetches a user by email (for authentication)
-func (repo *UserRepository) GetUserByEmail(email string) (models.User, error) {
-	var user models.User
-	query := `SELECT id, name, email, password, is_deleted FROM users WHERE email = $1`
-	err := repo.DB.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.IsDeleted)
-
+	err = repo.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.IsDeleted, &user.Status, &user.ManagedBySCIM, &user.ProvisionedByLDAP)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -82,36 +137,98 @@ func (repo *UserRepository) GetUserByEmail(email string) (models.User, error) {
 	return user, nil
 }
 
+// GetDeletedUserByEmail fetches a deleted user that has not been purged yet (for reactivation)
+func (repo *UserRepository) GetDeletedUserByEmail(ctx context.Context, email string) (user models.User, err error) {
+	query := `SELECT id, name, email, COALESCE(password, ''), is_deleted, deleted_at, COALESCE(deactivated_by, ''), status, managed_by_scim, provisioned_by_ldap FROM users WHERE email = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL`
+	ctx, span := startSpan(ctx, "UserRepository.GetDeletedUserByEmail", query)
+	defer func() { endSpan(span, err) }()
 
-func (repo *UserRepository) UpdateUser(user models.User) error {
-	query := `UPDATE users SET name = $1 WHERE id = $2`
-	_, err := repo.DB.Exec(query, user.Name, user.ID)
-	return err
+	err = repo.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.IsDeleted, &user.DeletedAt, &user.DeactivatedBy, &user.Status, &user.ManagedBySCIM, &user.ProvisionedByLDAP)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
 }
 
+// EmailExists checks whether any user, active or deleted, has the email address
+func (repo *UserRepository) EmailExists(ctx context.Context, email string) (exists bool, err error) {
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`
+	ctx, span := startSpan(ctx, "UserRepository.EmailExists", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, email).Scan(&exists)
+	return exists, err
+}
 
-func (repo *UserRepository) SoftDeleteUser(userID int) error {
-	query := `UPDATE users SET is_deleted = TRUE WHERE id = $1`
-	_, err := repo.DB.Exec(query, userID)
+// UpdateUser saves the editable fields if the user is still at user.Version,
+// then bumps user.Version and user.UpdatedAt. Returns ErrVersionConflict otherwise.
+func (repo *UserRepository) UpdateUser(ctx context.Context, user *models.User) (err error) {
+	query := `UPDATE users SET name = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND version = $3 RETURNING version, updated_at`
+	ctx, span := startSpan(ctx, "UserRepository.UpdateUser", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, user.Name, user.ID, user.Version).Scan(&user.Version, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrVersionConflict
+	}
 	return err
 }
 
+// SoftDeleteUser deactivates a user, starting the reactivation grace period,
+// and revokes their sessions in the same transaction. deactivatedBy is one of
+// the models.DeactivatedBy values; only self-deleted accounts can be
+// reactivated by their user.
+func (repo *UserRepository) SoftDeleteUser(ctx context.Context, userID int, deactivatedBy string) (err error) {
+	query := `UPDATE users SET is_deleted = TRUE, deleted_at = COALESCE(deleted_at, NOW()), deactivated_by = $2, version = version + 1, updated_at = NOW() WHERE id = $1`
+	ctx, span := startSpan(ctx, "UserRepository.SoftDeleteUser", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, deactivatedBy)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return sql.ErrNoRows
+	}
 
-// GetUsersWithPagination retrieves users with pagination
-func (repo *UserRepository) GetUsersWithPagination(limit, offset int) ([]models.User, int, error) {
-	var users []models.User
-	var totalUsers int
+	// Sign the account out everywhere
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
 
+	if err = enqueueWebhookEvent(ctx, tx, models.WebhookUserDeactivated, webhookUserData{UserID: userID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetUsersWithPagination retrieves the members of an organization with pagination
+func (repo *UserRepository) GetUsersWithPagination(ctx context.Context, orgID, limit, offset int) (users []models.User, totalUsers int, err error) {
 	// Query to get total users count (excluding deleted users)
-	countQuery := `SELECT COUNT(*) FROM users WHERE is_deleted = FALSE`
-	err := repo.DB.QueryRow(countQuery).Scan(&totalUsers)
+	countQuery := `SELECT COUNT(*) FROM users JOIN memberships m ON m.user_id = users.id WHERE m.org_id = $1 AND is_deleted = FALSE`
+	countCtx, span := startSpan(ctx, "UserRepository.CountUsers", countQuery)
+	err = repo.DB.QueryRowContext(countCtx, countQuery, orgID).Scan(&totalUsers)
+	endSpan(span, err)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Query to get paginated users (excluding deleted users)
-	query := `SELECT id, name, email FROM users WHERE is_deleted = FALSE ORDER BY id ASC LIMIT $1 OFFSET $2`
-	rows, err := repo.DB.Query(query, limit, offset)
+	query := `SELECT id, name, email FROM users JOIN memberships m ON m.user_id = users.id
+		WHERE m.org_id = $1 AND is_deleted = FALSE ORDER BY id ASC LIMIT $2 OFFSET $3`
+	ctx, span = startSpan(ctx, "UserRepository.GetUsersWithPagination", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, orgID, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -120,19 +237,495 @@ func (repo *UserRepository) GetUsersWithPagination(limit, offset int) ([]models.
 	// Parse users
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email)
+		err = rows.Scan(&user.ID, &user.Name, &user.Email)
 		if err != nil {
 			return nil, 0, err
 		}
 		users = append(users, user)
 	}
 
-	return users, totalUsers, nil
+	return users, totalUsers, rows.Err()
 }
 
-
-func (repo *UserRepository) UpdateUserPassword(userID int, newPassword string) error {
+func (repo *UserRepository) UpdateUserPassword(ctx context.Context, userID int, newPassword string) (err error) {
 	query := `UPDATE users SET password = $1 WHERE id = $2`
-	_, err := repo.DB.Exec(query, newPassword, userID)
+	ctx, span := startSpan(ctx, "UserRepository.UpdateUserPassword", query)
+	defer func() { endSpan(span, err) }()
+
+	return repo.execWithWebhookEvent(ctx, query, []interface{}{newPassword, userID}, models.WebhookUserPasswordChanged, userID)
+}
+
+// RestoreUser reactivates a soft-deleted user. Purged accounts cannot be
+// restored and return sql.ErrNoRows.
+func (repo *UserRepository) RestoreUser(ctx context.Context, userID int) (err error) {
+	query := `UPDATE users SET is_deleted = FALSE, deleted_at = NULL, deactivated_by = NULL, version = version + 1, updated_at = NOW() WHERE id = $1 AND purged_at IS NULL`
+	ctx, span := startSpan(ctx, "UserRepository.RestoreUser", query)
+	defer func() { endSpan(span, err) }()
+
+	return repo.execWithWebhookEvent(ctx, query, []interface{}{userID}, models.WebhookUserReactivated, userID)
+}
+
+// execWithWebhookEvent runs a single-user update and queues the webhook event
+// describing it in the same transaction. Returns sql.ErrNoRows when nothing
+// was updated, in which case no event is queued.
+func (repo *UserRepository) execWithWebhookEvent(ctx context.Context, query string, args []interface{}, eventType string, userID int) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := enqueueWebhookEvent(ctx, tx, eventType, webhookUserData{UserID: userID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeDeletedUsers permanently removes the accounts deleted before cutoff. With
+// anonymize the rows are kept (so references stay valid) but stripped of personal
+// data and credentials; otherwise they are deleted along with everything they own.
+// Accounts that audit events refer to are always anonymized, since the audit log
+// cannot be modified.
+func (repo *UserRepository) PurgeDeletedUsers(ctx context.Context, cutoff time.Time, anonymize bool) (purged int64, err error) {
+	query := `DELETE FROM users WHERE deleted_at < $1 AND purged_at IS NULL`
+	ctx, span := startSpan(ctx, "UserRepository.PurgeDeletedUsers", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	condition := `deleted_at < $1`
+	if !anonymize {
+		condition += ` AND EXISTS (SELECT 1 FROM audit_events WHERE actor_id = users.id OR target_id = users.id)`
+	}
+	userIDs, err := anonymizeUsers(ctx, tx, condition, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	purged = int64(len(userIDs))
+
+	if !anonymize {
+		// Memberships go with the rows, so organizations are handed over first
+		var doomedIDs []int64
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM users WHERE deleted_at < $1 AND purged_at IS NULL FOR UPDATE`, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			doomedIDs = append(doomedIDs, id)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+		if err = handOverOrganizations(ctx, tx, doomedIDs); err != nil {
+			return 0, err
+		}
+
+		rows, err = tx.QueryContext(ctx, query+` RETURNING id, LOWER(email)`, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		var deletedIDs []int64
+		var emails []string
+		for rows.Next() {
+			var id int64
+			var email string
+			if err = rows.Scan(&id, &email); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			deletedIDs = append(deletedIDs, id)
+			emails = append(emails, email)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+		if err = scrubUserEmails(ctx, tx, deletedIDs, emails); err != nil {
+			return 0, err
+		}
+		for _, id := range deletedIDs {
+			if err = enqueueWebhookEvent(ctx, tx, models.WebhookUserErased, webhookUserData{UserID: int(id)}); err != nil {
+				return 0, err
+			}
+		}
+		purged += int64(len(deletedIDs))
+	}
+
+	return purged, tx.Commit()
+}
+
+// EraseUser anonymizes a user right away, without the deletion grace period
+// (right to erasure). Already purged accounts return sql.ErrNoRows.
+func (repo *UserRepository) EraseUser(ctx context.Context, userID int) (err error) {
+	query := anonymizeUsersQuery + `id = $1`
+	ctx, span := startSpan(ctx, "UserRepository.EraseUser", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userIDs, err := anonymizeUsers(ctx, tx, `id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// anonymizeUsersQuery strips personal data and credentials from the users
+// matching the condition appended to it, keeping their rows and IDs
+const anonymizeUsersQuery = `UPDATE users SET name = 'Deleted user', email = 'deleted-' || id || '@invalid', password = NULL, external_id = NULL,
+	is_deleted = TRUE, deleted_at = COALESCE(deleted_at, NOW()), purged_at = NOW(), version = version + 1, updated_at = NOW()
+	WHERE purged_at IS NULL AND `
+
+// anonymizeUsers anonymizes the matching users and the personal data they own
+// in other tables. Rows that records may point at (users, sessions, audit
+// events) are scrubbed rather than deleted, so references to them stay valid.
+func anonymizeUsers(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) ([]int64, error) {
+	// The addresses are read first: other tables refer to the user by email only
+	rows, err := tx.QueryContext(ctx, `SELECT id, LOWER(email) FROM users WHERE purged_at IS NULL AND `+condition+` FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []int64
+	var emails []string
+	for rows.Next() {
+		var id int64
+		var email string
+		if err = rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, anonymizeUsersQuery+`id = ANY($1)`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions keep their timestamps but lose the IP address and user agent
+	_, err = tx.ExecContext(ctx, `UPDATE sessions SET ip_address = NULL, user_agent = NULL, revoked_at = COALESCE(revoked_at, NOW())
+		WHERE user_id = ANY($1)`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	// The audit trail stays, minus where the user connected from
+	_, err = tx.ExecContext(ctx, `UPDATE audit_events SET ip_address = NULL, user_agent = NULL
+		WHERE (actor_id = ANY($1) OR (actor_id IS NULL AND target_id = ANY($1)))
+		AND (ip_address IS NOT NULL OR user_agent IS NOT NULL)`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = handOverOrganizations(ctx, tx, userIDs); err != nil {
+		return nil, err
+	}
+
+	// Roles, memberships, email changes (old and new addresses), linked identities and tokens are of no use once the account is gone
+	for _, table := range []string{"user_roles", "memberships", "email_changes", "action_tokens", "user_identities", "oidc_login_states", "login_challenges"} {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ANY($1)`, pq.Array(userIDs))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = scrubUserEmails(ctx, tx, userIDs, emails); err != nil {
+		return nil, err
+	}
+	for _, id := range userIDs {
+		if err = enqueueWebhookEvent(ctx, tx, models.WebhookUserErased, webhookUserData{UserID: int(id)}); err != nil {
+			return nil, err
+		}
+	}
+
+	return userIDs, nil
+}
+
+// handOverOrganizations keeps the organizations of users about to be erased
+// or purged administrable. Where they are the only owners, the
+// longest-standing active admin (or else member) becomes owner; organizations
+// they are the only members of are deleted.
+func handOverOrganizations(ctx context.Context, tx *sql.Tx, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM organizations o
+		WHERE EXISTS (SELECT 1 FROM memberships WHERE org_id = o.id AND user_id = ANY($1))
+		AND NOT EXISTS (SELECT 1 FROM memberships WHERE org_id = o.id AND user_id <> ALL($1))`, pq.Array(userIDs))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE memberships m SET role = $2 FROM (
+			SELECT DISTINCT ON (heir.org_id) heir.org_id, heir.user_id
+			FROM memberships heir JOIN users u ON u.id = heir.user_id
+			WHERE heir.user_id <> ALL($1)
+			AND heir.org_id IN (SELECT org_id FROM memberships WHERE user_id = ANY($1) AND role = $2)
+			AND NOT EXISTS (SELECT 1 FROM memberships o WHERE o.org_id = heir.org_id AND o.role = $2 AND o.user_id <> ALL($1))
+			ORDER BY heir.org_id, u.deleted_at IS NOT NULL, heir.role <> $3, heir.created_at, heir.user_id
+		) h WHERE m.org_id = h.org_id AND m.user_id = h.user_id`, pq.Array(userIDs), models.OrgRoleOwner, models.OrgRoleAdmin)
 	return err
 }
+
+// scrubUserEmails removes the addresses of erased or deleted users from the
+// tables that refer to them by email rather than by ID. Invitations and
+// passwordless challenges are deleted; invite codes lose the address, and
+// unused ones are revoked rather than left open to anyone. Webhook events
+// keep the user ID but not the address, delivered or not.
+func scrubUserEmails(ctx context.Context, tx *sql.Tx, userIDs []int64, emails []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM org_invitations WHERE LOWER(email) = ANY($1)`, pq.Array(emails))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_challenges WHERE LOWER(email) = ANY($1)`, pq.Array(emails))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE invite_codes SET email = NULL,
+		revoked_at = CASE WHEN used_at IS NULL THEN COALESCE(revoked_at, NOW()) ELSE revoked_at END
+		WHERE LOWER(email) = ANY($1)`, pq.Array(emails))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE webhook_outbox SET payload = payload - 'email'
+		WHERE payload ? 'email' AND (payload->>'user_id')::int = ANY($1)`, pq.Array(userIDs))
+	return err
+}
+
+// GrantRole gives a user a role (granting an existing role is a no-op)
+func (repo *UserRepository) GrantRole(ctx context.Context, userID int, role string) (err error) {
+	query := `INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	ctx, span := startSpan(ctx, "UserRepository.GrantRole", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, userID, role)
+	return err
+}
+
+// SyncRoles grants roles to a user and revokes the managed roles missing from
+// roles. Roles outside managed are left alone, so roles granted by other
+// means survive. Returns what actually changed.
+func (repo *UserRepository) SyncRoles(ctx context.Context, userID int, roles, managed []string) (granted, revoked []string, err error) {
+	query := `INSERT INTO user_roles (user_id, role) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING RETURNING role`
+	ctx, span := startSpan(ctx, "UserRepository.SyncRoles", query)
+	defer func() { endSpan(span, err) }()
+
+	// A nil array is NULL and would match nothing
+	if roles == nil {
+		roles = []string{}
+	}
+	if managed == nil {
+		managed = []string{}
+	}
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if granted, err = queryRoles(ctx, tx, query, userID, pq.Array(roles)); err != nil {
+		return nil, nil, err
+	}
+	revoked, err = queryRoles(ctx, tx, `DELETE FROM user_roles WHERE user_id = $1 AND role = ANY($2) AND NOT (role = ANY($3)) RETURNING role`,
+		userID, pq.Array(managed), pq.Array(roles))
+	if err != nil {
+		return nil, nil, err
+	}
+	return granted, revoked, tx.Commit()
+}
+
+func queryRoles(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (roles []string, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// GetUserRoles lists the roles granted to a user
+func (repo *UserRepository) GetUserRoles(ctx context.Context, userID int) (roles []string, err error) {
+	query := `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+	ctx, span := startSpan(ctx, "UserRepository.GetUserRoles", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// HasRole checks whether a user has been granted a role
+func (repo *UserRepository) HasRole(ctx context.Context, userID int, role string) (hasRole bool, err error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_roles WHERE user_id = $1 AND role = $2)`
+	ctx, span := startSpan(ctx, "UserRepository.HasRole", query)
+	defer func() { endSpan(span, err) }()
+
+	err = repo.DB.QueryRowContext(ctx, query, userID, role).Scan(&hasRole)
+	return hasRole, err
+}
+
+// ListPendingUsers returns the accounts waiting for approval, oldest first
+func (repo *UserRepository) ListPendingUsers(ctx context.Context) (users []models.User, err error) {
+	query := `SELECT id, name, email, status FROM users WHERE status = 'pending' AND deleted_at IS NULL ORDER BY id`
+	ctx, span := startSpan(ctx, "UserRepository.ListPendingUsers", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Status); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// DecideRegistration approves or rejects a pending account. Returns
+// sql.ErrNoRows if the user is not pending.
+func (repo *UserRepository) DecideRegistration(ctx context.Context, userID int, status string) (err error) {
+	query := `UPDATE users SET status = $2, version = version + 1, updated_at = NOW() WHERE id = $1 AND status = 'pending'`
+	ctx, span := startSpan(ctx, "UserRepository.DecideRegistration", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, userID, status)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListProvisionedUsers pages through every account that has not been purged,
+// deactivated ones included, for SCIM. Empty userName and externalID match any user.
+func (repo *UserRepository) ListProvisionedUsers(ctx context.Context, userName, externalID string, limit, offset int) (users []models.User, total int, err error) {
+	const where = `WHERE purged_at IS NULL AND ($1 = '' OR LOWER(email) = LOWER($1)) AND ($2 = '' OR external_id = $2)`
+	countQuery := `SELECT COUNT(*) FROM users ` + where
+	countCtx, span := startSpan(ctx, "UserRepository.CountProvisionedUsers", countQuery)
+	err = repo.DB.QueryRowContext(countCtx, countQuery, userName, externalID).Scan(&total)
+	endSpan(span, err)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, name, email, is_deleted, version, updated_at, COALESCE(external_id, '') FROM users ` + where + ` ORDER BY id LIMIT $3 OFFSET $4`
+	ctx, span = startSpan(ctx, "UserRepository.ListProvisionedUsers", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, userName, externalID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.IsDeleted, &user.Version, &user.UpdatedAt, &user.ExternalID); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// UpdateProvisionedUser saves the name, email and external ID sent by the
+// identity provider and marks the account as managed by it. The identity
+// provider owns the address, so it changes without the confirmation flow;
+// subscribers still get user.email_changed.
+func (repo *UserRepository) UpdateProvisionedUser(ctx context.Context, user *models.User) (err error) {
+	query := `UPDATE users u SET name = $2, email = $3, external_id = NULLIF($4, ''), managed_by_scim = TRUE, version = u.version + 1, updated_at = NOW()
+		FROM users old WHERE u.id = $1 AND old.id = u.id AND u.purged_at IS NULL
+		RETURNING u.version, u.updated_at, old.email`
+	ctx, span := startSpan(ctx, "UserRepository.UpdateProvisionedUser", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldEmail string
+	err = tx.QueryRowContext(ctx, query, user.ID, user.Name, user.Email, user.ExternalID).Scan(&user.Version, &user.UpdatedAt, &oldEmail)
+	if err != nil && isUniqueViolation(err) {
+		return uniqueUserError(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if oldEmail != user.Email {
+		err = enqueueWebhookEvent(ctx, tx, models.WebhookUserEmailChanged, webhookUserData{UserID: user.ID, Email: user.Email})
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	user.ManagedBySCIM = true
+	return nil
+}
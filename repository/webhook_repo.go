@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-auth-app/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrWebhookNotFound is returned for unknown or deleted subscriptions and deliveries
+var ErrWebhookNotFound = errors.New("webhook subscription or delivery not found")
+
+// WebhookRepository handles webhook subscriptions, the outbox and deliveries
+type WebhookRepository struct {
+	DB *sql.DB
+}
+
+// webhookUserData is the data of every user lifecycle event
+type webhookUserData struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email,omitempty"`
+}
+
+// enqueueWebhookEvent adds an event to the outbox. It takes the transaction of
+// the change the event describes, so the event exists if and only if the
+// change was committed.
+func enqueueWebhookEvent(ctx context.Context, tx *sql.Tx, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO webhook_outbox (event_id, event_type, payload)
+		VALUES (REPLACE(gen_random_uuid()::text, '-', ''), $1, $2)`, eventType, payload)
+	return err
+}
+
+// CreateSubscription adds an endpoint that receives the given event types (all when empty)
+func (repo *WebhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) (err error) {
+	query := `INSERT INTO webhook_subscriptions (url, secret, event_types, description) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	ctx, span := startSpan(ctx, "WebhookRepository.CreateSubscription", query)
+	defer func() { endSpan(span, err) }()
+
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	return repo.DB.QueryRowContext(ctx, query, sub.URL, sub.Secret, pq.Array(sub.EventTypes), sub.Description).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// ListSubscriptions returns the subscriptions that have not been deleted
+func (repo *WebhookRepository) ListSubscriptions(ctx context.Context) (subs []models.WebhookSubscription, err error) {
+	query := `SELECT id, url, event_types, description, created_at FROM webhook_subscriptions WHERE deleted_at IS NULL ORDER BY id`
+	ctx, span := startSpan(ctx, "WebhookRepository.ListSubscriptions", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs = []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err = rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.Description, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteSubscription stops deliveries to a subscription. Its delivery history
+// is kept; deliveries still pending are dead-lettered.
+func (repo *WebhookRepository) DeleteSubscription(ctx context.Context, id int) (err error) {
+	query := `UPDATE webhook_subscriptions SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	ctx, span := startSpan(ctx, "WebhookRepository.DeleteSubscription", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrWebhookNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE webhook_deliveries SET status = 'dead', last_error = 'subscription deleted'
+		WHERE subscription_id = $1 AND status = 'pending'`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const webhookDeliveryColumns = `d.id, d.subscription_id, o.event_id, o.event_type, d.status, d.attempts, d.next_attempt_at,
+	d.last_status_code, COALESCE(d.last_error, ''), d.created_at, d.delivered_at`
+
+// ListDeliveries returns the latest deliveries of a subscription, optionally only those with a status
+func (repo *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID int, status string, limit int) (deliveries []models.WebhookDelivery, err error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d JOIN webhook_outbox o ON o.id = d.outbox_id
+		WHERE d.subscription_id = $1 AND ($2 = '' OR d.status = $2) ORDER BY d.id DESC LIMIT $3`
+	ctx, span := startSpan(ctx, "WebhookRepository.ListDeliveries", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, subscriptionID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries = []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err = rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryDelivery puts a dead-lettered delivery back in the queue with a fresh set of attempts
+func (repo *WebhookRepository) RetryDelivery(ctx context.Context, subscriptionID int, deliveryID int64) (err error) {
+	query := `UPDATE webhook_deliveries d SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		FROM webhook_subscriptions s
+		WHERE d.id = $1 AND d.subscription_id = $2 AND d.status = 'dead' AND s.id = d.subscription_id AND s.deleted_at IS NULL`
+	ctx, span := startSpan(ctx, "WebhookRepository.RetryDelivery", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, deliveryID, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if retried, _ := result.RowsAffected(); retried == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// FanOutEvents turns up to limit outbox events into one pending delivery per
+// matching subscription, and returns how many events were processed
+func (repo *WebhookRepository) FanOutEvents(ctx context.Context, limit int) (events int, err error) {
+	query := `SELECT id FROM webhook_outbox WHERE dispatched_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`
+	ctx, span := startSpan(ctx, "WebhookRepository.FanOutEvents", query)
+	defer func() { endSpan(span, err) }()
+
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	var outboxIDs []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		outboxIDs = append(outboxIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(outboxIDs) == 0 {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO webhook_deliveries (subscription_id, outbox_id)
+		SELECT s.id, o.id FROM webhook_outbox o
+		JOIN webhook_subscriptions s ON s.deleted_at IS NULL AND (s.event_types = '{}' OR o.event_type = ANY(s.event_types))
+		WHERE o.id = ANY($1)
+		ON CONFLICT DO NOTHING`, pq.Array(outboxIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE webhook_outbox SET dispatched_at = NOW() WHERE id = ANY($1)`, pq.Array(outboxIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(outboxIDs), tx.Commit()
+}
+
+// PruneEvents deletes the events dispatched before cutoff that have no pending
+// delivery left, together with their delivered and dead-lettered deliveries,
+// and returns how many events were deleted
+func (repo *WebhookRepository) PruneEvents(ctx context.Context, cutoff time.Time) (pruned int64, err error) {
+	query := `DELETE FROM webhook_outbox o WHERE o.dispatched_at < $1
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.outbox_id = o.id AND d.status = 'pending')`
+	ctx, span := startSpan(ctx, "WebhookRepository.PruneEvents", query)
+	defer func() { endSpan(span, err) }()
+
+	result, err := repo.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClaimedDelivery is a due delivery with everything needed to send it
+type ClaimedDelivery struct {
+	ID       int64
+	Attempts int // attempts made before this one
+	URL      string
+	Secret   string
+	Event    models.WebhookEvent
+}
+
+// ClaimDueDeliveries picks up to limit pending deliveries whose next attempt is
+// due and pushes that attempt lease into the future, so that other dispatchers
+// skip them while they are being sent. A dispatcher that dies mid-delivery
+// only delays the retry until the lease expires.
+func (repo *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (claimed []ClaimedDelivery, err error) {
+	query := `WITH claimed AS (
+			UPDATE webhook_deliveries SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+			WHERE id IN (
+				SELECT d.id FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.deleted_at IS NULL
+				ORDER BY d.next_attempt_at LIMIT $1 FOR UPDATE OF d SKIP LOCKED)
+			RETURNING id, subscription_id, outbox_id, attempts)
+		SELECT c.id, c.attempts, s.url, s.secret, o.event_id, o.event_type, o.created_at, o.payload
+		FROM claimed c
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		JOIN webhook_outbox o ON o.id = c.outbox_id`
+	ctx, span := startSpan(ctx, "WebhookRepository.ClaimDueDeliveries", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := repo.DB.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c ClaimedDelivery
+		var payload []byte
+		err = rows.Scan(&c.ID, &c.Attempts, &c.URL, &c.Secret, &c.Event.ID, &c.Event.Type, &c.Event.CreatedAt, &payload)
+		if err != nil {
+			return nil, err
+		}
+		c.Event.Data = payload
+		claimed = append(claimed, c)
+	}
+	return claimed, rows.Err()
+}
+
+// MarkDelivered records a successful attempt
+func (repo *WebhookRepository) MarkDelivered(ctx context.Context, deliveryID int64, statusCode int) (err error) {
+	query := `UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_status_code = $2,
+		last_error = NULL, delivered_at = NOW() WHERE id = $1`
+	ctx, span := startSpan(ctx, "WebhookRepository.MarkDelivered", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, deliveryID, statusCode)
+	return err
+}
+
+// MarkFailed records a failed attempt (statusCode is 0 when there was no
+// response) and schedules the next one at retryAt, or dead-letters the delivery
+// when retryAt is nil
+func (repo *WebhookRepository) MarkFailed(ctx context.Context, deliveryID int64, statusCode int, reason string, retryAt *time.Time) (err error) {
+	query := `UPDATE webhook_deliveries SET attempts = attempts + 1, last_status_code = NULLIF($2, 0), last_error = $3,
+		status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		next_attempt_at = COALESCE($4, next_attempt_at) WHERE id = $1`
+	ctx, span := startSpan(ctx, "WebhookRepository.MarkFailed", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = repo.DB.ExecContext(ctx, query, deliveryID, statusCode, reason, retryAt)
+	return err
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"go-auth-app/handlers"
+	"go-auth-app/middleware"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Legacy unversioned paths are deprecated in favour of /v1 and removed after the sunset date
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// registerLegacy registers the pre-versioning paths as deprecated aliases of
+// their v1 handlers. The set is frozen: new endpoints are only added under /v1.
+func registerLegacy(r *mux.Router) {
+	r.Use(middleware.Deprecated(legacyDeprecatedAt, legacySunset, "/v1"))
+
+	r.HandleFunc("/register", handlers.RegisterUser).Methods("POST")
+	r.HandleFunc("/login", handlers.LoginUser).Methods("POST")
+	r.HandleFunc("/refresh", handlers.RefreshToken).Methods("POST")
+
+	protected := r.PathPrefix("/users").Subrouter()
+	protected.Use(middleware.JWTMiddleware)
+	protected.Handle("", middleware.OrgScope(http.HandlerFunc(handlers.GetAllUsers))).Methods("GET")
+	protected.HandleFunc("/me", handlers.GetUserDetails).Methods("GET")
+	protected.HandleFunc("/me", handlers.PatchUser).Methods("PATCH")
+	protected.HandleFunc("/me/update", handlers.UpdateUser).Methods("PATCH")
+	protected.HandleFunc("/me/deactivate", handlers.DeleteUser).Methods("DELETE")
+	protected.HandleFunc("/me/reset-password", handlers.ResetPassword).Methods("POST")
+}
@@ -1,31 +1,91 @@
 package routes
 
 import (
+	"go-auth-app/apierror"
+	"go-auth-app/config"
 	"go-auth-app/handlers"
 	"go-auth-app/middleware"
+	"go-auth-app/openapi"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func SetupRoutes() {
+// apiVersion mounts one version of the API under its path prefix. A new
+// version gets its own register function that reuses the handlers whose
+// request/response shapes did not change and registers new ones for those
+// that did, so older versions keep working untouched.
+type apiVersion struct {
+	prefix   string
+	register func(r *mux.Router, prefix string)
+}
+
+var apiVersions = []apiVersion{
+	{prefix: "/v1", register: registerV1},
+}
+
+// SetupRoutes builds the application handler: the router plus request-wide middleware
+func SetupRoutes() http.Handler {
+	r := NewRouter()
+
+	// Every request gets a server span (continuing any incoming W3C trace context),
+	// a request ID, and panics are turned into 500 problems. Security headers
+	// and CORS apply to every response, CORS preflights are answered before routing.
+	return otelhttp.NewHandler(middleware.RequestID(middleware.Recover(middleware.SecurityHeaders(middleware.CORS(r)))), "http.server")
+}
+
+// NewRouter registers every route; tests walk it to check the OpenAPI document is complete
+func NewRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(nameSpanAfterRoute)
+
+	// In test mode every routed request and response is checked against the spec
+	if config.Get().Database.TestMode {
+		r.Use(openapi.ValidationMiddleware)
+	}
 
-	// Public Routes (No Authentication Required)
-	r.HandleFunc("/register", handlers.RegisterUser).Methods("POST")
-	r.HandleFunc("/login", handlers.LoginUser).Methods("POST")
-	r.HandleFunc("/refresh", handlers.RefreshToken).Methods("POST")
-
-	// Protected Routes (Require JWT)
-	protected := r.PathPrefix("/users").Subrouter()
-	protected.Use(middleware.JWTMiddleware) // Apply JWT middleware to all /users routes
-	protected.HandleFunc("", handlers.GetAllUsers).Methods("GET")
-	// ✅ Separate Routes for Different Actions
-	protected.HandleFunc("/me", handlers.GetUserDetails).Methods("GET")      // Fetch user details
-	protected.HandleFunc("/me/update", handlers.UpdateUser).Methods("PATCH")       // Update user details
-	protected.HandleFunc("/me/deactivate", handlers.DeleteUser).Methods("DELETE")   // Soft delete user
-	protected.HandleFunc("/me/reset-password", handlers.ResetPassword).Methods("POST")
-	// Start HTTP server
-	http.Handle("/", r)
+	// Unknown routes and methods get the same problem+json errors as handlers
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, apierror.NotFound, "No route matches "+r.URL.Path)
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, apierror.MethodNotAllowed, r.Method+" is not supported on "+r.URL.Path)
+	})
+
+	// Health Probes (used by the orchestrator, never authenticated)
+	r.HandleFunc("/healthz", handlers.Healthz).Methods("GET")
+	r.HandleFunc("/readyz", handlers.Readyz).Methods("GET")
+
+	// API Description
+	r.HandleFunc("/openapi.json", openapi.ServeSpec).Methods("GET")
+	r.HandleFunc("/docs", openapi.ServeDocs).Methods("GET")
+
+	// Versioned API, e.g. /v1/login. Each version gets a matcher-less subrouter
+	// (for its own middleware) and spells the prefix out in its paths: routes
+	// nested under a PathPrefix subrouter report 404 instead of 405 for a wrong method
+	for _, version := range apiVersions {
+		version.register(r.NewRoute().Subrouter(), version.prefix)
+	}
+
+	// Unversioned legacy paths, e.g. /login, alias v1 until they are removed
+	registerLegacy(r.NewRoute().Subrouter())
+
+	// SCIM provisioning for identity providers, authenticated with SCIM_TOKEN
+	registerSCIM(r.NewRoute().Subrouter())
+
+	return r
 }
 
+// nameSpanAfterRoute renames the server span to "METHOD /route/template" once mux has matched the route
+func nameSpanAfterRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				trace.SpanFromContext(r.Context()).SetName(r.Method + " " + tmpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
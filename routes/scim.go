@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"go-auth-app/handlers"
+	"go-auth-app/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// registerSCIM registers the SCIM 2.0 endpoints identity providers use to
+// provision users and groups. They follow the SCIM protocol rather than our
+// API conventions, so they are not versioned with it.
+func registerSCIM(r *mux.Router) {
+	r.Use(middleware.SCIMAuth)
+
+	r.HandleFunc("/scim/v2/ServiceProviderConfig", handlers.ServiceProviderConfig).Methods("GET")
+
+	r.HandleFunc("/scim/v2/Users", handlers.ListSCIMUsers).Methods("GET")
+	r.HandleFunc("/scim/v2/Users", handlers.CreateSCIMUser).Methods("POST")
+	r.HandleFunc("/scim/v2/Users/{id}", handlers.GetSCIMUser).Methods("GET")
+	r.HandleFunc("/scim/v2/Users/{id}", handlers.ReplaceSCIMUser).Methods("PUT")
+	r.HandleFunc("/scim/v2/Users/{id}", handlers.PatchSCIMUser).Methods("PATCH")
+	r.HandleFunc("/scim/v2/Users/{id}", handlers.DeleteSCIMUser).Methods("DELETE")
+
+	r.HandleFunc("/scim/v2/Groups", handlers.ListSCIMGroups).Methods("GET")
+	r.HandleFunc("/scim/v2/Groups", handlers.CreateSCIMGroup).Methods("POST")
+	r.HandleFunc("/scim/v2/Groups/{id}", handlers.GetSCIMGroup).Methods("GET")
+	r.HandleFunc("/scim/v2/Groups/{id}", handlers.ReplaceSCIMGroup).Methods("PUT")
+	r.HandleFunc("/scim/v2/Groups/{id}", handlers.PatchSCIMGroup).Methods("PATCH")
+	r.HandleFunc("/scim/v2/Groups/{id}", handlers.DeleteSCIMGroup).Methods("DELETE")
+}
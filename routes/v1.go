@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"go-auth-app/handlers"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// registerV1 registers the v1 API on r under prefix
+func registerV1(r *mux.Router, prefix string) {
+	// Public Routes (No Authentication Required)
+	r.HandleFunc(prefix+"/register", handlers.RegisterUser).Methods("POST")
+	r.HandleFunc(prefix+"/login", handlers.LoginUser).Methods("POST")
+	r.HandleFunc(prefix+"/refresh", handlers.RefreshToken).Methods("POST")
+	r.HandleFunc(prefix+"/email-changes/confirm", handlers.ConfirmEmailChange).Methods("POST") // Link sent to the new address
+	r.HandleFunc(prefix+"/email-changes/revert", handlers.RevertEmailChange).Methods("POST")   // Link sent to the old address
+	r.HandleFunc(prefix+"/reactivation", handlers.RequestReactivation).Methods("POST")         // Emails a reactivation link
+	r.HandleFunc(prefix+"/reactivation/confirm", handlers.ConfirmReactivation).Methods("POST")
+	r.HandleFunc(prefix+"/auth/passwordless", handlers.RequestPasswordlessLogin).Methods("POST")       // Emails a login link or code
+	r.HandleFunc(prefix+"/auth/passwordless/verify", handlers.VerifyPasswordlessLogin).Methods("POST") // Issues a token pair
+	r.HandleFunc(prefix+"/auth/oidc/providers", handlers.ListOIDCProviders).Methods("GET")
+	r.HandleFunc(prefix+"/auth/oidc/{provider}/authorize", handlers.AuthorizeOIDC).Methods("GET") // Redirects to the provider
+	r.HandleFunc(prefix+"/auth/oidc/{provider}/callback", handlers.OIDCCallback).Methods("GET")   // Issues a token pair
+	r.HandleFunc(prefix+"/auth/saml/providers", handlers.ListSAMLIdentityProviders).Methods("GET")
+	r.HandleFunc(prefix+"/auth/saml/{idp}/metadata", handlers.SAMLMetadata).Methods("GET")      // Service provider metadata
+	r.HandleFunc(prefix+"/auth/saml/{idp}/login", handlers.LoginSAML).Methods("GET")            // Redirects to the identity provider
+	r.HandleFunc(prefix+"/auth/saml/{idp}/acs", handlers.SAMLAssertionConsumer).Methods("POST") // Issues a token pair
+
+	// Protected Routes (Require JWT)
+	protected := r.PathPrefix(prefix + "/users").Subrouter()
+	protected.Use(middleware.JWTMiddleware) // Apply JWT middleware to all /users routes
+	// Lists the members of the active organization
+	protected.Handle("", middleware.OrgScope(http.HandlerFunc(handlers.GetAllUsers))).Methods("GET")
+	// ✅ Separate Routes for Different Actions
+	protected.HandleFunc("/me", handlers.GetUserDetails).Methods("GET")           // Fetch user details (with ETag)
+	protected.HandleFunc("/me", handlers.PatchUser).Methods("PATCH")              // JSON Merge Patch, requires If-Match
+	protected.HandleFunc("/me/update", handlers.UpdateUser).Methods("PATCH")      // Update user details
+	protected.HandleFunc("/me/deactivate", handlers.DeleteUser).Methods("DELETE") // Soft delete user
+	protected.HandleFunc("/me/reset-password", handlers.ResetPassword).Methods("POST")
+	protected.HandleFunc("/me/email", handlers.RequestEmailChange).Methods("POST") // Starts a confirmed email change
+	protected.HandleFunc("/me/export", handlers.ExportUserData).Methods("GET")     // GDPR data export (JSON or ZIP)
+	protected.HandleFunc("/me/erase", handlers.EraseUser).Methods("POST")          // GDPR erasure, no grace period
+	protected.HandleFunc("/me/activity", handlers.GetUserActivity).Methods("GET")  // Audit events about the user
+	protected.HandleFunc("/me/identities", handlers.ListMyIdentities).Methods("GET")
+	protected.HandleFunc("/me/identities/{id:[0-9]+}", handlers.UnlinkIdentity).Methods("DELETE")
+
+	// Ending the session of the access token (Require JWT)
+	session := r.NewRoute().Subrouter()
+	session.Use(middleware.JWTMiddleware)
+	session.HandleFunc(prefix+"/logout", handlers.Logout).Methods("POST") // Revokes the session, clears the cookies
+
+	// Linking a provider account to the authenticated user (Require JWT)
+	linking := r.NewRoute().Subrouter()
+	linking.Use(middleware.JWTMiddleware)
+	linking.HandleFunc(prefix+"/auth/oidc/{provider}/link", handlers.StartIdentityLink).Methods("POST") // Returns the provider's login URL
+
+	// Organizations (Require JWT)
+	orgs := r.NewRoute().Subrouter()
+	orgs.Use(middleware.JWTMiddleware)
+	orgs.HandleFunc(prefix+"/orgs", handlers.ListMyOrganizations).Methods("GET")
+	orgs.HandleFunc(prefix+"/orgs", handlers.CreateOrganization).Methods("POST")                    // The creator becomes owner
+	orgs.HandleFunc(prefix+"/orgs/{id:[0-9]+}/switch", handlers.SwitchOrganization).Methods("POST") // Returns a token for the org
+	orgs.HandleFunc(prefix+"/invitations/accept", handlers.AcceptInvitation).Methods("POST")
+
+	// Routes of the active organization (Require JWT and a membership in the org_id claim)
+	org := r.NewRoute().Subrouter()
+	org.Use(middleware.JWTMiddleware, middleware.OrgScope)
+	org.HandleFunc(prefix+"/org/members", handlers.ListOrgMembers).Methods("GET")
+	org.HandleFunc(prefix+"/org/members/{userID:[0-9]+}", handlers.RemoveOrgMember).Methods("DELETE") // Members can remove themselves
+	managers := org.NewRoute().Subrouter()
+	managers.Use(middleware.RequireOrgRole(models.OrgRoleOwner, models.OrgRoleAdmin))
+	managers.HandleFunc(prefix+"/org/members/{userID:[0-9]+}", handlers.UpdateOrgMember).Methods("PATCH")
+	managers.HandleFunc(prefix+"/org/invitations", handlers.ListOrgInvitations).Methods("GET")
+	managers.HandleFunc(prefix+"/org/invitations", handlers.InviteOrgMember).Methods("POST")
+
+	// Admin Routes (Require JWT and the admin role)
+	admin := r.PathPrefix(prefix + "/admin").Subrouter()
+	admin.Use(middleware.JWTMiddleware, middleware.RequireRole(models.RoleAdmin))
+	admin.HandleFunc("/audit-events", handlers.ListAuditEvents).Methods("GET")
+	admin.HandleFunc("/webhooks", handlers.ListWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks", handlers.CreateWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}", handlers.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", handlers.ListWebhookDeliveries).Methods("GET")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/retry", handlers.RetryWebhookDelivery).Methods("POST")
+	admin.HandleFunc("/invite-codes", handlers.ListInviteCodes).Methods("GET")
+	admin.HandleFunc("/invite-codes", handlers.CreateInviteCode).Methods("POST")
+	admin.HandleFunc("/invite-codes/{id:[0-9]+}", handlers.RevokeInviteCode).Methods("DELETE")
+	admin.HandleFunc("/registrations", handlers.ListPendingRegistrations).Methods("GET") // Approval queue
+	admin.HandleFunc("/registrations/{id:[0-9]+}/approve", handlers.ApproveRegistration).Methods("POST")
+	admin.HandleFunc("/registrations/{id:[0-9]+}/reject", handlers.RejectRegistration).Methods("POST")
+}
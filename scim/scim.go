@@ -0,0 +1,239 @@
+// Package scim holds the SCIM 2.0 (RFC 7643/7644) wire format used by
+// identity providers to provision users and groups: resources, list
+// responses, PATCH requests, errors and the single filter form we support.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of every SCIM response
+const ContentType = "application/scim+json"
+
+// Schema URIs
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// Error types (the scimType member of an error response)
+const (
+	InvalidFilter = "invalidFilter"
+	InvalidPath   = "invalidPath"
+	NoTarget      = "noTarget"
+	InvalidValue  = "invalidValue"
+	InvalidSyntax = "invalidSyntax"
+	Uniqueness    = "uniqueness"
+	Mutability    = "mutability"
+)
+
+// MaxResults is the largest page a list request returns
+const MaxResults = 200
+
+// Meta describes a resource
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created,omitzero"`
+	LastModified time.Time `json:"lastModified"`
+	Version      string    `json:"version,omitempty"`
+	Location     string    `json:"location"`
+}
+
+// Name is the user's name; we only store the formatted form
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is an address of a user. userName is always the primary address.
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// GroupRef is a group a user belongs to (read-only on users)
+type GroupRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is a SCIM user resource. Active is a pointer so requests can omit it.
+type User struct {
+	Schemas     []string   `json:"schemas"`
+	ID          string     `json:"id,omitempty"`
+	ExternalID  string     `json:"externalId,omitempty"`
+	UserName    string     `json:"userName"`
+	Name        *Name      `json:"name,omitempty"`
+	DisplayName string     `json:"displayName,omitempty"`
+	Emails      []Email    `json:"emails,omitempty"`
+	Active      *bool      `json:"active,omitempty"`
+	Password    string     `json:"password,omitempty"` // write-only, never returned
+	Groups      []GroupRef `json:"groups,omitempty"`
+	Meta        *Meta      `json:"meta,omitempty"`
+}
+
+// FullName picks the name to store from the attributes an identity provider sent
+func (u *User) FullName() string {
+	if u.Name != nil {
+		if u.Name.Formatted != "" {
+			return u.Name.Formatted
+		}
+		if full := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); full != "" {
+			return full
+		}
+	}
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.UserName
+}
+
+// Member is a user in a group
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Group is a SCIM group resource
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// ListResponse is a page of resources
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// PatchRequest is the body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove. Value is kept raw since
+// its shape depends on the path (and identity providers are not consistent).
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is a SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// Write sends v as a SCIM response with the given status code
+func Write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError sends a SCIM error; scimType may be empty
+func WriteError(w http.ResponseWriter, status int, scimType, detail string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+	}
+	Write(w, status, Error{Schemas: []string{SchemaError}, Status: strconv.Itoa(status), ScimType: scimType, Detail: detail})
+}
+
+// Filter is an `attribute eq "value"` filter, the only form identity
+// providers need to look up existing resources
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+var filterPattern = regexp.MustCompile(`^\s*([A-Za-z][\w.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// ErrUnsupportedFilter is returned for filters other than `attribute eq "value"`
+var ErrUnsupportedFilter = errors.New(`only filters of the form attribute eq "value" are supported`)
+
+// ParseFilter parses filter, allowing only the given attributes (matched
+// case-insensitively, as in SCIM). An empty filter returns nil.
+func ParseFilter(filter string, attributes ...string) (*Filter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return nil, ErrUnsupportedFilter
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return nil, ErrUnsupportedFilter
+	}
+	for _, attribute := range attributes {
+		if strings.EqualFold(match[1], attribute) {
+			return &Filter{Attribute: attribute, Value: value}, nil
+		}
+	}
+	return nil, errors.New("filtering on " + match[1] + " is not supported")
+}
+
+// Page reads the 1-based startIndex and count parameters. Out of range
+// values are clamped rather than rejected, as RFC 7644 requires.
+func Page(r *http.Request) (startIndex, count int) {
+	startIndex, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count > MaxResults {
+		count = MaxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+	return startIndex, count
+}
+
+// BoolValue reads a boolean PATCH value. Some identity providers send
+// "True"/"False" strings instead of JSON booleans.
+func BoolValue(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, errors.New("value must be a boolean")
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// StringValue reads a string PATCH value
+func StringValue(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", errors.New("value must be a string")
+	}
+	return s, nil
+}
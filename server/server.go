@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-auth-app/config"
+	"net/http"
+	"time"
+)
+
+// Run serves handler until ctx is cancelled, then shuts down gracefully:
+// onDrain is called first (to fail readiness), the server keeps serving for
+// DrainPeriod, and finally waits up to ShutdownTimeout for in-flight requests
+func Run(ctx context.Context, cfg config.ServerConfig, handler http.Handler, onDrain func()) error {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Println("Server running on", cfg.Addr+"...")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The listener failed before we were asked to stop (e.g. port in use)
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("🛑 Shutdown signal received, draining for", cfg.DrainPeriod)
+	if onDrain != nil {
+		onDrain()
+	}
+	time.Sleep(cfg.DrainPeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	fmt.Println("✅ Server stopped gracefully")
+	return nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Logins are audited and users can see the activity on their account
+func TestAudit_UserActivity(t *testing.T) {
+	user, accessToken, err := CreateAuthenticatedUser("audited@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	// A failed attempt against the account
+	req, _ := http.NewRequest("POST", "/v1/login", bytes.NewBufferString(`{"email": "audited@example.com", "password": "wrongpassword"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/v1/users/me/activity", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var activity handlers.AuditEventList
+	json.Unmarshal(rr.Body.Bytes(), &activity)
+	if assert.Len(t, activity.Events, 2) {
+		// Newest first
+		assert.Equal(t, "user.login", activity.Events[0].Type)
+		assert.Equal(t, "failure", activity.Events[0].Outcome)
+		assert.Equal(t, "invalid_password", activity.Events[0].Reason)
+		assert.Nil(t, activity.Events[0].ActorID)
+		assert.Equal(t, user.ID, *activity.Events[0].TargetID)
+		assert.Equal(t, "success", activity.Events[1].Outcome)
+	}
+
+	// The log cannot be rewritten
+	_, err = database.DB.Exec(`DELETE FROM audit_events WHERE target_id = $1`, user.ID)
+	assert.Error(t, err)
+}
+
+// ✅ Test: The audit log query API is restricted to admins and paginates with a cursor
+func TestAudit_AdminQuery(t *testing.T) {
+	admin, accessToken, err := CreateAuthenticatedUser("auditor@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/v1/admin/audit-events"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	assert.NoError(t, userRepo.GrantRole(context.Background(), admin.ID, models.RoleAdmin))
+
+	// Three more logins on top of the fixture's
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "/v1/login", bytes.NewBufferString(`{"email": "auditor@example.com", "password": "securepassword"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	filter := "?type=user.login&outcome=success&actor_id=" + strconv.Itoa(admin.ID) + "&limit=3"
+	rr = get(filter)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var page handlers.AuditEventList
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	assert.Len(t, page.Events, 3)
+	if !assert.NotEmpty(t, page.NextCursor) {
+		return
+	}
+
+	rr = get(filter + "&cursor=" + page.NextCursor)
+	var last handlers.AuditEventList
+	json.Unmarshal(rr.Body.Bytes(), &last)
+	assert.Len(t, last.Events, 1)
+	assert.Empty(t, last.NextCursor)
+	assert.Less(t, last.Events[0].ID, page.Events[2].ID)
+
+	rr = get("?since=yesterday&cursor=%21")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "since")
+	assert.Contains(t, rr.Body.String(), "cursor")
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"go-auth-app/config"
 	"go-auth-app/database"
 	"go-auth-app/middleware"
+	"go-auth-app/routes"
 
 	// "go-auth-app/utils"
 	"net/http"
@@ -23,6 +25,11 @@ func TestMain(m *testing.M) {
 	// ✅ Set TEST_MODE=true so the app uses `txdb` for testing
 	os.Setenv("TEST_MODE", "true")
 
+	// ✅ Bring the schema up to date with the embedded migrations
+	if err := database.MigrateUp(config.Get().Database.DSN()); err != nil {
+		fmt.Println("⚠️ Could not apply migrations, database tests will fail:", err)
+	}
+
 	// ✅ Initialize the database (ConnectDB will use txdb)
 	database.ConnectDB()
 
@@ -263,12 +270,18 @@ func TestGetAllUsers_ValidRequest(t *testing.T) {
 		t.Fatalf("❌ Failed to create authenticated user: %v", err)
 	}
 
+	// ✅ Users are listed within an organization
+	_, orgToken, err := CreateOrganizationToken(accessToken, "users-valid")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+
 	// 🚀 Make a request to fetch all users
-	req, _ := http.NewRequest("GET", "/users", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req, _ := http.NewRequest("GET", "/v1/users", nil)
+	req.Header.Set("Authorization", "Bearer "+orgToken)
 
 	rr := httptest.NewRecorder()
-	handlers.GetAllUsers(rr, req)
+	routes.SetupRoutes().ServeHTTP(rr, req)
 
 	// 📝 Check Response
 	assert.Equal(t, http.StatusOK, rr.Code, "Expected 200 OK for valid request")
@@ -298,12 +311,17 @@ func TestGetAllUsers_Pagination(t *testing.T) {
 		t.Fatalf("❌ Failed to create authenticated user: %v", err)
 	}
 
+	_, orgToken, err := CreateOrganizationToken(accessToken, "users-pagination")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+
 	// 🚀 Make a paginated request
-	req, _ := http.NewRequest("GET", "/users?page=1&limit=5", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req, _ := http.NewRequest("GET", "/v1/users?page=1&limit=5", nil)
+	req.Header.Set("Authorization", "Bearer "+orgToken)
 
 	rr := httptest.NewRecorder()
-	handlers.GetAllUsers(rr, req)
+	routes.SetupRoutes().ServeHTTP(rr, req)
 
 	// 📝 Check Response
 	assert.Equal(t, http.StatusOK, rr.Code, "Expected 200 OK for pagination")
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-auth-app/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAccessSecret  = "access-secret-that-is-long-enough-0123456789"
+	testRefreshSecret = "refresh-secret-that-is-long-enough-0123456789"
+)
+
+// loadTestConfig runs config.Load without touching the real .env and resets the global afterwards
+func loadTestConfig(t *testing.T, args ...string) (*config.Config, error) {
+	t.Cleanup(func() { config.Current = nil })
+	return config.Load(append([]string{"-env-file", filepath.Join(t.TempDir(), ".env")}, args...))
+}
+
+// ✅ Test: Environment variables override defaults, legacy numeric expirations still work
+func TestConfig_FromEnvironment(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("JWT_ACCESS_EXPIRATION", "30")
+	t.Setenv("JWT_REFRESH_EXPIRATION", "72h")
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, cfg.JWT.AccessExpiration, "Plain numbers are minutes for access tokens")
+	assert.Equal(t, 72*time.Hour, cfg.JWT.RefreshExpiration)
+	assert.Equal(t, ":8080", cfg.Server.Addr, "Unset values keep their defaults")
+}
+
+// ✅ Test: Secrets can be read from files (Docker secrets)
+func TestConfig_FileSuffixedVariables(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "jwt_secret")
+	os.WriteFile(secretFile, []byte(testAccessSecret+"\n"), 0o600)
+
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET_FILE", secretFile)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testAccessSecret, cfg.JWT.Secret, "Trailing newline should be trimmed")
+}
+
+// ✅ Test: Config file is applied, then environment, then flags
+func TestConfig_SourcePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	os.WriteFile(yamlFile, []byte(`
+server:
+  addr: ":9000"
+  write_timeout: 30s
+database:
+  url: postgres://from-file/db
+jwt:
+  secret: `+testAccessSecret+`
+  refresh_secret: `+testRefreshSecret+`
+`), 0o600)
+
+	t.Setenv("SERVER_ADDR", ":9100")
+
+	cfg, err := loadTestConfig(t, "-config", yamlFile, "-server-addr", ":9200")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ":9200", cfg.Server.Addr, "Flags win over everything")
+	assert.Equal(t, 30*time.Second, cfg.Server.WriteTimeout, "Durations are read from YAML")
+	assert.Equal(t, "postgres://from-file/db", cfg.Database.URL)
+
+	tomlFile := filepath.Join(dir, "config.toml")
+	os.WriteFile(tomlFile, []byte(`
+[database]
+url = "postgres://from-toml/db"
+
+[jwt]
+secret = "`+testAccessSecret+`"
+refresh_secret = "`+testRefreshSecret+`"
+access_expiration = "5m"
+`), 0o600)
+
+	cfg, err = loadTestConfig(t, "-config", tomlFile)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://from-toml/db", cfg.Database.URL)
+	assert.Equal(t, 5*time.Minute, cfg.JWT.AccessExpiration, "Durations are read from TOML")
+}
+
+// ❌ Test: Missing or weak secrets and bad durations fail validation together
+func TestConfig_ValidationFailsFast(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", "changeme")
+	t.Setenv("SERVER_READ_TIMEOUT", "-1s")
+
+	_, err := loadTestConfig(t)
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "JWT_SECRET) must be at least 32 characters")
+		assert.Contains(t, err.Error(), "placeholder value")
+		assert.Contains(t, err.Error(), "JWT_REFRESH_SECRET) is required")
+		assert.Contains(t, err.Error(), "server.read_timeout must be positive")
+	}
+
+	t.Setenv("JWT_ACCESS_EXPIRATION", "soon")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `JWT_ACCESS_EXPIRATION: invalid duration "soon"`)
+	}
+}
+
+// ❌ Test: The SMTP driver needs a relay, and the log driver is for test mode only
+func TestConfig_MailValidation(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("MAIL_LINK_BASE_URL", "app.example.com")
+
+	_, err := loadTestConfig(t)
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "SMTP_HOST) is required by the smtp driver")
+		assert.Contains(t, err.Error(), "mail.link_base_url must be an http(s) URL")
+	}
+
+	// ❌ Confirmation, reactivation and invitation links would end up in the logs
+	t.Setenv("MAIL_DRIVER", "log")
+	t.Setenv("MAIL_LINK_BASE_URL", "https://app.example.com")
+	t.Setenv("TEST_MODE", "false")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "mail.driver log prints live links to stdout and is allowed in test mode only")
+	}
+	t.Setenv("TEST_MODE", "true")
+	_, err = loadTestConfig(t)
+	assert.NoError(t, err)
+}
+
+// ✅ Test: Allowed registration domains are a comma separated list, the mode is checked
+func TestConfig_RegistrationPolicy(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("REGISTRATION_MODE", "invite_only")
+	t.Setenv("REGISTRATION_ALLOWED_DOMAINS", "example.com, example.org,")
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "invite_only", cfg.Registration.Mode)
+	assert.Equal(t, []string{"example.com", "example.org"}, cfg.Registration.AllowedDomains)
+
+	t.Setenv("REGISTRATION_MODE", "closed")
+	t.Setenv("REGISTRATION_ALLOWED_DOMAINS", "@example.com")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `registration.mode must be one of open, invite_only, approval, got "closed"`)
+		assert.Contains(t, err.Error(), `registration.allowed_domains must be domain names such as example.com, got "@example.com"`)
+	}
+}
+
+// ✅ Test: OIDC providers come from OIDC_PROVIDERS as JSON and are validated
+func TestConfig_OIDCProviders(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("OIDC_PROVIDERS", `[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "abc"}]`)
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	if provider, ok := cfg.OIDC.Provider("google"); assert.True(t, ok) {
+		assert.Equal(t, "https://accounts.google.com", provider.Issuer)
+	}
+
+	t.Setenv("OIDC_PROVIDERS", `[{"name": "google", "client_id": "abc"}, {"name": "google"}]`)
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "oidc.providers[0] needs an issuer, or auth_url, token_url and userinfo_url")
+		assert.Contains(t, err.Error(), `oidc.providers[1].name must be a unique lowercase name such as google, got "google"`)
+		assert.Contains(t, err.Error(), "oidc.providers[1].client_id is required")
+	}
+}
+
+// ✅ Test: The ldap backend needs a directory to talk to
+func TestConfig_LDAPBackend(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("AUTH_BACKENDS", "ldap,database")
+	t.Setenv("LDAP_URL", "ldaps://dc.example.com")
+	t.Setenv("LDAP_BASE_DN", "dc=example,dc=com")
+	t.Setenv("LDAP_GROUP_ROLES", `{"cn=Admins,dc=example,dc=com": "admin"}`)
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ldap", "database"}, cfg.Auth.Backends)
+	assert.Equal(t, "admin", cfg.LDAP.GroupRoles["cn=Admins,dc=example,dc=com"])
+
+	t.Setenv("AUTH_BACKENDS", "ldap,kerberos")
+	t.Setenv("LDAP_URL", "dc.example.com")
+	t.Setenv("LDAP_BASE_DN", "")
+	t.Setenv("LDAP_USER_FILTER", "(uid=*)")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `auth.backends must be database or ldap, got "kerberos"`)
+		assert.Contains(t, err.Error(), `ldap.url (LDAP_URL) must be an ldap:// or ldaps:// URL, got "dc.example.com"`)
+		assert.Contains(t, err.Error(), "ldap.base_dn (LDAP_BASE_DN) is required by the ldap backend")
+		assert.Contains(t, err.Error(), "ldap.user_filter must contain %s exactly once")
+	}
+}
+
+// ✅ Test: SAML identity providers need metadata, and the service provider key must match its certificate
+func TestConfig_SAMLIdentityProviders(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("SAML_IDENTITY_PROVIDERS", `[{"name": "okta", "metadata_url": "https://example.okta.com/app/abc/sso/saml/metadata", "email_attribute": "mail"}]`)
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	if idp, ok := cfg.SAML.IdentityProvider("okta"); assert.True(t, ok) {
+		assert.Equal(t, "mail", idp.EmailAttribute)
+	}
+
+	t.Setenv("SAML_IDENTITY_PROVIDERS", `[{"name": "Okta"}, {"name": "azure", "metadata_url": "https://example.com/metadata", "metadata": "<EntityDescriptor/>"}]`)
+	t.Setenv("SAML_CERTIFICATE", "not a certificate")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `saml.identity_providers[0].name must be a unique lowercase name such as okta, got "Okta"`)
+		assert.Contains(t, err.Error(), "saml.identity_providers[0] needs either metadata_url or metadata")
+		assert.Contains(t, err.Error(), "saml.identity_providers[1] needs either metadata_url or metadata")
+		assert.Contains(t, err.Error(), "saml.certificate and saml.key must be a PEM certificate and its private key")
+	}
+}
+
+// ✅ Test: Passwordless login limits must allow at least one email and one attempt
+func TestConfig_PasswordlessLimits(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("PASSWORDLESS_TTL", "5m")
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, cfg.Passwordless.TTL)
+	assert.Equal(t, 3, cfg.Passwordless.MaxRequests)
+
+	assert.False(t, cfg.Passwordless.Enabled, "A new login method is not turned on by upgrading")
+
+	// ❌ Working links and codes would end up in the logs
+	t.Setenv("TEST_MODE", "false")
+	t.Setenv("PASSWORDLESS_ENABLED", "true")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "mail.driver log prints live links to stdout and is allowed in test mode only")
+	}
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	_, err = loadTestConfig(t)
+	assert.NoError(t, err)
+
+	t.Setenv("PASSWORDLESS_MAX_ATTEMPTS", "0")
+	t.Setenv("PASSWORDLESS_REQUEST_WINDOW", "0s")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "passwordless.max_attempts and passwordless.max_requests must be at least 1")
+		assert.Contains(t, err.Error(), "passwordless.request_window must be positive")
+	}
+}
+
+// ✅ Test: Cookies with SameSite=None must be Secure
+func TestConfig_CookieSessions(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("COOKIE_SESSIONS_ENABLED", "true")
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.True(t, cfg.Cookies.Secure, "Cookies are Secure by default")
+	assert.Equal(t, "lax", cfg.Cookies.SameSite)
+
+	t.Setenv("COOKIE_SECURE", "false")
+	t.Setenv("COOKIE_SAME_SITE", "none")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cookies.same_site none requires cookies.secure")
+	}
+}
+
+// ✅ Test: CORS origins are a comma separated list, a wildcard cannot be combined with credentials
+func TestConfig_CORS(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_REFRESH_SECRET", testRefreshSecret)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, https://*.example.org")
+
+	cfg, err := loadTestConfig(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://app.example.com", "https://*.example.org"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, 10*time.Minute, cfg.CORS.MaxAge)
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*,app.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("SECURITY_FRAME_OPTIONS", "ALLOW-FROM https://example.com")
+	_, err = loadTestConfig(t)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cors.allowed_origins cannot be * with cors.allow_credentials")
+		assert.Contains(t, err.Error(), `got "app.example.com"`)
+		assert.Contains(t, err.Error(), "security_headers.frame_options must be DENY or SAMEORIGIN")
+	}
+}
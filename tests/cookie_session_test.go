@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/models"
+	"go-auth-app/routes"
+	"go-auth-app/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cookieJar replays the cookies a browser would keep, and the CSRF header its page would send
+type cookieJar struct {
+	router  http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (j *cookieJar) do(method, path, body, csrfToken string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+	for _, cookie := range j.cookies {
+		if len(path) >= len(cookie.Path) && path[:len(cookie.Path)] == cookie.Path {
+			req.AddCookie(cookie)
+		}
+	}
+	rr := httptest.NewRecorder()
+	j.router.ServeHTTP(rr, req)
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(j.cookies, cookie.Name)
+		} else {
+			j.cookies[cookie.Name] = cookie
+		}
+	}
+	return rr
+}
+
+// ✅ Test: In cookie session mode the tokens are HttpOnly cookies and changes need the CSRF header
+func TestCookieSession_LoginRefreshLogout(t *testing.T) {
+	if _, _, err := CreateAuthenticatedUser("cookie-session@example.com", "securepassword"); err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	t.Setenv("COOKIE_SESSIONS_ENABLED", "true")
+	jar := &cookieJar{router: routes.SetupRoutes(), cookies: map[string]*http.Cookie{}}
+
+	rr := jar.do("POST", "/v1/login", `{"email": "cookie-session@example.com", "password": "securepassword"}`, "")
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var login map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &login)
+	assert.Empty(t, login["access_token"], "Tokens must not be readable by the page")
+	assert.NotEmpty(t, login["csrf_token"])
+	if assert.Contains(t, jar.cookies, "access_token") && assert.Contains(t, jar.cookies, "refresh_token") {
+		assert.True(t, jar.cookies["access_token"].HttpOnly)
+		assert.True(t, jar.cookies["access_token"].Secure)
+		assert.Equal(t, http.SameSiteLaxMode, jar.cookies["access_token"].SameSite)
+		assert.Equal(t, "/v1/refresh", jar.cookies["refresh_token"].Path)
+		assert.False(t, jar.cookies["csrf_token"].HttpOnly, "The page reads the CSRF token from its cookie")
+	}
+
+	assert.Equal(t, http.StatusOK, jar.do("GET", "/v1/users/me", "", "").Code)
+
+	// ❌ A cross-site form post carries the cookies, not the header
+	rr = jar.do("PATCH", "/v1/users/me/update", `{"name": "Cookie Monster"}`, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "forbidden", decodeProblem(t, rr).Code)
+	rr = jar.do("PATCH", "/v1/users/me/update", `{"name": "Cookie Monster"}`, "forged")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = jar.do("PATCH", "/v1/users/me/update", `{"name": "Cookie Monster"}`, login["csrf_token"])
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Refresh from the cookie, with the CSRF header
+	assert.Equal(t, http.StatusForbidden, jar.do("POST", "/v1/refresh", "", "").Code)
+	oldAccess := jar.cookies["access_token"].Value
+	time.Sleep(time.Second) // a new issued-at makes a new token
+	rr = jar.do("POST", "/v1/refresh", "", login["csrf_token"])
+	if assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		assert.NotContains(t, rr.Body.String(), "access_token")
+		assert.NotEqual(t, oldAccess, jar.cookies["access_token"].Value)
+	}
+
+	// ❌ Cookie mode is v1-only: the legacy alias says so instead of failing with 401
+	rr = jar.do("POST", "/refresh", "", login["csrf_token"])
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, decodeProblem(t, rr).Detail, "/v1/refresh")
+
+	// Logging out revokes the session and clears the cookies
+	stolen := jar.cookies["access_token"]
+	assert.Equal(t, http.StatusNoContent, jar.do("POST", "/v1/logout", "", login["csrf_token"]).Code)
+	assert.NotContains(t, jar.cookies, "access_token")
+	jar.cookies["access_token"] = stolen
+	assert.Equal(t, http.StatusUnauthorized, jar.do("GET", "/v1/users/me", "", "").Code)
+}
+
+// ✅ Test: CSRF tokens are bound to their session and survive a key rotation
+func TestCookieSession_CSRFToken(t *testing.T) {
+	t.Cleanup(func() { utils.SetSigningKeys(nil) })
+	oldKey, _ := utils.GenerateSigningKey(models.KeyPurposeRefresh)
+	utils.SetSigningKeys([]models.SigningKey{oldKey})
+
+	token := utils.CSRFToken(7)
+	assert.True(t, utils.ValidCSRFToken(7, token))
+	assert.False(t, utils.ValidCSRFToken(8, token), "Another session's token must not match")
+	assert.False(t, utils.ValidCSRFToken(7, token+"x"))
+	assert.False(t, utils.ValidCSRFToken(7, ""))
+
+	retiredAt := time.Now()
+	oldKey.RetiredAt = &retiredAt
+	newKey, _ := utils.GenerateSigningKey(models.KeyPurposeRefresh)
+	utils.SetSigningKeys([]models.SigningKey{newKey, oldKey})
+	assert.True(t, utils.ValidCSRFToken(7, token), "Tokens signed with a retired key stay valid")
+	assert.NotEqual(t, token, utils.CSRFToken(7))
+}
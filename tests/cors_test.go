@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"go-auth-app/middleware"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Origins match exactly, by wildcard subdomain (same scheme and port), or not at all
+func TestCORS_OriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.example.org", "http://*.local.test:3000"}
+
+	assert.True(t, middleware.OriginAllowed(allowed, "https://app.example.com"))
+	assert.True(t, middleware.OriginAllowed(allowed, "https://App.Example.com"), "Origins are case-insensitive")
+	assert.True(t, middleware.OriginAllowed(allowed, "https://admin.example.org"))
+	assert.True(t, middleware.OriginAllowed(allowed, "https://a.b.example.org"))
+	assert.True(t, middleware.OriginAllowed(allowed, "http://web.local.test:3000"))
+
+	assert.False(t, middleware.OriginAllowed(allowed, "https://example.org"), "The wildcard only covers subdomains")
+	assert.False(t, middleware.OriginAllowed(allowed, "https://evilexample.org"))
+	assert.False(t, middleware.OriginAllowed(allowed, "http://admin.example.org"), "Schemes must match")
+	assert.False(t, middleware.OriginAllowed(allowed, "http://web.local.test:4000"), "Ports must match")
+	assert.False(t, middleware.OriginAllowed(allowed, "https://app.example.com.evil.com"))
+	assert.False(t, middleware.OriginAllowed(allowed, "null"))
+	assert.True(t, middleware.OriginAllowed([]string{"*"}, "https://anything.example"))
+}
+
+// ✅ Test: Preflights are answered before routing, only allowed origins get CORS headers
+func TestCORS_Preflight(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://*.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	router := routes.SetupRoutes()
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("OPTIONS", "/v1/login", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := preflight("https://spa.example.com")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://spa.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), "POST")
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "X-CSRF-Token")
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rr.Header().Values("Vary"), "Origin")
+
+	// ❌ Another origin
+	rr = preflight("https://evil.test")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+
+	// Actual requests expose the headers clients read
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("Origin", "https://spa.example.com")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://spa.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Expose-Headers"), "ETag")
+}
+
+// ✅ Test: Every response, including errors, carries the security headers
+func TestSecurityHeaders(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	for _, path := range []string{"/healthz", "/v1/does-not-exist"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"), path)
+		assert.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"), path)
+		assert.Equal(t, "no-referrer", rr.Header().Get("Referrer-Policy"), path)
+		assert.Equal(t, "max-age=31536000", rr.Header().Get("Strict-Transport-Security"), path)
+		assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"), "CORS is off by default")
+	}
+
+	t.Setenv("SECURITY_HSTS_MAX_AGE", "0s")
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Empty(t, rr.Header().Get("Strict-Transport-Security"))
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Users can download their data and then have it erased
+func TestDataExport_ExportAndErase(t *testing.T) {
+	user, accessToken, err := CreateAuthenticatedUser("subject@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	send := func(method, path, body, accept string) *httptest.ResponseRecorder {
+		if accept != "" {
+			return SendRequest(router, method, path, body, accessToken, "Accept", accept)
+		}
+		return SendRequest(router, method, path, body, accessToken)
+	}
+
+	// Records that refer to the user by address only
+	var orgID int
+	database.DB.QueryRow(`INSERT INTO organizations (name, slug) VALUES ('Subject Org', 'subject-org') RETURNING id`).Scan(&orgID)
+	database.DB.Exec(`INSERT INTO org_invitations (org_id, email, role, token_hash, expires_at)
+		VALUES ($1, 'Subject@example.com', 'member', REPEAT('a', 64), NOW() + INTERVAL '1 day')`, orgID)
+	database.DB.Exec(`INSERT INTO invite_codes (code_hash, email) VALUES (REPEAT('b', 64), 'subject@example.com')`)
+
+	// 1️⃣ JSON export, with the login from the fixture as a session and no secrets
+	rr := send("GET", "/v1/users/me/export", "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+	var export map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &export)
+	assert.Equal(t, "subject@example.com", export["profile"].(map[string]interface{})["email"])
+	assert.Len(t, export["sessions"], 1)
+	assert.Len(t, export["invitations"], 1)
+	assert.Contains(t, export, "login_challenges")
+	assert.NotContains(t, rr.Body.String(), "password")
+
+	// 2️⃣ ZIP export has one file per section
+	rr = send("GET", "/v1/users/me/export", "", "application/zip")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if assert.NoError(t, err) {
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		assert.Contains(t, names, "profile.json")
+		assert.Contains(t, names, "sessions.json")
+	}
+
+	// 3️⃣ Erasure needs the password
+	rr = send("POST", "/v1/users/me/erase", `{"password": "wrongpassword"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = send("POST", "/v1/users/me/erase", `{"password": "securepassword"}`, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// 4️⃣ The row is kept for references but holds no personal data, and the token is dead
+	userRepo := repository.UserRepository{DB: database.DB}
+	erased, err := userRepo.GetUserByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Deleted user", erased.Name)
+	assert.NotEqual(t, "subject@example.com", erased.Email)
+	assert.NotNil(t, erased.PurgedAt)
+
+	var identifiable int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND (ip_address IS NOT NULL OR user_agent IS NOT NULL)`, user.ID).Scan(&identifiable)
+	assert.Zero(t, identifiable)
+
+	// 5️⃣ Nothing refers to the address any more
+	var mentions int
+	database.DB.QueryRow(`SELECT (SELECT COUNT(*) FROM org_invitations WHERE LOWER(email) = 'subject@example.com')
+		+ (SELECT COUNT(*) FROM invite_codes WHERE email = 'subject@example.com')
+		+ (SELECT COUNT(*) FROM webhook_outbox WHERE payload->>'email' = 'subject@example.com')`).Scan(&mentions)
+	assert.Zero(t, mentions)
+	var revoked bool
+	database.DB.QueryRow(`SELECT revoked_at IS NOT NULL FROM invite_codes WHERE code_hash = REPEAT('b', 64)`).Scan(&revoked)
+	assert.True(t, revoked)
+
+	rr = send("GET", "/v1/users/me/export", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// ✅ Test: Unknown export formats are rejected
+func TestDataExport_InvalidFormat(t *testing.T) {
+	_, accessToken, err := CreateAuthenticatedUser("format@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/users/me/export?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr := httptest.NewRecorder()
+	routes.SetupRoutes().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "format")
+}
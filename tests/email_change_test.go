@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-auth-app/mailer"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMailer captures outgoing messages instead of sending them
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// captureMail swaps the default mailer for the duration of the test
+func captureMail(t *testing.T) *recordingMailer {
+	recorder := &recordingMailer{}
+	previous := mailer.Default
+	mailer.Default = recorder
+	t.Cleanup(func() { mailer.Default = previous })
+	return recorder
+}
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// ✅ Test: Email change is confirmed by the new address and revertible by the old one
+func TestEmailChange_ConfirmAndRevert(t *testing.T) {
+	mail := captureMail(t)
+	_, accessToken, err := CreateAuthenticatedUser("before@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	post := func(path string, payload map[string]string, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// 1️⃣ The current password is required
+	rr := post("/v1/users/me/email", map[string]string{"new_email": "after@example.com", "password": "wrongpassword"}, accessToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, mail.messages)
+
+	// 2️⃣ Both addresses are emailed
+	rr = post("/v1/users/me/email", map[string]string{"new_email": "after@example.com", "password": "securepassword"}, accessToken)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	if !assert.Len(t, mail.messages, 2) {
+		return
+	}
+	assert.Equal(t, "after@example.com", mail.messages[0].To)
+	assert.Equal(t, "before@example.com", mail.messages[1].To)
+	confirmToken := linkToken.FindStringSubmatch(mail.messages[0].Body)[1]
+	revertToken := linkToken.FindStringSubmatch(mail.messages[1].Body)[1]
+
+	// 3️⃣ Confirming switches the address and signs out every session
+	rr = post("/v1/email-changes/confirm", map[string]string{"token": confirmToken}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ := http.NewRequest("GET", "/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rrMe := httptest.NewRecorder()
+	router.ServeHTTP(rrMe, req)
+	assert.Equal(t, http.StatusUnauthorized, rrMe.Code, "Sessions are revoked after the change")
+
+	// 4️⃣ Links are single use
+	rr = post("/v1/email-changes/confirm", map[string]string{"token": confirmToken}, "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid_link")
+
+	// 5️⃣ The old address can undo the change and log in again
+	rr = post("/v1/email-changes/revert", map[string]string{"token": revertToken}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = post("/v1/login", map[string]string{"email": "before@example.com", "password": "securepassword"}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// ❌ Test: A confirmation without a token is rejected
+func TestEmailChange_InvalidLink(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("POST", "/v1/email-changes/confirm", bytes.NewBufferString(`{"token": ""}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "validation_failed")
+}
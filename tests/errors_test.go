@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/apierror"
+	"go-auth-app/handlers"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeProblem checks the response is problem+json and decodes it
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) apierror.Problem {
+	t.Helper()
+	assert.Equal(t, apierror.ContentType, rr.Header().Get("Content-Type"))
+
+	var problem apierror.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("❌ Response is not a problem document: %v (%s)", err, rr.Body.String())
+	}
+	return problem
+}
+
+// ✅ Test: Validation errors name the offending field
+func TestProblem_ValidationDetails(t *testing.T) {
+	registerBody, _ := json.Marshal(map[string]string{
+		"name":     "Invalid Email",
+		"email":    "invalid-email",
+		"password": "securepassword",
+	})
+
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(registerBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handlers.RegisterUser(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	problem := decodeProblem(t, rr)
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.Equal(t, "urn:go-auth-app:problem:validation_failed", problem.Type)
+	if assert.Len(t, problem.Errors, 1) {
+		assert.Equal(t, "email", problem.Errors[0].Field)
+	}
+}
+
+// ✅ Test: Middleware errors carry the caller's request ID
+func TestProblem_MiddlewareUsesRequestID(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/users/me", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "req-123", rr.Header().Get("X-Request-ID"), "Request ID should be echoed")
+	assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+
+	problem := decodeProblem(t, rr)
+	assert.Equal(t, "unauthorized", problem.Code)
+	assert.Equal(t, "req-123", problem.RequestID)
+	assert.Equal(t, "/users/me", problem.Instance)
+}
+
+// ✅ Test: Unknown routes return a 404 problem with a generated request ID
+func TestProblem_UnknownRoute(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/does-not-exist", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	problem := decodeProblem(t, rr)
+	assert.Equal(t, "not_found", problem.Code)
+	assert.NotEmpty(t, problem.RequestID)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), problem.RequestID)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-auth-app/handlers"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Liveness never depends on the database (200 OK)
+func TestHealthz(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+
+	handlers.Healthz(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Expected 200 OK for liveness")
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+// ✅ Test: Failing dependencies are reported without their error details
+func TestReadyz_HidesErrorDetails(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+
+	handlers.Readyz(rr, req)
+
+	var response handlers.HealthResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Components["database"].Status != "ok" {
+		assert.Empty(t, response.Components["database"].Error, "Connection errors name hosts and must only be logged")
+	}
+	assert.NotContains(t, rr.Body.String(), "dial tcp")
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Tokens signed before a rotation keep verifying, unknown keys are rejected
+func TestSigningKeys_Rotation(t *testing.T) {
+	t.Cleanup(func() { utils.SetSigningKeys(nil) })
+
+	oldKey, _ := utils.GenerateSigningKey(models.KeyPurposeAccess)
+	utils.SetSigningKeys([]models.SigningKey{oldKey})
+
+	oldToken, err := utils.GenerateAccessToken(42, 7, 0)
+	assert.NoError(t, err)
+
+	// Rotate: the new key signs, the retired key still verifies
+	retiredAt := time.Now()
+	oldKey.RetiredAt = &retiredAt
+	newKey, _ := utils.GenerateSigningKey(models.KeyPurposeAccess)
+	utils.SetSigningKeys([]models.SigningKey{newKey, oldKey})
+
+	newToken, err := utils.GenerateAccessToken(42, 8, 0)
+	assert.NoError(t, err)
+
+	claims, err := utils.ValidateToken(oldToken, false)
+	if assert.NoError(t, err, "Token signed with the retired key should still be valid") {
+		assert.Equal(t, 42, claims.UserID)
+		assert.Equal(t, 7, claims.SessionID)
+	}
+
+	claims, err = utils.ValidateToken(newToken, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8, claims.SessionID)
+	}
+
+	// Once the retired key is purged its tokens are rejected
+	utils.SetSigningKeys([]models.SigningKey{newKey})
+	_, err = utils.ValidateToken(oldToken, false)
+	assert.Error(t, err, "Token signed with a purged key should be rejected")
+
+	// Access keys never verify refresh tokens
+	_, err = utils.ValidateToken(newToken, true)
+	assert.Error(t, err, "Access token should not be accepted as a refresh token")
+}
+
+// ✅ Test: A new key signs only once active, and rotation retires the configured secret
+func TestSigningKeys_ActivationAndFallbackCutoff(t *testing.T) {
+	t.Setenv("JWT_SECRET", testAccessSecret)
+	t.Setenv("JWT_ACCESS_EXPIRATION", "15m")
+	t.Cleanup(func() { utils.SetSigningKeys(nil) })
+
+	legacyToken, err := utils.GenerateAccessToken(42, 7, 0)
+	assert.NoError(t, err)
+
+	// Pending: other servers may not know the key yet, so the secret keeps signing
+	pending, _ := utils.GenerateSigningKey(models.KeyPurposeAccess)
+	pending.ActivatesAt = time.Now().Add(30 * time.Second)
+	utils.SetSigningKeys([]models.SigningKey{pending})
+	token, _ := utils.GenerateAccessToken(42, 8, 0)
+	assert.Equal(t, "", tokenKID(t, token), "A pending key must not sign")
+	_, err = utils.ValidateToken(legacyToken, false)
+	assert.NoError(t, err)
+
+	// Active: tokens without kid last until tokens signed by the secret have expired
+	pending.ActivatesAt = time.Now().Add(-time.Minute)
+	utils.SetSigningKeys([]models.SigningKey{pending})
+	token, _ = utils.GenerateAccessToken(42, 9, 0)
+	assert.Equal(t, pending.KID, tokenKID(t, token))
+	_, err = utils.ValidateToken(legacyToken, false)
+	assert.NoError(t, err, "Tokens signed before the rotation stay valid until they expire")
+
+	pending.ActivatesAt = time.Now().Add(-16 * time.Minute)
+	utils.SetSigningKeys([]models.SigningKey{pending})
+	_, err = utils.ValidateToken(legacyToken, false)
+	assert.Error(t, err, "A leaked JWT_SECRET must stop working after a rotation")
+}
+
+// tokenKID returns the kid header of a JWT
+func tokenKID(t *testing.T, token string) string {
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatalf("❌ Invalid token: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(header, &fields)
+	kid, _ := fields["kid"].(string)
+	return kid
+}
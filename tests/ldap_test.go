@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-auth-app/authn"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/assert"
+)
+
+// LDAP protocol operations and result codes the stub speaks
+const (
+	ldapBindRequest      = 0
+	ldapBindResponse     = 1
+	ldapUnbindRequest    = 2
+	ldapSearchRequest    = 3
+	ldapSearchEntry      = 4
+	ldapSearchDone       = 5
+	ldapEqualityMatch    = 3
+	ldapSuccess          = 0
+	ldapSizeLimit        = 4
+	ldapInvalidCreds     = 49
+	ldapInsufficientAuth = 50
+)
+
+const (
+	stubServiceDN       = "cn=svc,dc=example,dc=com"
+	stubServicePassword = "service-password"
+	stubAdminsGroup     = "cn=Admins,ou=groups,dc=example,dc=com"
+)
+
+// ldapEntry is a user in the stub directory
+type ldapEntry struct {
+	password string
+	attrs    map[string][]string
+}
+
+// stubLDAP is an in-process LDAP server: simple binds, and searches answered
+// by the first equality match on mail in the filter. Only the service
+// account may search.
+type stubLDAP struct {
+	listener net.Listener
+	mu       sync.Mutex
+	entries  map[string]*ldapEntry // by DN
+}
+
+func newStubLDAP(t *testing.T) *stubLDAP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("❌ Failed to listen: %v", err)
+	}
+	stub := &stubLDAP{listener: listener, entries: map[string]*ldapEntry{
+		stubServiceDN: {password: stubServicePassword},
+	}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *stubLDAP) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// put adds or replaces a user
+func (s *stubLDAP) put(dn, password, mail, cn string, groups ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[dn] = &ldapEntry{password: password, attrs: map[string][]string{"mail": {mail}, "cn": {cn}, "memberOf": groups}}
+}
+
+func (s *stubLDAP) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			s.mu.Lock()
+			entry, ok := s.entries[dn]
+			s.mu.Unlock()
+			code := ldapInvalidCreds
+			if ok && entry.password == password {
+				code, bound = ldapSuccess, dn
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldapBindResponse, code)).Bytes())
+		case ldapSearchRequest:
+			if bound != stubServiceDN {
+				conn.Write(ldapMessage(id, ldapResult(ldapSearchDone, ldapInsufficientAuth)).Bytes())
+				continue
+			}
+			sizeLimit := int(op.Children[3].Value.(int64))
+			matches := s.search(equalityValue(op.Children[6], "mail"))
+			code := ldapSuccess
+			if sizeLimit > 0 && len(matches) > sizeLimit {
+				matches, code = matches[:sizeLimit], ldapSizeLimit
+			}
+			for _, entry := range matches {
+				conn.Write(ldapMessage(id, entry).Bytes())
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldapSearchDone, code)).Bytes())
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+// search returns the entries whose mail is value, as SearchResultEntry operations
+func (s *stubLDAP) search(value string) []*ber.Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*ber.Packet
+	for dn, entry := range s.entries {
+		if len(entry.attrs["mail"]) == 0 || !strings.EqualFold(entry.attrs["mail"][0], value) {
+			continue
+		}
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+		attributes := ber.NewSequence("")
+		for name, values := range entry.attrs {
+			attribute := ber.NewSequence("")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		result.AppendChild(attributes)
+		results = append(results, result)
+	}
+	return results
+}
+
+// equalityValue finds the value of the first (attribute=value) in a filter
+func equalityValue(filter *ber.Packet, attribute string) string {
+	if filter.ClassType == ber.ClassContext && filter.Tag == ldapEqualityMatch && len(filter.Children) == 2 &&
+		strings.EqualFold(filter.Children[0].Data.String(), attribute) {
+		return filter.Children[1].Data.String()
+	}
+	for _, child := range filter.Children {
+		if value := equalityValue(child, attribute); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.NewSequence("")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapResult(op ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+// stubLDAPConfig points the ldap backend at the stub
+func stubLDAPConfig(stub *stubLDAP) config.LDAPConfig {
+	cfg := config.Defaults().LDAP
+	cfg.URL = stub.URL()
+	cfg.BindDN, cfg.BindPassword = stubServiceDN, stubServicePassword
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.GroupRoles = map[string]string{"cn=admins,ou=groups,dc=example,dc=com": models.RoleAdmin}
+	cfg.Timeout = 2 * time.Second
+	return cfg
+}
+
+// ✅ Test: Directory credentials are checked by binding, before any user is provisioned
+func TestLDAP_Bind(t *testing.T) {
+	stub := newStubLDAP(t)
+	stub.put("uid=jane,ou=people,dc=example,dc=com", "directory-password", "jane@example.com", "Jane Doe")
+	stub.put("uid=twin1,ou=people,dc=example,dc=com", "pw", "twin@example.com", "Twin")
+	stub.put("uid=twin2,ou=people,dc=example,dc=com", "pw", "twin@example.com", "Twin")
+	ldapAuth := authn.LDAP{Config: stubLDAPConfig(stub), DB: database.DB}
+	ctx := context.Background()
+
+	_, err := ldapAuth.Authenticate(ctx, "jane@example.com", "wrong-password")
+	assert.ErrorIs(t, err, authn.ErrInvalidPassword)
+	_, err = ldapAuth.Authenticate(ctx, "jane@example.com", "") // would be an unauthenticated bind
+	assert.ErrorIs(t, err, authn.ErrInvalidPassword)
+	_, err = ldapAuth.Authenticate(ctx, "nobody@example.com", "directory-password")
+	assert.ErrorIs(t, err, authn.ErrUnknownUser)
+	_, err = ldapAuth.Authenticate(ctx, "jane*", "directory-password") // filter injection finds nobody
+	assert.ErrorIs(t, err, authn.ErrUnknownUser)
+
+	_, err = ldapAuth.Authenticate(ctx, "twin@example.com", "pw")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "more than one entry")
+	}
+
+	wrongService := ldapAuth
+	wrongService.Config.BindPassword = "nope"
+	_, err = wrongService.Authenticate(ctx, "jane@example.com", "directory-password")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, authn.ErrInvalidPassword) || errors.Is(err, authn.ErrUnknownUser))
+}
+
+// fakeAuthenticator answers every login the same way
+type fakeAuthenticator struct{ err error }
+
+func (f fakeAuthenticator) Authenticate(ctx context.Context, email, password string) (authn.Result, error) {
+	return authn.Result{Backend: "fake"}, f.err
+}
+
+// ✅ Test: A chain returns the first success, otherwise the most specific failure
+func TestAuthn_Chain(t *testing.T) {
+	down := errors.New("directory unreachable")
+	unknown, wrong := fakeAuthenticator{authn.ErrUnknownUser}, fakeAuthenticator{authn.ErrInvalidPassword}
+
+	result, err := authn.Chain{unknown, fakeAuthenticator{}}.Authenticate(context.Background(), "a@example.com", "pw")
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", result.Backend)
+
+	_, err = authn.Chain{fakeAuthenticator{down}, unknown}.Authenticate(context.Background(), "a@example.com", "pw")
+	assert.ErrorIs(t, err, down)
+	_, err = authn.Chain{fakeAuthenticator{down}, wrong}.Authenticate(context.Background(), "a@example.com", "pw")
+	assert.ErrorIs(t, err, authn.ErrInvalidPassword)
+	_, err = authn.Chain{unknown, unknown}.Authenticate(context.Background(), "a@example.com", "pw")
+	assert.ErrorIs(t, err, authn.ErrUnknownUser)
+}
+
+// ✅ Test: Directory users are provisioned on first login and their admin role follows their groups
+func TestLDAP_LoginProvisionsAndMapsGroups(t *testing.T) {
+	stub := newStubLDAP(t)
+	cfg := stubLDAPConfig(stub)
+	t.Setenv("AUTH_BACKENDS", "ldap,database")
+	t.Setenv("LDAP_URL", cfg.URL)
+	t.Setenv("LDAP_BIND_DN", cfg.BindDN)
+	t.Setenv("LDAP_BIND_PASSWORD", cfg.BindPassword)
+	t.Setenv("LDAP_BASE_DN", cfg.BaseDN)
+	t.Setenv("LDAP_GROUP_ROLES", `{"cn=admins,ou=groups,dc=example,dc=com": "admin"}`)
+	do := registrationClient(t)
+	userRepo := repository.UserRepository{DB: database.DB}
+
+	// ✅ First login creates the user, with the role of its group (DNs compare case-insensitively)
+	stub.put("uid=ldap-ann,ou=people,dc=example,dc=com", "directory-password", "ldap-ann@example.com", "Ann Admin", stubAdminsGroup)
+	login := `{"email": "ldap-ann@example.com", "password": "directory-password"}`
+	rr := do("POST", "/v1/login", login, "")
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	user, err := userRepo.GetUserByEmail(context.Background(), "ldap-ann@example.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Ann Admin", user.Name)
+	assert.Empty(t, user.Password)
+	isAdmin, _ := userRepo.HasRole(context.Background(), user.ID, models.RoleAdmin)
+	assert.True(t, isAdmin)
+
+	// ✅ Leaving the group revokes the role at the next login, other roles stay
+	assert.NoError(t, userRepo.GrantRole(context.Background(), user.ID, "auditor"))
+	stub.put("uid=ldap-ann,ou=people,dc=example,dc=com", "directory-password", "ldap-ann@example.com", "Ann Admin")
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/login", login, "").Code)
+	roles, _ := userRepo.GetUserRoles(context.Background(), user.ID)
+	assert.Equal(t, []string{"auditor"}, roles)
+
+	// ❌ Wrong directory password
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/v1/login", `{"email": "ldap-ann@example.com", "password": "wrong-password"}`, "").Code)
+
+	// ✅ Local accounts still log in through the database backend
+	if _, _, err := CreateAuthenticatedUser("ldap-local@example.com", "securepassword"); err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/login", `{"email": "ldap-local@example.com", "password": "securepassword"}`, "").Code)
+}
+
+// ✅ Test: A directory login does not take over an account someone registered with the same email
+func TestLDAP_DoesNotAdoptLocalAccounts(t *testing.T) {
+	stub := newStubLDAP(t)
+	ldapAuth := authn.LDAP{Config: stubLDAPConfig(stub), DB: database.DB}
+	userRepo := repository.UserRepository{DB: database.DB}
+	ctx := context.Background()
+
+	// ❌ Registered with a password before the directory user ever logged in
+	squatter, _, err := CreateAuthenticatedUser("ldap-ceo@example.com", "squatter-password")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	stub.put("uid=ldap-ceo,ou=people,dc=example,dc=com", "directory-password", "ldap-ceo@example.com", "The CEO", stubAdminsGroup)
+	_, err = ldapAuth.Authenticate(ctx, "ldap-ceo@example.com", "directory-password")
+	assert.ErrorIs(t, err, authn.ErrAccountConflict)
+	isAdmin, _ := userRepo.HasRole(ctx, squatter.ID, models.RoleAdmin)
+	assert.False(t, isAdmin)
+
+	// ❌ Without a password, but not created by the directory either
+	local := models.User{Name: "Local", Email: "ldap-local-only@example.com"}
+	assert.NoError(t, userRepo.CreateUser(ctx, &local))
+	stub.put("uid=ldap-local-only,ou=people,dc=example,dc=com", "directory-password", "ldap-local-only@example.com", "Local", stubAdminsGroup)
+	_, err = ldapAuth.Authenticate(ctx, "ldap-local-only@example.com", "directory-password")
+	assert.ErrorIs(t, err, authn.ErrAccountConflict)
+	isAdmin, _ = userRepo.HasRole(ctx, local.ID, models.RoleAdmin)
+	assert.False(t, isAdmin)
+
+	// ✅ Accounts the directory created are found again
+	stub.put("uid=ldap-own,ou=people,dc=example,dc=com", "directory-password", "ldap-own@example.com", "Own", stubAdminsGroup)
+	first, err := ldapAuth.Authenticate(ctx, "ldap-own@example.com", "directory-password")
+	assert.NoError(t, err)
+	assert.True(t, first.Provisioned)
+	again, err := ldapAuth.Authenticate(ctx, "ldap-own@example.com", "directory-password")
+	assert.NoError(t, err)
+	assert.False(t, again.Provisioned)
+	assert.Equal(t, first.User.ID, again.User.ID)
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/federation"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubIdP is a minimal OpenID Connect provider: it logs in whoever is set
+// as its current user without asking, and checks the PKCE verifier
+type stubIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	subject       string
+	email         string
+	emailVerified bool
+	codes         map[string]url.Values // authorization request of each issued code
+}
+
+const stubClientID = "go-auth-app"
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("❌ Failed to generate key: %v", err)
+	}
+	idp := &stubIdP{key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"userinfo_endpoint":                     idp.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "stub", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+		idp.mu.Lock()
+		idp.codes[code] = r.URL.Query()
+		idp.mu.Unlock()
+		http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(r.URL.Query().Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// logIn sets who the next login at the provider is
+func (idp *stubIdP) logIn(subject, email string, verified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.subject, idp.email, idp.emailVerified = subject, email, verified
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	authRequest, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != authRequest.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant"}`))
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": idp.URL, "aud": stubClientID, "sub": idp.subject,
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+		"nonce": authRequest.Get("nonce"), "email": idp.email, "email_verified": idp.emailVerified, "name": "Stub User",
+	})
+	idToken.Header["kid"] = "stub"
+	signed, _ := idToken.SignedString(idp.key)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "stub-access-token", "token_type": "Bearer", "expires_in": 60, "id_token": signed})
+}
+
+// useStubIdP configures the stub as the "stub" provider
+func useStubIdP(t *testing.T, idp *stubIdP) {
+	t.Setenv("OIDC_PROVIDERS", fmt.Sprintf(`[{"name": "stub", "issuer": %q, "client_id": %q, "client_secret": "stub-secret"}]`, idp.URL, stubClientID))
+}
+
+// followToCallback completes the login at the provider and returns the callback
+// request, carrying the state cookie set when the login started
+func followToCallback(t *testing.T, authURL string, cookies []*http.Cookie) *http.Request {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("❌ Login at the provider failed: %v", err)
+	}
+	resp.Body.Close()
+
+	callback, _ := url.Parse(resp.Header.Get("Location"))
+	req, _ := http.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+// oidcLogin logs in through the stub provider and returns the callback response
+func oidcLogin(t *testing.T, router http.Handler) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/v1/auth/oidc/stub/authorize", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if !assert.Equal(t, http.StatusFound, rr.Code, rr.Body.String()) {
+		t.FailNow()
+	}
+
+	rr2 := httptest.NewRecorder()
+	router.ServeHTTP(rr2, followToCallback(t, rr.Header().Get("Location"), rr.Result().Cookies()))
+	return rr2
+}
+
+// ✅ Test: Federated login signs up new users and links existing ones by verified email only
+func TestOIDC_LoginAndLinking(t *testing.T) {
+	idp := newStubIdP(t)
+	useStubIdP(t, idp)
+	do := registrationClient(t)
+	router := routes.SetupRoutes()
+
+	// ✅ A new user is signed up without a password
+	idp.logIn("stub-1", "oidc-new@example.com", true)
+	rr := oidcLogin(t, router)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var tokens map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	me := do("GET", "/v1/users/me", "", tokens["access_token"])
+	assert.Contains(t, me.Body.String(), "oidc-new@example.com")
+
+	// ✅ Logging in again uses the link, whatever the address is now
+	idp.logIn("stub-1", "oidc-renamed@example.com", true)
+	rr = oidcLogin(t, router)
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	assert.Contains(t, do("GET", "/v1/users/me", "", tokens["access_token"]).Body.String(), "oidc-new@example.com")
+
+	// ❌ The only way to log in cannot be unlinked
+	var list struct {
+		Identities []struct {
+			ID int `json:"id"`
+		} `json:"identities"`
+	}
+	json.Unmarshal(do("GET", "/v1/users/me/identities", "", tokens["access_token"]).Body.Bytes(), &list)
+	if assert.Len(t, list.Identities, 1) {
+		assert.Equal(t, http.StatusConflict, do("DELETE", fmt.Sprintf("/v1/users/me/identities/%d", list.Identities[0].ID), "", tokens["access_token"]).Code)
+	}
+
+	// ❌ An unverified address does not take over the account that owns it
+	_, passwordToken, err := CreateAuthenticatedUser("oidc-existing@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	idp.logIn("stub-2", "oidc-existing@example.com", false)
+	assert.Equal(t, http.StatusConflict, oidcLogin(t, router).Code)
+
+	// ❌ Neither does a verified one while the account has a password: whoever
+	// registered the address may not own it
+	idp.logIn("stub-2", "oidc-existing@example.com", true)
+	rr = oidcLogin(t, router)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "email_taken", decodeProblem(t, rr).Code)
+	json.Unmarshal(do("GET", "/v1/users/me/identities", "", passwordToken).Body.Bytes(), &list)
+	assert.Len(t, list.Identities, 0)
+
+	// ✅ A verified address links an account without a password
+	userRepo := repository.UserRepository{DB: database.DB}
+	passwordless := models.User{Name: "Passwordless", Email: "oidc-passwordless@example.com"}
+	assert.NoError(t, userRepo.CreateUser(context.Background(), &passwordless))
+	idp.logIn("stub-3", "oidc-passwordless@example.com", true)
+	rr = oidcLogin(t, router)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	assert.Contains(t, do("GET", "/v1/users/me", "", tokens["access_token"]).Body.String(), "oidc-passwordless@example.com")
+}
+
+// ✅ Test: An authenticated user links an account explicitly, but not one linked to someone else
+func TestOIDC_ExplicitLink(t *testing.T) {
+	idp := newStubIdP(t)
+	useStubIdP(t, idp)
+	do := registrationClient(t)
+	router := routes.SetupRoutes()
+
+	_, accessToken, err := CreateAuthenticatedUser("oidc-linker@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+
+	link := func() *httptest.ResponseRecorder {
+		rr := do("POST", "/v1/auth/oidc/stub/link", "", accessToken)
+		if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+			t.FailNow()
+		}
+		var start struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &start)
+		callback := httptest.NewRecorder()
+		router.ServeHTTP(callback, followToCallback(t, start.AuthorizationURL, rr.Result().Cookies()))
+		return callback
+	}
+
+	// ✅ The address at the provider does not matter when linking explicitly
+	idp.logIn("stub-linked", "someone-else@example.org", false)
+	assert.Equal(t, http.StatusOK, link().Code)
+
+	var list struct {
+		Identities []struct {
+			ID       int    `json:"id"`
+			Provider string `json:"provider"`
+		} `json:"identities"`
+	}
+	json.Unmarshal(do("GET", "/v1/users/me/identities", "", accessToken).Body.Bytes(), &list)
+	if assert.Len(t, list.Identities, 1) {
+		assert.Equal(t, "stub", list.Identities[0].Provider)
+	}
+
+	// ❌ An account already linked to another user
+	idp.logIn("stub-other", "oidc-other@example.com", true)
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	assert.Equal(t, http.StatusConflict, link().Code)
+
+	// ✅ Users with a password can unlink their last account
+	assert.Equal(t, http.StatusOK, do("DELETE", fmt.Sprintf("/v1/users/me/identities/%d", list.Identities[0].ID), "", accessToken).Code)
+}
+
+// ✅ Test: Callbacks without the state cookie of the browser that started the login are refused
+func TestOIDC_RejectsForgedCallbacks(t *testing.T) {
+	idp := newStubIdP(t)
+	useStubIdP(t, idp)
+	router := routes.SetupRoutes()
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/v1/auth/oidc/stub/callback?code=abc&state=attacker-state")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "federated_login_failed", decodeProblem(t, rr).Code)
+
+	rr = get("/v1/auth/oidc/stub/callback?code=abc&state=one", &http.Cookie{Name: "oidc_state", Value: "another"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = get("/v1/auth/oidc/stub/callback?error=access_denied")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, decodeProblem(t, rr).Detail, "access_denied")
+
+	assert.Equal(t, http.StatusNotFound, get("/v1/auth/oidc/unknown/authorize").Code)
+
+	var providers struct {
+		Providers []string `json:"providers"`
+	}
+	json.Unmarshal(get("/v1/auth/oidc/providers").Body.Bytes(), &providers)
+	assert.Equal(t, []string{"stub"}, providers.Providers)
+}
+
+// ✅ Test: A provider that is slow to discover holds up neither other providers nor logins that wait for it longer
+func TestOIDC_SlowDiscovery(t *testing.T) {
+	idp := newStubIdP(t)
+	discovering, release := make(chan struct{}, 1), make(chan struct{})
+	slow := httptest.NewServer(nil)
+	slow.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discovering <- struct{}{}
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 slow.URL,
+			"authorization_endpoint": slow.URL + "/authorize",
+			"token_endpoint":         slow.URL + "/token",
+			"jwks_uri":               slow.URL + "/jwks",
+		})
+	})
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	t.Setenv("OIDC_PROVIDERS", fmt.Sprintf(`[{"name": "stub", "issuer": %q, "client_id": %q, "client_secret": "stub-secret"},
+		{"name": "slow", "issuer": %q, "client_id": %q, "client_secret": "stub-secret"}]`, idp.URL, stubClientID, slow.URL, stubClientID))
+
+	// One login gives up on the slow provider, another keeps waiting for it
+	impatient, cancel := context.WithCancel(context.Background())
+	impatientErr := make(chan error, 1)
+	go func() {
+		_, err := federation.Get(impatient, "slow")
+		impatientErr <- err
+	}()
+	<-discovering
+	patientErr := make(chan error, 1)
+	go func() {
+		_, err := federation.Get(context.Background(), "slow")
+		patientErr <- err
+	}()
+
+	stubErr := make(chan error, 1)
+	go func() {
+		_, err := federation.Get(context.Background(), "stub")
+		stubErr <- err
+	}()
+	select {
+	case err := <-stubErr:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("❌ Discovery of another provider waited for the slow one")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-impatientErr, context.Canceled)
+
+	close(release)
+	select {
+	case err := <-patientErr:
+		assert.NoError(t, err, "a cancelled login failed the discovery for the others")
+	case <-time.After(5 * time.Second):
+		t.Fatal("❌ Discovery of the slow provider never finished")
+	}
+}
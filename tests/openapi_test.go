@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"go-auth-app/openapi"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Every registered route is described in the OpenAPI document
+func TestOpenAPI_DocumentsEveryRoute(t *testing.T) {
+	doc, err := openapi.Spec()
+	if err != nil {
+		t.Fatalf("❌ Failed to load OpenAPI document: %v", err)
+	}
+
+	err = routes.NewRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefixes have no methods of their own
+		}
+		for _, method := range methods {
+			if _, ok := doc.Operation(method, openapi.PathTemplate(tmpl)); !ok {
+				t.Errorf("❌ %s %s is registered but missing from openapi.json", method, tmpl)
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+// ✅ Test: The document and docs page are served
+func TestOpenAPI_ServesDocument(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	for path, contentType := range map[string]string{"/openapi.json": "application/json", "/docs": "text/html"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), contentType), path)
+	}
+}
+
+// ✅ Test: The middleware replaces responses that drift from the spec
+func TestOpenAPI_ValidationMiddleware(t *testing.T) {
+	handle := func(path string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		r := mux.NewRouter()
+		r.Use(openapi.ValidationMiddleware)
+		r.HandleFunc(path, handler).Methods("GET", "POST")
+
+		method := "GET"
+		body := bytes.NewBuffer(nil)
+		if path == "/refresh" {
+			method = "POST"
+			body = bytes.NewBufferString(`{"token": "wrong-field"}`)
+		}
+		req, _ := http.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A documented response passes through untouched
+	rr := handle("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+
+	// An undocumented field in the response is caught
+	rr = handle("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok","uptime":12}`))
+	})
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "uptime")
+
+	// An undocumented route is caught
+	rr = handle("/internal/debug", func(w http.ResponseWriter, r *http.Request) {})
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	// A request that breaks the spec but is accepted anyway is caught
+	rr = handle("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"abc"}`))
+	})
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "refresh_token")
+}
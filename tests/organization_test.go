@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Members are invited by email and only see the users of their own organization
+func TestOrganization_InviteAndScope(t *testing.T) {
+	mail := captureMail(t)
+	router := routes.SetupRoutes()
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		return SendRequest(router, method, path, body, token)
+	}
+
+	_, ownerToken, err := CreateAuthenticatedUser("org-owner@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	member, memberToken, err := CreateAuthenticatedUser("org-member@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	_, outsiderToken, err := CreateAuthenticatedUser("org-outsider@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+
+	// ❌ Without an active organization there is nothing to list
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/users", "", memberToken).Code)
+
+	_, ownerToken, err = CreateOrganizationToken(ownerToken, "acme")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+	_, outsiderToken, err = CreateOrganizationToken(outsiderToken, "globex")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+	assert.Equal(t, http.StatusConflict, do("POST", "/v1/orgs", `{"name": "Acme again", "slug": "acme"}`, ownerToken).Code)
+
+	rr := do("POST", "/v1/org/invitations", `{"email": "org-member@example.com", "role": "member"}`, ownerToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	if !assert.Len(t, mail.messages, 1) {
+		return
+	}
+	token := linkToken.FindStringSubmatch(mail.messages[0].Body)[1]
+
+	// ❌ The invitation is bound to the invited address
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/invitations/accept", `{"token": "`+token+`"}`, outsiderToken).Code)
+
+	rr = do("POST", "/v1/invitations/accept", `{"token": "`+token+`"}`, memberToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/v1/invitations/accept", `{"token": "`+token+`"}`, memberToken).Code)
+
+	// The member switches their session to the organization they joined
+	var orgs struct {
+		Organizations []struct {
+			ID   int    `json:"id"`
+			Role string `json:"role"`
+		} `json:"organizations"`
+	}
+	json.Unmarshal(do("GET", "/v1/orgs", "", memberToken).Body.Bytes(), &orgs)
+	if !assert.Len(t, orgs.Organizations, 1) {
+		return
+	}
+	assert.Equal(t, "member", orgs.Organizations[0].Role)
+	rr = do("POST", fmt.Sprintf("/v1/orgs/%d/switch", orgs.Organizations[0].ID), "", memberToken)
+	var switched map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &switched)
+	memberToken = switched["access_token"]
+
+	// ✅ Users are listed per tenant
+	var users handlers.UserListResponse
+	json.Unmarshal(do("GET", "/v1/users", "", memberToken).Body.Bytes(), &users)
+	assert.Equal(t, 2, users.TotalUsers)
+	json.Unmarshal(do("GET", "/v1/users", "", outsiderToken).Body.Bytes(), &users)
+	assert.Equal(t, 1, users.TotalUsers)
+
+	// ❌ Members cannot invite, and the last owner cannot leave
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/org/invitations", `{"email": "x@example.com", "role": "member"}`, memberToken).Code)
+	json.Unmarshal(do("GET", "/v1/users", "", ownerToken).Body.Bytes(), &users)
+	ownerID := users.Users[0].ID
+	assert.Equal(t, http.StatusConflict, do("DELETE", fmt.Sprintf("/v1/org/members/%d", ownerID), "", ownerToken).Code)
+
+	// ✅ A removed member loses access right away, with the same token
+	assert.Equal(t, http.StatusOK, do("DELETE", fmt.Sprintf("/v1/org/members/%d", member.ID), "", ownerToken).Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/org/members", "", memberToken).Code)
+}
+
+// ✅ Test: Erasing the only owner hands the organization over instead of leaving it ownerless
+func TestOrganization_ErasingTheOnlyOwner(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	_, ownerToken, err := CreateAuthenticatedUser("erased-owner@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	soloOrgID, _, err := CreateOrganizationToken(ownerToken, "erased-owner-solo")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+	orgID, _, err := CreateOrganizationToken(ownerToken, "erased-owner-team")
+	if err != nil {
+		t.Fatalf("❌ Failed to create organization: %v", err)
+	}
+
+	// A member who joined first, and an admin who joined later
+	member, _, err := CreateAuthenticatedUser("erased-owner-member@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	admin, _, err := CreateAuthenticatedUser("erased-owner-admin@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	database.DB.Exec(`INSERT INTO memberships (org_id, user_id, role, created_at) VALUES ($1, $2, 'member', NOW() - INTERVAL '2 days'), ($1, $3, 'admin', NOW() - INTERVAL '1 day')`,
+		orgID, member.ID, admin.ID)
+
+	rr := SendRequest(router, "POST", "/v1/users/me/erase", `{"password": "securepassword"}`, ownerToken)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The admin takes over, the member stays a member
+	roles := map[int]string{}
+	rows, err := database.DB.Query(`SELECT user_id, role FROM memberships WHERE org_id = $1`, orgID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int
+		var role string
+		rows.Scan(&userID, &role)
+		roles[userID] = role
+	}
+	assert.Equal(t, map[int]string{member.ID: models.OrgRoleMember, admin.ID: models.OrgRoleOwner}, roles)
+
+	// Nobody is left to run the organization the owner had alone
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)`, soloOrgID).Scan(&exists)
+	assert.False(t, exists)
+}
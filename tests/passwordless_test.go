@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var loginCode = regexp.MustCompile(`code is (\d{6})`)
+
+// passwordlessPost posts body to path, with the nonce cookie when given
+func passwordlessPost(router http.Handler, path, body string, nonce *http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if nonce != nil {
+		req.AddCookie(nonce)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// nonceCookie returns the passwordless_nonce cookie set by the response
+func nonceCookie(t *testing.T, rr *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "passwordless_nonce" {
+			assert.True(t, cookie.HttpOnly)
+			return cookie
+		}
+	}
+	t.Fatalf("❌ No passwordless_nonce cookie in the response")
+	return nil
+}
+
+// ✅ Test: A magic link logs in an account without a password, once, in the browser that asked for it
+func TestPasswordless_LinkLogin(t *testing.T) {
+	t.Setenv("PASSWORDLESS_ENABLED", "true")
+	mail := captureMail(t)
+	user := models.User{Name: "No Password", Email: "passwordless-link@example.com"}
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("❌ Failed to create user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	rr := passwordlessPost(router, "/v1/auth/passwordless", `{"email": "passwordless-link@example.com"}`, nil)
+	if !assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String()) || !assert.Len(t, mail.messages, 1) {
+		return
+	}
+	nonce := nonceCookie(t, rr)
+	token := linkToken.FindStringSubmatch(mail.messages[0].Body)[1]
+	body, _ := json.Marshal(map[string]string{"token": token})
+
+	// ❌ Opened in another browser
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", string(body), nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "invalid_link", decodeProblem(t, rr).Code)
+
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", string(body), nonce)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var tokens map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	assert.NotEmpty(t, tokens["access_token"])
+	assert.NotEmpty(t, tokens["refresh_token"])
+
+	// ❌ Single-use
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", string(body), nonce)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// ❌ Still no password login
+	rr = passwordlessPost(router, "/v1/login", `{"email": "passwordless-link@example.com", "password": "anything"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// ✅ Test: Codes stop working after too many wrong guesses, and requests are throttled per address
+func TestPasswordless_CodeAttemptsAndThrottling(t *testing.T) {
+	t.Setenv("PASSWORDLESS_ENABLED", "true")
+	t.Setenv("PASSWORDLESS_MAX_ATTEMPTS", "2")
+	t.Setenv("PASSWORDLESS_MAX_REQUESTS", "2")
+	mail := captureMail(t)
+	if _, _, err := CreateAuthenticatedUser("passwordless-code@example.com", "securepassword"); err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+	request := `{"email": "passwordless-code@example.com", "method": "code"}`
+
+	rr := passwordlessPost(router, "/v1/auth/passwordless", request, nil)
+	if !assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String()) || !assert.Len(t, mail.messages, 1) {
+		return
+	}
+	nonce := nonceCookie(t, rr)
+	code := loginCode.FindStringSubmatch(mail.messages[0].Body)[1]
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// ❌ Two wrong guesses spend the code
+	for i := 0; i < 2; i++ {
+		rr = passwordlessPost(router, "/v1/auth/passwordless/verify", `{"code": "`+wrong+`"}`, nonce)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "invalid_credentials", decodeProblem(t, rr).Code)
+	}
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", `{"code": "`+code+`"}`, nonce)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// ✅ A new code works
+	rr = passwordlessPost(router, "/v1/auth/passwordless", request, nil)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	code = loginCode.FindStringSubmatch(mail.messages[1].Body)[1]
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", `{"code": "`+code+`"}`, nonceCookie(t, rr))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// ❌ A third email within the window, for known and unknown addresses alike
+	rr = passwordlessPost(router, "/v1/auth/passwordless", request, nil)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "too_many_requests", decodeProblem(t, rr).Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	unknown := `{"email": "passwordless-nobody@example.com"}`
+	assert.Equal(t, http.StatusAccepted, passwordlessPost(router, "/v1/auth/passwordless", unknown, nil).Code)
+	assert.Equal(t, http.StatusAccepted, passwordlessPost(router, "/v1/auth/passwordless", unknown, nil).Code)
+	assert.Equal(t, http.StatusTooManyRequests, passwordlessPost(router, "/v1/auth/passwordless", unknown, nil).Code)
+	assert.Len(t, mail.messages, 2, "Unknown addresses get no email")
+}
+
+// ✅ Test: The endpoints are off unless passwordless login is enabled
+func TestPasswordless_Disabled(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	rr := passwordlessPost(router, "/v1/auth/passwordless", `{"email": "someone@example.com"}`, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = passwordlessPost(router, "/v1/auth/passwordless/verify", `{"code": "123456"}`, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
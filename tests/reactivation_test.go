@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Deleted accounts come back by logging in or with the emailed link, and are purged later
+func TestReactivation_GracePeriodAndPurge(t *testing.T) {
+	mail := captureMail(t)
+	user, accessToken, err := CreateAuthenticatedUser("comeback@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+	credentials := `{"email": "comeback@example.com", "password": "securepassword"}`
+
+	// 1️⃣ Logging in during the grace period reactivates the account
+	rr := SendRequest(router, "DELETE", "/v1/users/me/deactivate", "", accessToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, SendRequest(router, "GET", "/v1/users/me", "", accessToken).Code, "Deleting signs out every session")
+	rr = SendRequest(router, "POST", "/v1/login", credentials, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var tokens map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+	// 2️⃣ So does the emailed link
+	rr = SendRequest(router, "DELETE", "/v1/users/me/deactivate", "", tokens["access_token"])
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = SendRequest(router, "POST", "/v1/reactivation", `{"email": "comeback@example.com"}`, "")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	if !assert.Len(t, mail.messages, 1) {
+		return
+	}
+	token := linkToken.FindStringSubmatch(mail.messages[0].Body)[1]
+	rr = SendRequest(router, "POST", "/v1/reactivation/confirm", `{"token": "`+token+`"}`, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// 3️⃣ Once the retention window has passed the account is anonymized for good
+	rr = SendRequest(router, "POST", "/v1/login", credentials, "")
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	SendRequest(router, "DELETE", "/v1/users/me/deactivate", "", tokens["access_token"])
+	_, err = database.DB.Exec(`UPDATE users SET deleted_at = NOW() - INTERVAL '90 days' WHERE id = $1`, user.ID)
+	assert.NoError(t, err)
+
+	userRepo := repository.UserRepository{DB: database.DB}
+	purged, err := userRepo.PurgeDeletedUsers(context.Background(), time.Now().Add(-30*24*time.Hour), true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	purgedUser, err := userRepo.GetUserByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Deleted user", purgedUser.Name)
+	assert.NotEqual(t, "comeback@example.com", purgedUser.Email)
+
+	rr = SendRequest(router, "POST", "/v1/login", credentials, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// ✅ Test: Reactivation requests do not reveal whether an account exists
+func TestReactivation_UnknownEmail(t *testing.T) {
+	mail := captureMail(t)
+	router := routes.SetupRoutes()
+	rr := SendRequest(router, "POST", "/v1/reactivation", `{"email": "nobody@example.com"}`, "")
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Empty(t, mail.messages)
+}
+
+// ❌ Test: Accounts deactivated by an operator cannot be reactivated by their user
+func TestReactivation_OperatorDeactivated(t *testing.T) {
+	mail := captureMail(t)
+	user, accessToken, err := CreateAuthenticatedUser("banned@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+	credentials := `{"email": "banned@example.com", "password": "securepassword"}`
+
+	// The user deletes the account and asks for a link, then an operator deactivates it
+	assert.Equal(t, http.StatusOK, SendRequest(router, "DELETE", "/v1/users/me/deactivate", "", accessToken).Code)
+	SendRequest(router, "POST", "/v1/reactivation", `{"email": "banned@example.com"}`, "")
+	if !assert.Len(t, mail.messages, 1) {
+		return
+	}
+	token := linkToken.FindStringSubmatch(mail.messages[0].Body)[1]
+	userRepo := repository.UserRepository{DB: database.DB}
+	assert.NoError(t, userRepo.SoftDeleteUser(context.Background(), user.ID, models.DeactivatedByOperator))
+
+	rr := SendRequest(router, "POST", "/v1/login", credentials, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "account_deactivated", decodeProblem(t, rr).Code)
+
+	rr = SendRequest(router, "POST", "/v1/reactivation/confirm", `{"token": "`+token+`"}`, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "account_deactivated", decodeProblem(t, rr).Code)
+
+	// No new link is sent either
+	assert.Equal(t, http.StatusAccepted, SendRequest(router, "POST", "/v1/reactivation", `{"email": "banned@example.com"}`, "").Code)
+	assert.Len(t, mail.messages, 1)
+
+	// Only the operator brings it back
+	assert.NoError(t, userRepo.RestoreUser(context.Background(), user.ID))
+	assert.Equal(t, http.StatusOK, SendRequest(router, "POST", "/v1/login", credentials, "").Code)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"go-auth-app/utils"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// passwordlessSession creates a user without a password, as federated and
+// directory logins do, and logs it in loggedInAgo ago
+func passwordlessSession(t *testing.T, email, loggedInAgo string) (models.User, string) {
+	user := models.User{Name: "No Password", Email: email}
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("❌ Failed to create user: %v", err)
+	}
+	sessionRepo := repository.SessionRepository{DB: database.DB}
+	session := models.Session{UserID: user.ID}
+	if err := sessionRepo.CreateSession(context.Background(), &session); err != nil {
+		t.Fatalf("❌ Failed to create session: %v", err)
+	}
+	database.DB.Exec(`UPDATE sessions SET created_at = NOW() - $2::interval WHERE id = $1`, session.ID, loggedInAgo)
+	accessToken, err := utils.GenerateAccessToken(user.ID, session.ID, session.ActiveOrgID)
+	if err != nil {
+		t.Fatalf("❌ Failed to generate access token: %v", err)
+	}
+	return user, accessToken
+}
+
+// ✅ Test: Users without a password erase their account after a recent login, not with an old session
+func TestReauth_EraseWithoutPassword(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	_, staleToken := passwordlessSession(t, "reauth-erase-stale@example.com", "1 hour")
+	rr := SendRequest(router, "POST", "/v1/users/me/erase", `{}`, staleToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "reauthentication_required", decodeProblem(t, rr).Code)
+
+	_, freshToken := passwordlessSession(t, "reauth-erase@example.com", "1 minute")
+	rr = SendRequest(router, "POST", "/v1/users/me/erase", `{}`, freshToken)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+// ✅ Test: Users without a password change their email after a recent login
+func TestReauth_EmailChangeWithoutPassword(t *testing.T) {
+	captureMail(t)
+	router := routes.SetupRoutes()
+
+	_, staleToken := passwordlessSession(t, "reauth-email-stale@example.com", "1 hour")
+	rr := SendRequest(router, "POST", "/v1/users/me/email", `{"new_email": "reauth-email-new@example.com"}`, staleToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "reauthentication_required", decodeProblem(t, rr).Code)
+
+	_, freshToken := passwordlessSession(t, "reauth-email@example.com", "1 minute")
+	rr = SendRequest(router, "POST", "/v1/users/me/email", `{"new_email": "reauth-email-new@example.com"}`, freshToken)
+	assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+}
+
+// ✅ Test: Users without a password set a first one without an old one, after a recent login
+func TestReauth_FirstPassword(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	_, staleToken := passwordlessSession(t, "reauth-password-stale@example.com", "1 hour")
+	rr := SendRequest(router, "POST", "/v1/users/me/reset-password", `{"new_password": "firstpassword"}`, staleToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "reauthentication_required", decodeProblem(t, rr).Code)
+
+	_, freshToken := passwordlessSession(t, "reauth-password@example.com", "1 minute")
+	rr = SendRequest(router, "POST", "/v1/users/me/reset-password", `{"new_password": "firstpassword"}`, freshToken)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// ✅ The password now works, and from here on it is needed
+	rr = SendRequest(router, "POST", "/v1/login", `{"email": "reauth-password@example.com", "password": "firstpassword"}`, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = SendRequest(router, "POST", "/v1/users/me/reset-password", `{"new_password": "secondpassword"}`, freshToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "invalid_credentials", decodeProblem(t, rr).Code)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// registrationClient sends JSON requests through the router, authenticated as token when set
+func registrationClient(t *testing.T) func(method, path, body, token string) *httptest.ResponseRecorder {
+	router := routes.SetupRoutes()
+	return func(method, path, body, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+// createAdmin creates a user with the admin role and returns its access token
+func createAdmin(t *testing.T, email string) string {
+	admin, accessToken, err := CreateAuthenticatedUser(email, "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	userRepo := repository.UserRepository{DB: database.DB}
+	if err := userRepo.GrantRole(context.Background(), admin.ID, models.RoleAdmin); err != nil {
+		t.Fatalf("❌ Failed to grant admin role: %v", err)
+	}
+	return accessToken
+}
+
+// ✅ Test: Invite-only registration with email-bound, single-use codes and a domain allow list
+func TestRegistration_InviteOnly(t *testing.T) {
+	adminToken := createAdmin(t, "invite-admin@example.com")
+	t.Setenv("REGISTRATION_MODE", "invite_only")
+	t.Setenv("REGISTRATION_ALLOWED_DOMAINS", "example.com")
+	do := registrationClient(t)
+
+	register := func(email, code string) *httptest.ResponseRecorder {
+		return do("POST", "/v1/register", fmt.Sprintf(`{"name": "Invited User", "email": %q, "password": "securepassword", "invite_code": %q}`, email, code), "")
+	}
+
+	rr := register("invited@example.com", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invitation only")
+
+	rr = register("invited@elsewhere.org", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "domain_not_allowed")
+
+	rr = do("POST", "/v1/admin/invite-codes", `{"email": "invited@example.com"}`, adminToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var invite handlers.CreatedInviteCode
+	json.Unmarshal(rr.Body.Bytes(), &invite)
+
+	rr = register("someone-else@example.com", invite.Code)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "email_mismatch")
+
+	assert.Equal(t, http.StatusCreated, register("invited@example.com", invite.Code).Code)
+
+	// ❌ Codes are single use
+	rr = register("invited-again@example.com", invite.Code)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "already used")
+}
+
+// ✅ Test: In approval mode accounts cannot log in until an admin approves them
+func TestRegistration_ApprovalQueue(t *testing.T) {
+	adminToken := createAdmin(t, "approval-admin@example.com")
+	t.Setenv("REGISTRATION_MODE", "approval")
+	do := registrationClient(t)
+
+	rr := do("POST", "/v1/register", `{"name": "Pending User", "email": "pending@example.com", "password": "securepassword"}`, "")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var pending handlers.PendingRegistration
+	json.Unmarshal(rr.Body.Bytes(), &pending)
+	assert.Equal(t, "pending", pending.Status)
+
+	login := `{"email": "pending@example.com", "password": "securepassword"}`
+	rr = do("POST", "/v1/login", login, "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "account_pending")
+
+	rr = do("GET", "/v1/admin/registrations", "", adminToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "pending@example.com")
+
+	path := fmt.Sprintf("/v1/admin/registrations/%d/approve", pending.ID)
+	assert.Equal(t, http.StatusOK, do("POST", path, "", adminToken).Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", path, "", adminToken).Code, "Only pending accounts can be decided")
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/login", login, "").Code)
+}
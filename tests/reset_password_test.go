@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-auth-app/routes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Changing the password signs out every other session, but not the current one
+func TestResetPassword_RevokesOtherSessions(t *testing.T) {
+	_, accessToken, err := CreateAuthenticatedUser("reset@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	// 1️⃣ A second login, e.g. on another device
+	rr := SendRequest(router, "POST", "/v1/login", `{"email": "reset@example.com", "password": "securepassword"}`, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var login map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &login)
+	otherToken := login["access_token"]
+
+	// 2️⃣ The password is changed from the first session
+	rr = SendRequest(router, "POST", "/v1/users/me/reset-password", `{"old_password": "securepassword", "new_password": "newsecurepassword"}`, accessToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "$2")
+
+	// 3️⃣ Only the session that changed it survives
+	assert.Equal(t, http.StatusOK, SendRequest(router, "GET", "/v1/users/me", "", accessToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, SendRequest(router, "GET", "/v1/users/me", "", otherToken).Code)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go-auth-app/routes"
+	"html"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubSAMLIdP is a SAML identity provider that logs in whoever is set as its
+// current user without asking, and trusts the service provider metadata of router
+type stubSAMLIdP struct {
+	*httptest.Server
+	idp saml.IdentityProvider
+
+	mu      sync.Mutex
+	session saml.Session
+}
+
+func newStubSAMLIdP(t *testing.T, router http.Handler) *stubSAMLIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("❌ Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "stub-idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("❌ Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	stub := &stubSAMLIdP{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) { stub.idp.ServeMetadata(w, r) })
+	mux.HandleFunc("/sso", func(w http.ResponseWriter, r *http.Request) { stub.idp.ServeSSO(w, r) })
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+
+	metadataURL, _ := url.Parse(stub.URL + "/metadata")
+	ssoURL, _ := url.Parse(stub.URL + "/sso")
+	stub.idp = saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: routerServiceProviders{router},
+		SessionProvider:         stub,
+	}
+	return stub
+}
+
+// logIn sets who the next login at the identity provider is
+func (s *stubSAMLIdP) logIn(nameID, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = saml.Session{
+		ID: fmt.Sprintf("session-%d", time.Now().UnixNano()), CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour),
+		NameID: nameID, NameIDFormat: string(saml.PersistentNameIDFormat),
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Type: "xs:string", Value: email}}},
+			{Name: "name", Values: []saml.AttributeValue{{Type: "xs:string", Value: "Stub User"}}},
+		},
+	}
+}
+
+func (s *stubSAMLIdP) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.session
+	return &session
+}
+
+// routerServiceProviders serves the service provider metadata published by the router
+type routerServiceProviders struct{ router http.Handler }
+
+func (p routerServiceProviders) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	entityID, _ := url.Parse(serviceProviderID)
+	req, _ := http.NewRequest("GET", entityID.Path, nil)
+	rr := httptest.NewRecorder()
+	p.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		return nil, fmt.Errorf("metadata: status %d", rr.Code)
+	}
+	var metadata saml.EntityDescriptor
+	return &metadata, xml.Unmarshal(rr.Body.Bytes(), &metadata)
+}
+
+// useStubSAMLIdP configures the stub as the "stub" identity provider
+func useStubSAMLIdP(t *testing.T, idp *stubSAMLIdP, allowIdPInitiated bool) {
+	t.Setenv("SAML_IDENTITY_PROVIDERS", fmt.Sprintf(`[{"name": "stub", "metadata_url": %q, "allow_idp_initiated": %t}]`, idp.URL+"/metadata", allowIdPInitiated))
+}
+
+var samlFormField = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+// samlForm reads the auto-submitting form the identity provider returns
+func samlForm(t *testing.T, page string) url.Values {
+	form := url.Values{}
+	for _, match := range samlFormField.FindAllStringSubmatch(page, -1) {
+		form.Set(match[1], html.UnescapeString(match[2]))
+	}
+	if form.Get("SAMLResponse") == "" {
+		t.Fatalf("❌ No SAMLResponse in the identity provider's page: %s", page)
+	}
+	return form
+}
+
+// postToACS posts the identity provider's form to the assertion consumer
+// service, with the cookies of the browser that posts it
+func postToACS(router http.Handler, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/v1/auth/saml/stub/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// samlLogin logs in at the stub identity provider and returns its form for
+// the ACS, and the cookies of the browser that started the login
+func samlLogin(t *testing.T, router http.Handler) (url.Values, []*http.Cookie) {
+	req, _ := http.NewRequest("GET", "/v1/auth/saml/stub/login", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if !assert.Equal(t, http.StatusFound, rr.Code, rr.Body.String()) {
+		t.FailNow()
+	}
+
+	resp, err := http.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("❌ Login at the identity provider failed: %v", err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	return samlForm(t, string(page)), rr.Result().Cookies()
+}
+
+// ✅ Test: A signed assertion signs up the user, and cannot be used twice
+func TestSAML_Login(t *testing.T) {
+	router := routes.SetupRoutes()
+	idp := newStubSAMLIdP(t, router)
+	useStubSAMLIdP(t, idp, false)
+	do := registrationClient(t)
+
+	idp.logIn("saml-subject-1", "saml-user@example.com")
+	form, cookies := samlLogin(t, router)
+	rr := postToACS(router, form, cookies...)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	var tokens map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	assert.Contains(t, do("GET", "/v1/users/me", "", tokens["access_token"]).Body.String(), "saml-user@example.com")
+	assert.Contains(t, do("GET", "/v1/users/me/identities", "", tokens["access_token"]).Body.String(), `"provider":"saml:stub"`)
+
+	// ❌ The same response again
+	rr = postToACS(router, form, cookies...)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "federated_login_failed", decodeProblem(t, rr).Code)
+
+	// ✅ The next login finds the linked user
+	form, cookies = samlLogin(t, router)
+	rr = postToACS(router, form, cookies...)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+// ✅ Test: A response to a login started in another browser is refused (login CSRF)
+func TestSAML_RequiresTheBrowserThatStartedTheLogin(t *testing.T) {
+	router := routes.SetupRoutes()
+	idp := newStubSAMLIdP(t, router)
+	useStubSAMLIdP(t, idp, true)
+
+	// The attacker starts a login and hands the unused response to the victim's browser
+	idp.logIn("saml-attacker", "saml-attacker@example.com")
+	form, cookies := samlLogin(t, router)
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite)
+		assert.True(t, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+
+	// ❌ Without the cookie, even where unsolicited logins are allowed
+	rr := postToACS(router, form)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, decodeProblem(t, rr).Detail, "not started from this browser")
+
+	// ❌ The relay state was used up by the attempt
+	rr = postToACS(router, form, cookies...)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// ✅ Test: Responses without a login started here, or not signed by the identity provider, are refused
+func TestSAML_RejectsForgedResponses(t *testing.T) {
+	router := routes.SetupRoutes()
+	idp := newStubSAMLIdP(t, router)
+	useStubSAMLIdP(t, idp, false)
+	idp.logIn("saml-subject-2", "saml-victim@example.com")
+
+	req, _ := http.NewRequest("GET", "/v1/auth/saml/stub/metadata", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "http://localhost:8080/v1/auth/saml/stub/acs")
+
+	// An attacker's identity provider with the same entity ID but its own key
+	attacker := newStubSAMLIdP(t, router)
+	attacker.idp.MetadataURL = idp.idp.MetadataURL
+	attacker.logIn("saml-subject-2", "saml-victim@example.com")
+	unsolicited := httptest.NewRecorder()
+	attacker.idp.ServeIDPInitiated(unsolicited, httptest.NewRequest("GET", "/sso", nil), "http://localhost:8080/v1/auth/saml/stub/metadata", "")
+	form := samlForm(t, unsolicited.Body.String())
+
+	// ❌ Unsolicited, while the identity provider only allows logins started here
+	rr = postToACS(router, form)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, decodeProblem(t, rr).Detail, "start again")
+
+	// ❌ Unsolicited logins allowed, but the signature is not the identity provider's
+	useStubSAMLIdP(t, idp, true)
+	rr = postToACS(router, form)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "federated_login_failed", decodeProblem(t, rr).Code)
+
+	req, _ = http.NewRequest("GET", "/v1/auth/saml/unknown/login", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/routes"
+	"go-auth-app/scim"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSCIMToken = "scim-test-token-0123456789abcdef0123456789"
+
+// scimClient sends SCIM requests through the router with the given bearer token
+func scimClient(t *testing.T) func(method, path, body, token string) *httptest.ResponseRecorder {
+	t.Setenv("SCIM_TOKEN", testSCIMToken)
+	router := routes.SetupRoutes()
+	return func(method, path, body, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if body != "" {
+			req.Header.Set("Content-Type", scim.ContentType)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+// ✅ Test: Only the identity provider's token gets in, and SCIM is off without one
+func TestSCIM_Auth(t *testing.T) {
+	do := scimClient(t)
+
+	rr := do("GET", "/scim/v2/ServiceProviderConfig", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, scim.ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/scim/v2/Users", "", "wrong-token").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/scim/v2/ServiceProviderConfig", "", testSCIMToken).Code)
+
+	t.Setenv("SCIM_TOKEN", "")
+	assert.Equal(t, http.StatusNotFound, do("GET", "/scim/v2/ServiceProviderConfig", "", testSCIMToken).Code)
+}
+
+// ✅ Test: Only `attribute eq "value"` filters are accepted
+func TestSCIM_ParseFilter(t *testing.T) {
+	filter, err := scim.ParseFilter(`username EQ "jane\"doe@example.com"`, "userName", "externalId")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &scim.Filter{Attribute: "userName", Value: `jane"doe@example.com`}, filter)
+	}
+
+	filter, err = scim.ParseFilter("", "userName")
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+
+	_, err = scim.ParseFilter(`userName sw "jane"`, "userName")
+	assert.Error(t, err)
+	_, err = scim.ParseFilter(`emails eq "jane@example.com"`, "userName")
+	assert.Error(t, err)
+}
+
+// ✅ Test: An identity provider provisions, looks up, updates and deactivates a user
+func TestSCIM_UserLifecycle(t *testing.T) {
+	do := scimClient(t)
+
+	rr := do("POST", "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "scim-jane@example.com",
+		"externalId": "00u1",
+		"name": {"givenName": "Jane", "familyName": "Doe"},
+		"password": "securepassword",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}
+	}`, testSCIMToken)
+	if !assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String()) {
+		return
+	}
+	var user scim.User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	assert.Equal(t, "Jane Doe", user.DisplayName)
+	assert.True(t, *user.Active)
+	assert.Equal(t, http.StatusConflict, do("POST", "/scim/v2/Users", `{"userName": "scim-jane@example.com"}`, testSCIMToken).Code)
+
+	// ✅ Lookup by userName is case-insensitive
+	var list scim.ListResponse
+	var found []scim.User
+	list.Resources = &found
+	json.Unmarshal(do("GET", `/scim/v2/Users?filter=userName+eq+"SCIM-JANE@example.com"`, "", testSCIMToken).Body.Bytes(), &list)
+	assert.Equal(t, 1, list.TotalResults)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, user.ID, found[0].ID)
+	}
+	assert.Equal(t, http.StatusBadRequest, do("GET", `/scim/v2/Users?filter=userName+co+"jane"`, "", testSCIMToken).Code)
+
+	// ✅ The user can log in with the provisioned password
+	login := `{"email": "scim-jane@example.com", "password": "securepassword"}`
+	loginRR := registrationClient(t)("POST", "/v1/login", login, "")
+	assert.Equal(t, http.StatusOK, loginRR.Code)
+
+	// ✅ PATCH with string booleans, as some identity providers send them
+	rr = do("PATCH", "/scim/v2/Users/"+user.ID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "name.formatted", "value": "Jane Smith"},
+			{"op": "Replace", "path": "active", "value": "False"}
+		]
+	}`, testSCIMToken)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	assert.Equal(t, "Jane Smith", user.DisplayName)
+	assert.False(t, *user.Active)
+
+	// ❌ Deactivated by the identity provider: logging in does not reactivate the account
+	loginRR = registrationClient(t)("POST", "/v1/login", login, "")
+	assert.Equal(t, http.StatusForbidden, loginRR.Code)
+
+	// ✅ The identity provider can reactivate it
+	rr = do("PATCH", "/scim/v2/Users/"+user.ID, `{"Operations": [{"op": "replace", "value": {"active": true}}]}`, testSCIMToken)
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	assert.True(t, *user.Active)
+	assert.Equal(t, http.StatusOK, registrationClient(t)("POST", "/v1/login", login, "").Code)
+
+	// ✅ DELETE is a soft delete too
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/scim/v2/Users/"+user.ID, "", testSCIMToken).Code)
+	json.Unmarshal(do("GET", "/scim/v2/Users/"+user.ID, "", testSCIMToken).Body.Bytes(), &user)
+	assert.False(t, *user.Active)
+}
+
+// ✅ Test: Group membership grants and revokes the role named after the group
+func TestSCIM_Groups(t *testing.T) {
+	do := scimClient(t)
+
+	var alice, bob scim.User
+	json.Unmarshal(do("POST", "/scim/v2/Users", `{"userName": "scim-alice@example.com", "displayName": "Alice"}`, testSCIMToken).Body.Bytes(), &alice)
+	json.Unmarshal(do("POST", "/scim/v2/Users", `{"userName": "scim-bob@example.com", "displayName": "Bob"}`, testSCIMToken).Body.Bytes(), &bob)
+
+	rr := do("POST", "/scim/v2/Groups", fmt.Sprintf(`{"displayName": "auditors", "members": [{"value": %q}]}`, alice.ID), testSCIMToken)
+	if !assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String()) {
+		return
+	}
+	var group scim.Group
+	json.Unmarshal(rr.Body.Bytes(), &group)
+	assert.Len(t, group.Members, 1)
+	assert.Equal(t, http.StatusConflict, do("POST", "/scim/v2/Groups", `{"displayName": "auditors"}`, testSCIMToken).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/scim/v2/Groups", `{"displayName": "ghosts", "members": [{"value": "999999"}]}`, testSCIMToken).Code)
+
+	// ✅ Add Bob, then remove Alice with a filtered path
+	rr = do("PATCH", "/scim/v2/Groups/"+group.ID, fmt.Sprintf(`{"Operations": [
+		{"op": "add", "path": "members", "value": [{"value": %q}]},
+		{"op": "remove", "path": "members[value eq \"%s\"]"}
+	]}`, bob.ID, alice.ID), testSCIMToken)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	json.Unmarshal(rr.Body.Bytes(), &group)
+	if assert.Len(t, group.Members, 1) {
+		assert.Equal(t, bob.ID, group.Members[0].Value)
+	}
+
+	// ✅ Users list the groups they belong to
+	json.Unmarshal(do("GET", "/scim/v2/Users/"+bob.ID, "", testSCIMToken).Body.Bytes(), &bob)
+	if assert.Len(t, bob.Groups, 1) {
+		assert.Equal(t, "auditors", bob.Groups[0].Display)
+	}
+	bob.Groups = nil
+
+	var list scim.ListResponse
+	json.Unmarshal(do("GET", `/scim/v2/Groups?filter=displayName+eq+"auditors"&excludedAttributes=members`, "", testSCIMToken).Body.Bytes(), &list)
+	assert.Equal(t, 1, list.TotalResults)
+
+	// ✅ Deleting the group revokes the role
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/scim/v2/Groups/"+group.ID, "", testSCIMToken).Code)
+	json.Unmarshal(do("GET", "/scim/v2/Users/"+bob.ID, "", testSCIMToken).Body.Bytes(), &bob)
+	assert.Empty(t, bob.Groups)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/scim/v2/Groups/"+group.ID, "", testSCIMToken).Code)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-auth-app/config"
+	"go-auth-app/server"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: In-flight requests finish before the server stops
+func TestServer_GracefulShutdown(t *testing.T) {
+	// Grab a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("❌ Failed to find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond) // Slow request still running at shutdown
+		w.Write([]byte("done"))
+	})
+
+	cfg := config.ServerConfig{
+		Addr:              addr,
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: time.Second,
+		WriteTimeout:      time.Second,
+		IdleTimeout:       time.Second,
+		MaxHeaderBytes:    1 << 20,
+		DrainPeriod:       10 * time.Millisecond,
+		ShutdownTimeout:   time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := false
+	runErr := make(chan error, 1)
+	go func() { runErr <- server.Run(ctx, cfg, handler, func() { drained = true }) }()
+
+	// Wait for the listener to come up
+	var resp *http.Response
+	respErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < 50; i++ {
+			resp, err = http.Get("http://" + addr)
+			if err == nil {
+				respErr <- nil
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		respErr <- err
+	}()
+
+	<-started
+	cancel()
+
+	assert.NoError(t, <-respErr, "In-flight request should not be dropped")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "done", string(body))
+
+	assert.NoError(t, <-runErr, "Server should stop gracefully")
+	assert.True(t, drained, "Readiness hook should run before shutdown")
+}
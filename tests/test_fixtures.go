@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"go-auth-app/database"
 	"go-auth-app/handlers"
 	"go-auth-app/models"
 	"go-auth-app/repository"
+	"go-auth-app/routes"
 	"go-auth-app/utils"
 	"log"
 	"net/http"
@@ -17,7 +19,7 @@ import (
 // 🔹 Fixture: Create an Authenticated Test User
 func CreateAuthenticatedUser(email, password string) (*models.User, string, error) {
 	// ✅ Hash password before storing
-	hashedPassword, err := utils.HashPassword(password)
+	hashedPassword, err := utils.HashPassword(context.Background(), password)
 	if err != nil {
 		return nil, "", err
 	}
@@ -31,7 +33,7 @@ func CreateAuthenticatedUser(email, password string) (*models.User, string, erro
 
 	// ✅ Insert into database
 	userRepo := repository.UserRepository{DB: database.DB}
-	err = userRepo.CreateUser(user)
+	err = userRepo.CreateUser(context.Background(), user)
 	if err != nil {
 		return nil, "", err
 	}
@@ -60,3 +62,51 @@ func CreateAuthenticatedUser(email, password string) (*models.User, string, erro
 
 	return user, accessToken, nil
 }
+
+// 🔹 Fixture: Create an organization owned by the user and return an access token scoped to it
+func CreateOrganizationToken(accessToken, slug string) (int, string, error) {
+	router := routes.SetupRoutes()
+
+	reqCreate, _ := http.NewRequest("POST", "/v1/orgs", bytes.NewBufferString(`{"name": "Test Org", "slug": "`+slug+`"}`))
+	reqCreate.Header.Set("Content-Type", "application/json")
+	reqCreate.Header.Set("Authorization", "Bearer "+accessToken)
+	rrCreate := httptest.NewRecorder()
+	router.ServeHTTP(rrCreate, reqCreate)
+
+	var org models.UserOrganization
+	if err := json.Unmarshal(rrCreate.Body.Bytes(), &org); err != nil || org.ID == 0 {
+		return 0, "", fmt.Errorf("organization not created: %s", rrCreate.Body.String())
+	}
+
+	// ✅ Switch the session to it
+	reqSwitch, _ := http.NewRequest("POST", fmt.Sprintf("/v1/orgs/%d/switch", org.ID), nil)
+	reqSwitch.Header.Set("Authorization", "Bearer "+accessToken)
+	rrSwitch := httptest.NewRecorder()
+	router.ServeHTTP(rrSwitch, reqSwitch)
+
+	var switchResponse map[string]string
+	json.Unmarshal(rrSwitch.Body.Bytes(), &switchResponse)
+	orgToken, exists := switchResponse["access_token"]
+	if !exists {
+		return org.ID, "", fmt.Errorf("org access token not received")
+	}
+	return org.ID, orgToken, nil
+}
+
+// 🔹 Fixture: Send a request through the router, as JSON when there is a body and
+// with the access token when one is given. headers are extra name, value pairs.
+func SendRequest(router http.Handler, method, path, body, accessToken string, headers ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"go-auth-app/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ✅ Test: JWTMiddleware spans join the trace propagated by the caller (W3C traceparent)
+func TestTracing_PropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(t.Context()) })
+
+	handler := otelhttp.NewHandler(middleware.JWTMiddleware(http.NotFoundHandler()), "http.server")
+
+	req, _ := http.NewRequest("GET", "/users/me", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "Expected 401 Unauthorized without a token")
+
+	spans := exporter.GetSpans()
+	names := map[string]bool{}
+	for _, span := range spans {
+		names[span.Name] = true
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), "Span %s should continue the incoming trace", span.Name)
+	}
+	assert.True(t, names["JWTMiddleware"], "Expected a JWTMiddleware span")
+	assert.True(t, names["http.server"], "Expected a server span")
+}
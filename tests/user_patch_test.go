@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: PATCH /v1/users/me applies a merge patch guarded by If-Match
+func TestPatchUser_ETagConcurrency(t *testing.T) {
+	_, accessToken, err := CreateAuthenticatedUser("patchtest@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	router := routes.SetupRoutes()
+
+	send := func(method, body, ifMatch string) *httptest.ResponseRecorder {
+		headers := []string{"Content-Type", "application/merge-patch+json"}
+		if ifMatch != "" {
+			headers = append(headers, "If-Match", ifMatch)
+		}
+		return SendRequest(router, method, "/v1/users/me", body, accessToken, headers...)
+	}
+
+	// 1️⃣ GET returns the current ETag
+	rrGet := send("GET", "", "")
+	assert.Equal(t, http.StatusOK, rrGet.Code)
+	etag := rrGet.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// 2️⃣ PATCH without If-Match is refused
+	rr := send("PATCH", `{"name": "Patched Name"}`, "")
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+
+	// 3️⃣ PATCH with the current ETag succeeds and returns a new one
+	rr = send("PATCH", `{"name": "Patched Name"}`, etag)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var user map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	assert.Equal(t, "Patched Name", user["name"])
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+
+	// 4️⃣ Replaying the stale ETag is a conflict
+	rr = send("PATCH", `{"name": "Lost Update"}`, etag)
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+	// 5️⃣ Read-only fields cannot be changed
+	rr = send("PATCH", `{"email": "other@example.com"}`, "*")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "read_only")
+}
+
+// ✅ Test: PATCH /v1/users/me requires authentication
+func TestPatchUser_Unauthorized(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("PATCH", "/v1/users/me", bytes.NewBufferString(`{"name": "Nobody"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
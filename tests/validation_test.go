@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"go-auth-app/handlers"
+	"go-auth-app/validation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Every invalid field is reported at once, in field order
+func TestValidation_ReportsAllFieldErrors(t *testing.T) {
+	errs := validation.Struct(handlers.RegisterRequest{
+		Name:     "  a ",
+		Email:    "not-an-email",
+		Password: "",
+	})
+
+	if assert.Len(t, errs, 3) {
+		assert.Equal(t, "name", errs[0].Field)
+		assert.Equal(t, "min_length", errs[0].Code)
+		assert.Equal(t, "email", errs[1].Field)
+		assert.Equal(t, "email", errs[1].Code)
+		assert.Equal(t, "password", errs[2].Field)
+		assert.Equal(t, "required", errs[2].Code)
+	}
+}
+
+// ✅ Test: Strict decoding rejects bad bodies before any database access
+func TestDecode_StrictRequestBodies(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"malformed JSON", "application/json", `{"email": "a@b.co",`, http.StatusBadRequest, "invalid_request"},
+		{"empty body", "application/json", ``, http.StatusBadRequest, "invalid_request"},
+		{"unknown field", "application/json", `{"email": "a@b.co", "password": "x", "admin": true}`, http.StatusBadRequest, "validation_failed"},
+		{"wrong type", "application/json", `{"email": 42, "password": "x"}`, http.StatusBadRequest, "validation_failed"},
+		{"trailing data", "application/json", `{"email": "a@b.co", "password": "x"} {}`, http.StatusBadRequest, "invalid_request"},
+		{"wrong content type", "text/plain", `{"email": "a@b.co", "password": "x"}`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"too large", "application/json", `{"email": "` + strings.Repeat("a", 2<<20) + `", "password": "x"}`, http.StatusRequestEntityTooLarge, "request_too_large"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+
+			handlers.LoginUser(rr, req)
+
+			assert.Equal(t, tc.status, rr.Code)
+			assert.Equal(t, tc.code, decodeProblem(t, rr).Code)
+		})
+	}
+}
+
+// ✅ Test: Passwords are limited to bcrypt's 72 bytes, not characters, and are not trimmed
+func TestValidation_PasswordBytes(t *testing.T) {
+	valid := handlers.RegisterRequest{Name: "Test User", Email: "bytes@example.com"}
+
+	valid.Password = strings.Repeat("é", 36) // 72 bytes
+	assert.Empty(t, validation.Struct(valid))
+
+	valid.Password = strings.Repeat("é", 40) // 40 characters, 80 bytes
+	if errs := validation.Struct(valid); assert.Len(t, errs, 1) {
+		assert.Equal(t, "password", errs[0].Field)
+		assert.Equal(t, "max_bytes", errs[0].Code)
+	}
+
+	errs := validation.Struct(handlers.ResetPasswordRequest{NewPassword: strings.Repeat("€", 25)})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "max_bytes", errs[0].Code)
+	}
+
+	// Surrounding spaces are part of the password
+	valid.Password = "   abc"
+	assert.Empty(t, validation.Struct(valid))
+}
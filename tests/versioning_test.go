@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"go-auth-app/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Versioned paths are served without deprecation headers
+func TestVersioning_V1Routes(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/v1/users/me", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+	assert.Empty(t, rr.Header().Get("Sunset"))
+}
+
+// ✅ Test: Legacy paths still work but announce their deprecation and successor
+func TestVersioning_LegacyAliases(t *testing.T) {
+	router := routes.SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/users/me", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Regexp(t, `^@\d+$`, rr.Header().Get("Deprecation"))
+	assert.Equal(t, "Fri, 30 Apr 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/users/me>; rel="successor-version"`, rr.Header().Get("Link"))
+
+	// Wrong methods are still reported as such on both paths
+	for _, path := range []string{"/login", "/v1/login"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, path)
+	}
+}
+
+// ✅ Test: Only the pre-versioning paths have legacy aliases, new endpoints are v1-only
+func TestVersioning_LegacyAliasesAreFrozen(t *testing.T) {
+	registered := map[string]bool{}
+	err := routes.NewRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // subrouter prefixes have no methods of their own
+		}
+		for _, method := range methods {
+			registered[method+" "+tmpl] = true
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	aliases := map[string]bool{}
+	for route := range registered {
+		method, path, _ := strings.Cut(route, " ")
+		if !strings.HasPrefix(path, "/v1/") && registered[method+" /v1"+path] {
+			aliases[route] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{
+		"POST /register":                true,
+		"POST /login":                   true,
+		"POST /refresh":                 true,
+		"GET /users":                    true,
+		"GET /users/me":                 true,
+		"PATCH /users/me":               true,
+		"PATCH /users/me/update":        true,
+		"DELETE /users/me/deactivate":   true,
+		"POST /users/me/reset-password": true,
+	}, aliases)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/repository"
+	"go-auth-app/routes"
+	"go-auth-app/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test: Signatures cover the body and the timestamp
+func TestWebhook_Signature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"abc","type":"user.registered"}`)
+	signature := webhook.Sign("whsec_test", now, body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	assert.NoError(t, webhook.Verify("whsec_test", timestamp, signature, body, 5*time.Minute, now))
+	assert.NoError(t, webhook.Verify("whsec_test", timestamp, "v1=deadbeef "+signature, body, 5*time.Minute, now))
+	assert.ErrorIs(t, webhook.Verify("whsec_other", timestamp, signature, body, 5*time.Minute, now), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("whsec_test", timestamp, signature, []byte(`{}`), 5*time.Minute, now), webhook.ErrInvalidSignature)
+
+	// A replayed delivery is rejected once outside the tolerance
+	assert.ErrorIs(t, webhook.Verify("whsec_test", timestamp, signature, body, 5*time.Minute, now.Add(10*time.Minute)), webhook.ErrStaleTimestamp)
+}
+
+// ✅ Test: Retries back off exponentially up to the cap
+func TestWebhook_Backoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhook.Backoff(1, 30*time.Second, time.Hour))
+	assert.Equal(t, 60*time.Second, webhook.Backoff(2, 30*time.Second, time.Hour))
+	assert.Equal(t, 4*time.Minute, webhook.Backoff(4, 30*time.Second, time.Hour))
+	assert.Equal(t, time.Hour, webhook.Backoff(30, 30*time.Second, time.Hour))
+}
+
+// ✅ Test: User changes reach subscribers signed, and failing deliveries end up dead-lettered
+func TestWebhook_DeliveryAndDeadLetter(t *testing.T) {
+	admin, accessToken, err := CreateAuthenticatedUser("hooks@example.com", "securepassword")
+	if err != nil {
+		t.Fatalf("❌ Failed to create authenticated user: %v", err)
+	}
+	userRepo := repository.UserRepository{DB: database.DB}
+	assert.NoError(t, userRepo.GrantRole(context.Background(), admin.ID, models.RoleAdmin))
+	router := routes.SetupRoutes()
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		return SendRequest(router, method, path, body, accessToken)
+	}
+
+	// A receiver that checks signatures, and one that always fails
+	var mu sync.Mutex
+	var received []models.WebhookEvent
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := webhook.Verify(secret, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now())
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event models.WebhookEvent
+		json.Unmarshal(body, &event)
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	// Events of earlier tests are drained before anyone subscribes
+	cfg := config.Get().Webhooks
+	cfg.MaxAttempts = 2
+	cfg.BatchSize = 1000
+	dispatcher := webhook.NewDispatcher(cfg)
+	_, _, err = dispatcher.RunOnce(context.Background())
+	assert.NoError(t, err)
+
+	rr := send("POST", "/v1/admin/webhooks", `{"url": "`+receiver.URL+`", "event_types": ["user.registered"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created handlers.CreatedWebhook
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	secret = created.Secret
+
+	rr = send("POST", "/v1/admin/webhooks", `{"url": "`+broken.URL+`", "event_types": ["user.deactivated"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var brokenSub handlers.CreatedWebhook
+	json.Unmarshal(rr.Body.Bytes(), &brokenSub)
+
+	rr = send("POST", "/v1/admin/webhooks", `{"url": "ftp://example.com", "event_types": ["user.exploded"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// 1️⃣ Registering queues an event that is delivered signed
+	rr = send("POST", "/v1/register", `{"name": "Hooked User", "email": "hooked@example.com", "password": "securepassword"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var registered handlers.UserResponse
+	json.Unmarshal(rr.Body.Bytes(), &registered)
+
+	_, _, err = dispatcher.RunOnce(context.Background())
+	assert.NoError(t, err)
+
+	mu.Lock()
+	var found bool
+	for _, event := range received {
+		found = found || (event.Type == models.WebhookUserRegistered && bytes.Contains(event.Data, []byte(`"user_id":`+strconv.Itoa(registered.ID))))
+	}
+	mu.Unlock()
+	assert.True(t, found, "user.registered was not delivered")
+
+	// 2️⃣ A failing endpoint is retried later, then dead-lettered
+	assert.NoError(t, userRepo.SoftDeleteUser(context.Background(), registered.ID, models.DeactivatedBySelf))
+	_, failed, err := dispatcher.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+
+	deliveriesPath := "/v1/admin/webhooks/" + strconv.Itoa(brokenSub.ID) + "/deliveries"
+	var list struct{ Deliveries []models.WebhookDelivery }
+	json.Unmarshal(send("GET", deliveriesPath, "").Body.Bytes(), &list)
+	if !assert.Len(t, list.Deliveries, 1) {
+		return
+	}
+	assert.Equal(t, models.DeliveryPending, list.Deliveries[0].Status)
+	assert.True(t, list.Deliveries[0].NextAttemptAt.After(time.Now()))
+
+	_, err = database.DB.Exec(`UPDATE webhook_deliveries SET next_attempt_at = NOW() WHERE subscription_id = $1`, brokenSub.ID)
+	assert.NoError(t, err)
+	_, failed, err = dispatcher.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+
+	json.Unmarshal(send("GET", deliveriesPath+"?status=dead", "").Body.Bytes(), &list)
+	if assert.Len(t, list.Deliveries, 1) {
+		assert.Equal(t, 2, list.Deliveries[0].Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, *list.Deliveries[0].LastStatusCode)
+
+		rr = send("POST", deliveriesPath+"/"+strconv.FormatInt(list.Deliveries[0].ID, 10)+"/retry", "")
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	}
+
+	// 3️⃣ Settled events are pruned, but not those with a delivery still pending
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	pruned, err := webhookRepo.PruneEvents(context.Background(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.NotZero(t, pruned)
+
+	var registeredLeft, deactivatedLeft int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM webhook_outbox WHERE payload->>'email' = 'hooked@example.com'`).Scan(&registeredLeft)
+	database.DB.QueryRow(`SELECT COUNT(*) FROM webhook_outbox WHERE event_type = $1`, models.WebhookUserDeactivated).Scan(&deactivatedLeft)
+	assert.Zero(t, registeredLeft)
+	assert.Equal(t, 1, deactivatedLeft)
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go-auth-app/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation scope used for all spans created by the app
+const instrumentationName = "go-auth-app"
+
+// Tracer returns the application tracer (a no-op tracer until Init is called)
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Init configures the global tracer provider and the W3C trace context propagator.
+//
+// The exporter is selected with tracing.exporter (OTEL_TRACES_EXPORTER):
+//   - "otlp":   OTLP over HTTP, honouring the standard OTEL_EXPORTER_OTLP_* variables
+//   - "stdout": pretty-printed spans on stdout (handy without a collector)
+//   - "none" or unset: spans are recorded for propagation only and never exported
+//
+// The returned function flushes pending spans and must be called on shutdown.
+func Init(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	// Always propagate incoming trace context, even when nothing is exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporterName := cfg.Exporter
+	if exporterName == "" || exporterName == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch exporterName {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", exporterName, err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = instrumentationName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	fmt.Println("🔭 Tracing enabled, exporting spans via", exporterName)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the caller's address without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
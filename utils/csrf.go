@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"go-auth-app/config"
+	"go-auth-app/models"
+	"strconv"
+	"strings"
+)
+
+// CSRFToken returns the CSRF token of a session for cookie clients. It is
+// derived from the session, so nothing is stored, and signed with the refresh
+// token key: a token set by another site or subdomain does not match.
+func CSRFToken(sessionID int) string {
+	kid, secret := signingKey(models.KeyPurposeRefresh, config.Get().JWT.RefreshSecret)
+	return kid + ":" + csrfMAC(secret, sessionID)
+}
+
+// ValidCSRFToken checks a CSRF token against the session, with the key it names
+func ValidCSRFToken(sessionID int, token string) bool {
+	kid, mac, ok := strings.Cut(token, ":")
+	if !ok {
+		return false
+	}
+	jwtConfig := config.Get().JWT
+	secret, err := verificationKey(models.KeyPurposeRefresh, kid, jwtConfig.RefreshSecret, jwtConfig.RefreshExpiration)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(csrfMAC(secret, sessionID)))
+}
+
+func csrfMAC(secret string, sessionID int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf:" + strconv.Itoa(sessionID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,21 +1,31 @@
 package utils
 
 import (
+	"context"
+	"go-auth-app/tracing"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 // HashPassword hashes a given password
-func HashPassword(password string) (string, error) {
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Tracer().Start(ctx, "utils.HashPassword")
+	defer span.End()
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		span.RecordError(err)
+	}
 	return string(hashedPassword), err // Convert []byte to string
 }
 
 // CheckPasswordHash verifies if the hashed password matches the plain text password
-func CheckPasswordHash(password, hash string) bool {
+func CheckPasswordHash(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Tracer().Start(ctx, "utils.CheckPasswordHash")
+	defer span.End()
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
-		
 		return false
 	}
 	return true
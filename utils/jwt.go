@@ -2,8 +2,8 @@ package utils
 
 import (
 	"fmt"
-	"os"
-	"strconv"
+	"go-auth-app/config"
+	"go-auth-app/models"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,61 +11,85 @@ import (
 
 // Claims struct for JWT tokens
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID    int `json:"user_id"`
+	SessionID int `json:"sid"`
+	// OrgID is the session's active organization, access tokens only
+	OrgID int `json:"org_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateAccessToken creates a short-lived JWT for authentication
-func GenerateAccessToken(userID int) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	expMinutes, _ := strconv.Atoi(os.Getenv("JWT_ACCESS_EXPIRATION")) // Default: 15 min
-
-	claims := Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expMinutes) * time.Minute)),
-		},
+// SigningKeysLoaded reports whether tokens can be signed for both purposes,
+// either with a rotated key from the database or with the configured secret
+func SigningKeysLoaded() error {
+	jwtConfig := config.Get().JWT
+	if _, secret := signingKey(models.KeyPurposeAccess, jwtConfig.Secret); secret == "" {
+		return fmt.Errorf("no access token signing key: JWT_SECRET is not set and no key was rotated")
+	}
+	if _, secret := signingKey(models.KeyPurposeRefresh, jwtConfig.RefreshSecret); secret == "" {
+		return fmt.Errorf("no refresh token signing key: JWT_REFRESH_SECRET is not set and no key was rotated")
 	}
+	return nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// GenerateAccessToken creates a short-lived JWT for authentication, orgID is 0
+// when the session has no active organization
+func GenerateAccessToken(userID, sessionID, orgID int) (string, error) {
+	jwtConfig := config.Get().JWT
+	kid, secret := signingKey(models.KeyPurposeAccess, jwtConfig.Secret)
+	return signToken(userID, sessionID, orgID, jwtConfig.AccessExpiration, kid, secret)
 }
 
 // GenerateRefreshToken creates a long-lived JWT for re-authentication
-func GenerateRefreshToken(userID int) (string, error) {
-	refreshSecret := os.Getenv("JWT_REFRESH_SECRET")
-	expHours, _ := strconv.Atoi(os.Getenv("JWT_REFRESH_EXPIRATION")) // Default: 7 days
+func GenerateRefreshToken(userID, sessionID int) (string, error) {
+	jwtConfig := config.Get().JWT
+	kid, secret := signingKey(models.KeyPurposeRefresh, jwtConfig.RefreshSecret)
+	return signToken(userID, sessionID, 0, jwtConfig.RefreshExpiration, kid, secret)
+}
 
+func signToken(userID, sessionID, orgID int, expiration time.Duration, kid, secret string) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		OrgID:     orgID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expHours) * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(refreshSecret))
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString([]byte(secret))
 }
 
-// ValidateToken checks if a given JWT is valid and extracts user ID
-func ValidateToken(tokenString string, isRefresh bool) (int, error) {
-	secret := os.Getenv("JWT_SECRET")
+// ValidateToken checks if a given JWT is valid and extracts its claims
+func ValidateToken(tokenString string, isRefresh bool) (*Claims, error) {
+	jwtConfig := config.Get().JWT
+	purpose, fallback, lifetime := models.KeyPurposeAccess, jwtConfig.Secret, jwtConfig.AccessExpiration
 	if isRefresh {
-		secret = os.Getenv("JWT_REFRESH_SECRET")
+		purpose, fallback, lifetime = models.KeyPurposeRefresh, jwtConfig.RefreshSecret, jwtConfig.RefreshExpiration
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, err := verificationKey(purpose, kid, fallback, lifetime)
+		if err != nil {
+			return nil, err
+		}
 		return []byte(secret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil || !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		return 0, fmt.Errorf("invalid token claims")
+		return nil, fmt.Errorf("invalid token claims")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
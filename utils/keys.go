@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"go-auth-app/models"
+	"sync/atomic"
+	"time"
+)
+
+// keyring holds the signing keys loaded from the database, newest first
+var keyring atomic.Pointer[[]models.SigningKey]
+
+// SetSigningKeys replaces the rotated signing keys used to sign and verify tokens
+func SetSigningKeys(keys []models.SigningKey) {
+	keyring.Store(&keys)
+}
+
+// signingKey returns the newest active key for the purpose, or the configured
+// fallback secret (with an empty kid) until a rotated key becomes active.
+// Rotated keys only sign once every server has loaded them.
+func signingKey(purpose, fallback string) (kid, secret string) {
+	now := time.Now()
+	if keys := keyring.Load(); keys != nil {
+		for _, key := range *keys {
+			if key.Purpose == purpose && !key.ActivatesAt.After(now) && (key.RetiredAt == nil || key.RetiredAt.After(now)) {
+				return key.KID, key.Secret
+			}
+		}
+	}
+	return "", fallback
+}
+
+// verificationKey finds the secret a token was signed with from its kid header.
+// Tokens without a kid were signed with the configured secret, which is
+// retired by the first rotation: they are only accepted until tokens it
+// could have signed have expired (lifetime after the first key took over).
+func verificationKey(purpose, kid, fallback string, lifetime time.Duration) (string, error) {
+	if kid == "" {
+		if fallback == "" {
+			return "", fmt.Errorf("no signing secret configured")
+		}
+		if takeover, rotated := firstActivation(purpose); rotated && time.Since(takeover) > lifetime {
+			return "", fmt.Errorf("the configured signing secret was retired by a key rotation")
+		}
+		return fallback, nil
+	}
+
+	if keys := keyring.Load(); keys != nil {
+		for _, key := range *keys {
+			if key.KID == kid && key.Purpose == purpose {
+				return key.Secret, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown signing key %q", kid)
+}
+
+// firstActivation returns when the oldest rotated key of the purpose became
+// active. Keys are only purged once retired for longer than any token lives,
+// so a purged first key cannot reopen the fallback's window.
+func firstActivation(purpose string) (activatedAt time.Time, rotated bool) {
+	if keys := keyring.Load(); keys != nil {
+		for _, key := range *keys {
+			if key.Purpose == purpose && (!rotated || key.ActivatesAt.Before(activatedAt)) {
+				activatedAt, rotated = key.ActivatesAt, true
+			}
+		}
+	}
+	return activatedAt, rotated
+}
+
+// GenerateSigningKey creates a new random 256-bit key for the purpose
+func GenerateSigningKey(purpose string) (models.SigningKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return models.SigningKey{}, err
+	}
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		KID:     purpose + "-" + hex.EncodeToString(kid),
+		Purpose: purpose,
+		Secret:  base64.RawURLEncoding.EncodeToString(secret),
+	}, nil
+}
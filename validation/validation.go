@@ -0,0 +1,170 @@
+// Package validation checks request structs against declarative `validate` tags.
+//
+// Supported rules, comma separated:
+//
+//	required   the field must be present and, for strings, not blank
+//	min=N      strings: at least N characters (surrounding spaces ignored); numbers: at least N
+//	max=N      strings: at most N characters; numbers: at most N
+//	maxbytes=N strings: at most N bytes once UTF-8 encoded, e.g. bcrypt's 72
+//	notrim     strings: surrounding spaces count, e.g. for passwords
+//	email      the string must look like an email address
+//	oneof=a b  the value must be one of the space separated options
+//
+// Fields are reported under their JSON name. Nil pointers and empty optional
+// fields skip every rule but required.
+package validation
+
+import (
+	"fmt"
+	"go-auth-app/apierror"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// Struct validates every tagged field of v (a struct or pointer to struct)
+// and returns all failures, in field order
+func Struct(v interface{}) []apierror.FieldError {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation.Struct called with %T", v))
+	}
+
+	var errs []apierror.FieldError
+	for i := 0; i < value.NumField(); i++ {
+		sf := value.Type().Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+		if fieldErr := checkField(jsonName(sf), value.Field(i), tag); fieldErr != nil {
+			errs = append(errs, *fieldErr)
+		}
+	}
+	return errs
+}
+
+// checkField applies the rules in order and stops at the first failure for the field
+func checkField(name string, field reflect.Value, tag string) *apierror.FieldError {
+	rules := strings.Split(tag, ",")
+
+	// Unwrap pointers; a nil pointer means the field was absent
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			if contains(rules, "required") {
+				return &apierror.FieldError{Field: name, Code: "required", Message: name + " is required"}
+			}
+			return nil
+		}
+		field = field.Elem()
+	}
+
+	trim := !contains(rules, "notrim")
+	if isEmpty(field, trim) {
+		if contains(rules, "required") {
+			return &apierror.FieldError{Field: name, Code: "required", Message: name + " is required"}
+		}
+		return nil
+	}
+
+	for _, rule := range rules {
+		ruleName, param, _ := strings.Cut(rule, "=")
+		if msg, code := check(ruleName, param, field, trim); msg != "" {
+			return &apierror.FieldError{Field: name, Code: code, Message: name + " " + msg}
+		}
+	}
+	return nil
+}
+
+// check returns a message and code describing why field breaks the rule, or "" if it passes
+func check(rule, param string, field reflect.Value, trim bool) (string, string) {
+	switch rule {
+	case "required", "notrim":
+		return "", ""
+	case "min", "max":
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s=%q", rule, param))
+		}
+		if field.Kind() == reflect.String {
+			value := field.String()
+			if trim {
+				value = strings.TrimSpace(value)
+			}
+			length := utf8.RuneCountInString(value)
+			if rule == "min" && length < limit {
+				return fmt.Sprintf("must be at least %d characters long", limit), "min_length"
+			}
+			if rule == "max" && length > limit {
+				return fmt.Sprintf("must be at most %d characters long", limit), "max_length"
+			}
+			return "", ""
+		}
+		n := numeric(field)
+		if rule == "min" && n < int64(limit) {
+			return fmt.Sprintf("must be at least %d", limit), "min"
+		}
+		if rule == "max" && n > int64(limit) {
+			return fmt.Sprintf("must be at most %d", limit), "max"
+		}
+	case "maxbytes":
+		limit, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s=%q", rule, param))
+		}
+		if len(field.String()) > limit {
+			return fmt.Sprintf("must be at most %d bytes long", limit), "max_bytes"
+		}
+	case "email":
+		if !emailPattern.MatchString(strings.TrimSpace(field.String())) {
+			return "must be a valid email address", "email"
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		if !contains(options, fmt.Sprint(field.Interface())) {
+			return "must be one of: " + strings.Join(options, ", "), "one_of"
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+	return "", ""
+}
+
+func numeric(field reflect.Value) int64 {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint())
+	}
+	panic(fmt.Sprintf("validation: min/max not supported on %s", field.Kind()))
+}
+
+func isEmpty(field reflect.Value, trim bool) bool {
+	if field.Kind() == reflect.String && trim {
+		return strings.TrimSpace(field.String()) == ""
+	}
+	return field.IsZero()
+}
+
+// jsonName returns the name the field has in request bodies
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
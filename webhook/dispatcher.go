@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/repository"
+	"go-auth-app/tracing"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Dispatcher moves events from the outbox to subscribers
+type Dispatcher struct {
+	Config config.WebhooksConfig
+	Client *http.Client
+}
+
+// NewDispatcher returns a dispatcher whose requests time out after cfg.Timeout
+func NewDispatcher(cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{Config: cfg, Client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Backoff is the wait before the next attempt after the given number of
+// failed attempts: initial, doubled after every further failure, capped at max
+func Backoff(failures int, initial, max time.Duration) time.Duration {
+	wait := initial
+	for i := 1; i < failures && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// RunOnce fans a batch of new outbox events out to their subscriptions, then
+// attempts a batch of the deliveries that are due. It returns how many
+// deliveries succeeded and failed.
+func (d *Dispatcher) RunOnce(ctx context.Context) (delivered, failed int, err error) {
+	webhookRepo := repository.WebhookRepository{DB: database.DB}
+	if _, err := webhookRepo.FanOutEvents(ctx, d.Config.BatchSize); err != nil {
+		return 0, 0, err
+	}
+
+	// Deliveries are leased for longer than the request can take
+	claimed, err := webhookRepo.ClaimDueDeliveries(ctx, d.Config.BatchSize, 2*d.Config.Timeout+time.Minute)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, delivery := range claimed {
+		statusCode, sendErr := d.send(ctx, delivery)
+		if sendErr == nil {
+			delivered++
+			err = webhookRepo.MarkDelivered(ctx, delivery.ID, statusCode)
+		} else {
+			failed++
+			attempts := delivery.Attempts + 1
+			var retryAt *time.Time
+			if attempts < d.Config.MaxAttempts {
+				next := time.Now().Add(Backoff(attempts, d.Config.InitialBackoff, d.Config.MaxBackoff))
+				retryAt = &next
+			} else {
+				fmt.Printf("☠️ Webhook delivery %d dead-lettered after %d attempts: %v\n", delivery.ID, attempts, sendErr)
+			}
+			err = webhookRepo.MarkFailed(ctx, delivery.ID, statusCode, truncate(sendErr.Error(), 500), retryAt)
+		}
+		if err != nil {
+			return delivered, failed, err
+		}
+	}
+	return delivered, failed, nil
+}
+
+// send POSTs the signed event and returns the response status (0 without a response)
+func (d *Dispatcher) send(ctx context.Context, delivery repository.ClaimedDelivery) (statusCode int, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook.Deliver")
+	span.SetAttributes(
+		attribute.Int64("webhook.delivery_id", delivery.ID),
+		attribute.String("webhook.event_type", delivery.Event.Type),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-auth-app-webhooks/1")
+	req.Header.Set(IDHeader, delivery.Event.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, now, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}